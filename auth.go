@@ -0,0 +1,244 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2017 Oracle and/or its affiliates.  All rights reserved.
+// This program is free software: you can modify it and/or redistribute it
+// under the terms of:
+//
+// (i)  the Universal Permissive License v 1.0 or at your option, any
+//      later version (http://oss.oracle.com/licenses/upl); and/or
+//
+// (ii) the Apache License v 2.0. (http://www.apache.org/licenses/LICENSE-2.0)
+//-----------------------------------------------------------------------------
+
+package main
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/oracle/oci-go-sdk/common"
+	"github.com/oracle/oci-go-sdk/common/auth"
+	"github.com/pkg/errors"
+)
+
+// The ways the watcher can authenticate against the object store.
+const (
+	authInstancePrincipal = "instance-principal"
+	authResourcePrincipal = "resource-principal"
+	authConfigFile        = "config-file"
+	authAPIKey            = "api-key"
+)
+
+// authModes are all valid values of the auth flag.
+var authModes = []string{authInstancePrincipal, authResourcePrincipal, authConfigFile, authAPIKey}
+
+// authOptions selects and configures the configuration provider used to
+// sign object store requests.
+type authOptions struct {
+	Mode string
+
+	// ConfigFile and Profile are used by config-file.
+	ConfigFile string
+	Profile    string
+
+	// Tenancy, User, Fingerprint, KeyFile and Region are used by api-key.
+	Tenancy     string
+	User        string
+	Fingerprint string
+	KeyFile     string
+	Region      string
+
+	// KeyPassphrase decrypts the private key of config-file and api-key.
+	KeyPassphrase string
+}
+
+// validate returns an error if the options of the mode are incomplete.
+func (o authOptions) validate() error {
+	switch o.Mode {
+	case authInstancePrincipal, authResourcePrincipal:
+		return nil
+	case authConfigFile:
+		if o.ConfigFile == "" {
+			return errors.New("oci-config is required for config-file authentication")
+		}
+		return nil
+	case authAPIKey:
+		var missing []string
+		for _, f := range []struct{ flag, value string }{
+			{"oci-tenancy", o.Tenancy},
+			{"oci-user", o.User},
+			{"oci-fingerprint", o.Fingerprint},
+			{"oci-key-file", o.KeyFile},
+			{"oci-region", o.Region},
+		} {
+			if f.value == "" {
+				missing = append(missing, f.flag)
+			}
+		}
+		if len(missing) > 0 {
+			return fmt.Errorf("missing %s for api-key authentication", strings.Join(missing, ", "))
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown auth mode %q, must be one of %s", o.Mode, strings.Join(authModes, ", "))
+}
+
+// configurationProvider returns the configuration provider for o.
+func configurationProvider(o authOptions) (common.ConfigurationProvider, error) {
+	switch o.Mode {
+	case authInstancePrincipal:
+		return auth.InstancePrincipalConfigurationProvider()
+	case authResourcePrincipal:
+		return resourcePrincipalConfigurationProvider()
+	case authConfigFile:
+		return common.ConfigurationProviderFromFileWithProfile(expandHome(o.ConfigFile), o.Profile, o.KeyPassphrase)
+	case authAPIKey:
+		key, err := ioutil.ReadFile(expandHome(o.KeyFile))
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to read oci-key-file")
+		}
+		var passphrase *string
+		if o.KeyPassphrase != "" {
+			passphrase = &o.KeyPassphrase
+		}
+		return common.NewRawConfigurationProvider(o.Tenancy, o.User, o.Region, o.Fingerprint, string(key), passphrase), nil
+	}
+	return nil, fmt.Errorf("unknown auth mode %q", o.Mode)
+}
+
+// expandHome replaces a leading ~ in path with the home directory.
+func expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home := os.Getenv("HOME"); home != "" {
+			return filepath.Join(home, path[1:])
+		}
+	}
+	return path
+}
+
+// The environment variables that are set for a resource principal, for
+// example in an Fn function running on OCI.
+const (
+	resourcePrincipalVersionEnv    = "OCI_RESOURCE_PRINCIPAL_VERSION"
+	resourcePrincipalTokenEnv      = "OCI_RESOURCE_PRINCIPAL_RPST"
+	resourcePrincipalKeyEnv        = "OCI_RESOURCE_PRINCIPAL_PRIVATE_PEM"
+	resourcePrincipalPassphraseEnv = "OCI_RESOURCE_PRINCIPAL_PRIVATE_PEM_PASSPHRASE"
+	resourcePrincipalRegionEnv     = "OCI_RESOURCE_PRINCIPAL_REGION"
+)
+
+// resourcePrincipalProvider signs requests with the resource principal
+// session token and key from the environment. The token, key and passphrase
+// are either given as values or as absolute paths to files holding them.
+// Files are read again for every request, as they are refreshed while the
+// watcher runs.
+type resourcePrincipalProvider struct {
+	token      string
+	key        string
+	passphrase string
+	region     string
+}
+
+func resourcePrincipalConfigurationProvider() (common.ConfigurationProvider, error) {
+	version := os.Getenv(resourcePrincipalVersionEnv)
+	if version != "2.2" {
+		return nil, fmt.Errorf("unsupported resource principal version %q in %s", version, resourcePrincipalVersionEnv)
+	}
+
+	p := resourcePrincipalProvider{
+		token:      os.Getenv(resourcePrincipalTokenEnv),
+		key:        os.Getenv(resourcePrincipalKeyEnv),
+		passphrase: os.Getenv(resourcePrincipalPassphraseEnv),
+		region:     os.Getenv(resourcePrincipalRegionEnv),
+	}
+	if p.token == "" || p.key == "" || p.region == "" {
+		return nil, fmt.Errorf("%s, %s and %s are required for resource principal authentication", resourcePrincipalTokenEnv, resourcePrincipalKeyEnv, resourcePrincipalRegionEnv)
+	}
+
+	if _, err := p.TenancyOCID(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// valueOrFile returns the content of s if it is an absolute path, s itself
+// otherwise.
+func valueOrFile(s string) (string, error) {
+	if !filepath.IsAbs(s) {
+		return s, nil
+	}
+	b, err := ioutil.ReadFile(s)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+func (p resourcePrincipalProvider) PrivateRSAKey() (*rsa.PrivateKey, error) {
+	key, err := valueOrFile(p.key)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read resource principal key")
+	}
+
+	var passphrase *string
+	if p.passphrase != "" {
+		pass, err := valueOrFile(p.passphrase)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to read resource principal passphrase")
+		}
+		passphrase = &pass
+	}
+	return common.PrivateKeyFromBytes([]byte(key), passphrase)
+}
+
+func (p resourcePrincipalProvider) KeyID() (string, error) {
+	token, err := valueOrFile(p.token)
+	if err != nil {
+		return "", errors.Wrap(err, "unable to read resource principal token")
+	}
+	return "ST$" + token, nil
+}
+
+// TenancyOCID returns the tenancy from the claims of the session token.
+func (p resourcePrincipalProvider) TenancyOCID() (string, error) {
+	token, err := valueOrFile(p.token)
+	if err != nil {
+		return "", errors.Wrap(err, "unable to read resource principal token")
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", errors.New("resource principal token is not a JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return "", errors.Wrap(err, "invalid resource principal token")
+	}
+
+	var claims struct {
+		Tenant string `json:"res_tenant"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return "", errors.Wrap(err, "invalid resource principal token")
+	}
+	if claims.Tenant == "" {
+		return "", errors.New("resource principal token has no res_tenant claim")
+	}
+	return claims.Tenant, nil
+}
+
+func (p resourcePrincipalProvider) UserOCID() (string, error) {
+	return "", nil
+}
+
+func (p resourcePrincipalProvider) KeyFingerprint() (string, error) {
+	return "", nil
+}
+
+func (p resourcePrincipalProvider) Region() (string, error) {
+	return p.region, nil
+}
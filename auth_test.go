@@ -0,0 +1,204 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2017 Oracle and/or its affiliates.  All rights reserved.
+// This program is free software: you can modify it and/or redistribute it
+// under the terms of:
+//
+// (i)  the Universal Permissive License v 1.0 or at your option, any
+//      later version (http://oss.oracle.com/licenses/upl); and/or
+//
+// (ii) the Apache License v 2.0. (http://www.apache.org/licenses/LICENSE-2.0)
+//-----------------------------------------------------------------------------
+
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testTenancy = "ocid1.tenancy.oc1..aaaaaaaatest"
+
+func TestAuthOptionsValidate(t *testing.T) {
+	apiKey := authOptions{
+		Mode:        authAPIKey,
+		Tenancy:     testTenancy,
+		User:        "ocid1.user.oc1..aaaaaaaatest",
+		Fingerprint: "aa:bb",
+		KeyFile:     "key.pem",
+		Region:      "us-phoenix-1",
+	}
+	withoutUserAndRegion := apiKey
+	withoutUserAndRegion.User = ""
+	withoutUserAndRegion.Region = ""
+
+	tests := []struct {
+		name     string
+		options  authOptions
+		expected string
+	}{
+		{name: "instance principal", options: authOptions{Mode: authInstancePrincipal}},
+		{name: "resource principal", options: authOptions{Mode: authResourcePrincipal}},
+		{name: "config file", options: authOptions{Mode: authConfigFile, ConfigFile: "~/.oci/config"}},
+		{name: "config file without file", options: authOptions{Mode: authConfigFile}, expected: "oci-config is required"},
+		{name: "api key", options: apiKey},
+		{name: "api key without user and region", options: withoutUserAndRegion, expected: "missing oci-user, oci-region for api-key"},
+		{name: "api key without anything", options: authOptions{Mode: authAPIKey}, expected: "missing oci-tenancy, oci-user, oci-fingerprint, oci-key-file, oci-region"},
+		{name: "unknown mode", options: authOptions{Mode: "password"}, expected: `unknown auth mode "password"`},
+		{name: "no mode", options: authOptions{}, expected: `unknown auth mode ""`},
+	}
+
+	for _, test := range tests {
+		err := test.options.validate()
+		switch {
+		case test.expected == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		case test.expected != "" && (err == nil || !strings.Contains(err.Error(), test.expected)):
+			t.Errorf("%s: expected an error with %q, got %v", test.name, test.expected, err)
+		}
+	}
+}
+
+// authTempDir returns a temporary directory and a func that removes it.
+func authTempDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "auth-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func TestValueOrFile(t *testing.T) {
+	dir, cleanup := authTempDir(t)
+	defer cleanup()
+
+	path := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(path, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		value    string
+		expected string
+	}{
+		{value: "literal", expected: "literal"},
+		{value: "relative/path", expected: "relative/path"},
+		{value: path, expected: "from-file"},
+	}
+	for _, test := range tests {
+		got, err := valueOrFile(test.value)
+		if err != nil || got != test.expected {
+			t.Errorf("%s: expected %q, got %q %v", test.value, test.expected, got, err)
+		}
+	}
+
+	if _, err := valueOrFile(filepath.Join(dir, "missing")); err == nil {
+		t.Error("Expected a missing file to fail")
+	}
+}
+
+// testRPST returns a resource principal session token with claims. Only
+// the claims are read, so the signature is made up.
+func testRPST(claims string) string {
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`)) + "." + enc.EncodeToString([]byte(claims)) + ".c2lnbmF0dXJl"
+}
+
+// setResourcePrincipalEnv sets the environment of a resource principal and
+// returns a func that restores it.
+func setResourcePrincipalEnv(version, token, key string) func() {
+	values := map[string]string{
+		resourcePrincipalVersionEnv: version,
+		resourcePrincipalTokenEnv:   token,
+		resourcePrincipalKeyEnv:     key,
+		resourcePrincipalRegionEnv:  "us-phoenix-1",
+	}
+	old := make(map[string]string)
+	for k, v := range values {
+		old[k] = os.Getenv(k)
+		os.Setenv(k, v)
+	}
+	return func() {
+		for k, v := range old {
+			os.Setenv(k, v)
+		}
+	}
+}
+
+func TestResourcePrincipalProvider(t *testing.T) {
+	dir, cleanup := authTempDir(t)
+	defer cleanup()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM := string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+	token := testRPST(`{"sub":"ocid1.fnfunc.oc1..aaaaaaaatest","res_tenant":"` + testTenancy + `"}`)
+
+	tokenFile := filepath.Join(dir, "rpst")
+	keyFile := filepath.Join(dir, "key.pem")
+	if err := ioutil.WriteFile(tokenFile, []byte(token+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, []byte(keyPEM), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, mode := range []struct{ name, token, key string }{
+		{"values", token, keyPEM},
+		{"files", tokenFile, keyFile},
+	} {
+		restore := setResourcePrincipalEnv("2.2", mode.token, mode.key)
+		p, err := resourcePrincipalConfigurationProvider()
+		restore()
+		if err != nil {
+			t.Errorf("%s: %v", mode.name, err)
+			continue
+		}
+
+		if tenancy, err := p.TenancyOCID(); err != nil || tenancy != testTenancy {
+			t.Errorf("%s: expected the tenancy %s, got %s %v", mode.name, testTenancy, tenancy, err)
+		}
+		if keyID, err := p.KeyID(); err != nil || keyID != "ST$"+token {
+			t.Errorf("%s: expected the session token as key ID, got %s %v", mode.name, keyID, err)
+		}
+		if region, err := p.Region(); err != nil || region != "us-phoenix-1" {
+			t.Errorf("%s: unexpected region %s %v", mode.name, region, err)
+		}
+		if k, err := p.PrivateRSAKey(); err != nil || k.N.Cmp(key.N) != 0 {
+			t.Errorf("%s: unexpected private key %v", mode.name, err)
+		}
+	}
+}
+
+func TestResourcePrincipalProviderErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		version  string
+		token    string
+		expected string
+	}{
+		{name: "old version", version: "1.1", token: testRPST(`{"res_tenant":"t"}`), expected: "unsupported resource principal version"},
+		{name: "missing token", version: "2.2", expected: "are required"},
+		{name: "not a jwt", version: "2.2", token: "token", expected: "not a JWT"},
+		{name: "invalid claims", version: "2.2", token: "a.!!!.c", expected: "invalid resource principal token"},
+		{name: "no tenant", version: "2.2", token: testRPST(`{"sub":"s"}`), expected: "no res_tenant claim"},
+	}
+
+	for _, test := range tests {
+		restore := setResourcePrincipalEnv(test.version, test.token, "key")
+		_, err := resourcePrincipalConfigurationProvider()
+		restore()
+		if err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("%s: expected an error with %q, got %v", test.name, test.expected, err)
+		}
+	}
+}
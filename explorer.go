@@ -0,0 +1,205 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2017 Oracle and/or its affiliates.  All rights reserved.
+// This program is free software: you can modify it and/or redistribute it
+// under the terms of:
+//
+// (i)  the Universal Permissive License v 1.0 or at your option, any
+//      later version (http://oss.oracle.com/licenses/upl); and/or
+//
+// (ii) the Apache License v 2.0. (http://www.apache.org/licenses/LICENSE-2.0)
+//-----------------------------------------------------------------------------
+
+package main
+
+// explorerHTML is a page that lists the operations of the swagger spec and
+// sends requests to them. It does not load anything but the spec, so it
+// works without internet access.
+const explorerHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>OCI Object Store Watcher API</title>
+<style>
+body { font-family: sans-serif; margin: 2em auto; max-width: 60em; color: #222; }
+h1 small { font-size: 50%; color: #777; }
+.op { border: 1px solid #ccc; border-radius: 4px; margin: 1em 0; }
+.op > summary { cursor: pointer; padding: .5em; background: #f5f5f5; }
+.op > div { padding: .5em 1em 1em; }
+.method { display: inline-block; width: 4.5em; font-weight: bold; text-transform: uppercase; }
+.get { color: #1a7f37; } .post { color: #0969da; } .put { color: #9a6700; } .delete { color: #cf222e; }
+label { display: block; margin: .3em 0; }
+label span { display: inline-block; width: 8em; }
+textarea { width: 100%; height: 10em; font-family: monospace; }
+pre { background: #f5f5f5; padding: .5em; max-height: 30em; overflow: auto; white-space: pre-wrap; }
+.summary { color: #555; white-space: pre-line; }
+</style>
+</head>
+<body>
+<h1>OCI Object Store Watcher API <small id="version"></small></h1>
+<p id="description"></p>
+<p><a href="` + swaggerPath + `">swagger.json</a></p>
+<div id="operations">Loading the spec...</div>
+<script>
+(function() {
+  "use strict";
+
+  var spec;
+
+  function el(tag, attrs, children) {
+    var e = document.createElement(tag);
+    Object.keys(attrs || {}).forEach(function(k) { e.setAttribute(k, attrs[k]); });
+    (children || []).forEach(function(c) {
+      e.appendChild(typeof c === "string" ? document.createTextNode(c) : c);
+    });
+    return e;
+  }
+
+  // example returns a value of the schema with every field empty.
+  function example(schema, depth) {
+    if (!schema || depth > 5) { return null; }
+    if (schema.$ref) {
+      return example(spec.definitions[schema.$ref.replace("#/definitions/", "")], depth + 1);
+    }
+    switch (schema.type) {
+    case "array": return [];
+    case "string": return "";
+    case "integer": case "number": return 0;
+    case "boolean": return false;
+    }
+    var value = {};
+    Object.keys(schema.properties || {}).forEach(function(k) {
+      value[k] = example(schema.properties[k], depth + 1);
+    });
+    return value;
+  }
+
+  function render(path, method, op) {
+    var inputs = {}, body = null, output = el("pre"), stop = null;
+    var form = el("div");
+
+    if (op.summary) { form.appendChild(el("p", {"class": "summary"}, [op.summary])); }
+    (op.parameters || []).forEach(function(p) {
+      if (p.in === "body") {
+        body = el("textarea");
+        body.value = JSON.stringify(example(p.schema, 0), null, 2);
+        form.appendChild(el("label", {}, [el("span", {}, ["body"])]));
+        form.appendChild(body);
+        return;
+      }
+      inputs[p.name] = el("input", {"placeholder": p.in + (p.required ? ", required" : "")});
+      form.appendChild(el("label", {"title": p.description || ""}, [el("span", {}, [p.name]), inputs[p.name]]));
+    });
+
+    var send = el("button", {}, ["Send"]);
+    var cancel = el("button", {"disabled": ""}, ["Stop"]);
+    form.appendChild(el("p", {}, [send, " ", cancel]));
+    form.appendChild(output);
+
+    function url() {
+      var u = path, query = [];
+      (op.parameters || []).forEach(function(p) {
+        var v = inputs[p.name] && inputs[p.name].value;
+        if (!v) { return; }
+        if (p.in === "path") {
+          u = u.replace("{" + p.name + "}", encodeURIComponent(v));
+        } else if (p.in === "query") {
+          query.push(encodeURIComponent(p.name) + "=" + encodeURIComponent(v));
+        }
+      });
+      return query.length ? u + "?" + query.join("&") : u;
+    }
+
+    function print(line) {
+      output.textContent += line + "\n";
+      output.scrollTop = output.scrollHeight;
+    }
+
+    function streaming(close) {
+      stop = close;
+      cancel.removeAttribute("disabled");
+    }
+
+    cancel.onclick = function() {
+      if (stop) { stop(); stop = null; }
+      cancel.setAttribute("disabled", "");
+      print("(stopped)");
+    };
+
+    send.onclick = function() {
+      if (stop) { cancel.onclick(); }
+      output.textContent = "";
+
+      if (op.operationId === "EventWebSocket") {
+        var ws = new WebSocket(location.origin.replace(/^http/, "ws") + url());
+        ws.onmessage = function(m) { print(m.data); };
+        ws.onerror = function() { print("(error)"); };
+        ws.onclose = function() { print("(closed)"); };
+        streaming(function() { ws.close(); });
+        return;
+      }
+      if ((op.produces || []).indexOf("text/event-stream") >= 0) {
+        var source = new EventSource(url());
+        source.onmessage = function(m) { print("id: " + m.lastEventId + "\n" + m.data); };
+        source.onerror = function() { print("(reconnecting)"); };
+        streaming(function() { source.close(); });
+        return;
+      }
+
+      var init = {method: method.toUpperCase(), headers: {}};
+      if (body) {
+        init.body = body.value;
+        init.headers["Content-Type"] = "application/json";
+      }
+      var controller = window.AbortController ? new AbortController() : null;
+      if (controller) { init.signal = controller.signal; }
+
+      fetch(url(), init).then(function(res) {
+        print(res.status + " " + res.statusText);
+        var stream = /streaming/.test(((op.responses || {})["200"] || {}).description || "");
+        if (!stream || !res.body) {
+          return res.text().then(function(text) {
+            try { text = JSON.stringify(JSON.parse(text), null, 2); } catch (e) {}
+            print(text);
+          });
+        }
+        if (controller) { streaming(function() { controller.abort(); }); }
+        var reader = res.body.getReader(), decoder = new TextDecoder();
+        return reader.read().then(function next(chunk) {
+          if (chunk.done) { return; }
+          output.textContent += decoder.decode(chunk.value, {stream: true});
+          return reader.read().then(next);
+        });
+      }).catch(function(err) {
+        if (err.name !== "AbortError") { print("(" + err + ")"); }
+      });
+    };
+
+    return el("details", {"class": "op"}, [
+      el("summary", {}, [el("span", {"class": "method " + method}, [method]), path]),
+      form
+    ]);
+  }
+
+  fetch("` + swaggerPath + `").then(function(res) {
+    if (!res.ok) { throw new Error(res.status + " " + res.statusText); }
+    return res.json();
+  }).then(function(s) {
+    spec = s;
+    document.getElementById("version").textContent = spec.info.version;
+    document.getElementById("description").textContent = spec.info.description || "";
+    var operations = document.getElementById("operations");
+    operations.textContent = "";
+    Object.keys(spec.paths).sort().forEach(function(path) {
+      ["get", "post", "put", "patch", "delete"].forEach(function(method) {
+        var op = spec.paths[path][method];
+        if (op) { operations.appendChild(render(path, method, op)); }
+      });
+    });
+  }).catch(function(err) {
+    document.getElementById("operations").textContent = "Unable to load the spec: " + err;
+  });
+})();
+</script>
+</body>
+</html>
+`
@@ -24,6 +24,7 @@ import (
 	"github.com/fnproject/oci-objectstore-watcher/ociobjectstorewatcherpb"
 	"github.com/grpc-ecosystem/grpc-gateway/runtime"
 	"github.com/grpc-ecosystem/grpc-opentracing/go/otgrpc"
+	"github.com/opentracing/opentracing-go"
 	"github.com/pkg/errors"
 	"github.com/wercker/pkg/conf"
 	"github.com/wercker/pkg/log"
@@ -50,6 +51,11 @@ var gatewayFlags = []cli.Flag{
 		Value:  "localhost:43403",
 		EnvVar: "GRPC_HOST",
 	},
+	cli.StringSliceFlag{
+		Name:   "cors-origins",
+		Usage:  "Origins browsers may call the API from, * for any. CORS is disabled if empty",
+		EnvVar: "GATEWAY_CORS_ORIGINS",
+	},
 }
 
 var gatewayAction = func(c *cli.Context) error {
@@ -72,20 +78,9 @@ var gatewayAction = func(c *cli.Context) error {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	mux := runtime.NewServeMux(runtime.WithMarshalerOption(runtime.MIMEWildcard, &runtime.JSONPb{EmitDefaults: true})) // grpc-gateway
-
-	// The following handlers will be called in reversed order (ie. bottom to top)
-	var handler http.Handler
-	handler = trace.HTTPMiddleware(handler, tracer) // opentracing + expose trace ID
-
-	opts := []grpc.DialOption{
-		grpc.WithInsecure(),
-		grpc.WithUnaryInterceptor(otgrpc.OpenTracingClientInterceptor(tracer)), // opentracing (outgoing)
-	}
-
-	err = ociobjectstorewatcherpb.RegisterOciObjectstoreWatcherHandlerFromEndpoint(ctx, mux, o.Host, opts)
+	handler, err := newGatewayHandler(ctx, o, tracer)
 	if err != nil {
-		log.WithError(err).Error("Unable to register handler from Endpoint")
+		log.WithError(err).Error("Unable to create the gateway handler")
 		return errorExitCode
 	}
 
@@ -122,11 +117,63 @@ var gatewayAction = func(c *cli.Context) error {
 	return nil
 }
 
+// newGatewayHandler returns the HTTP stack of the gateway, with the
+// grpc-gateway mux of the gRPC server at o.Host at its core.
+func newGatewayHandler(ctx context.Context, o *gatewayOptions, tracer opentracing.Tracer) (http.Handler, error) {
+	mux := runtime.NewServeMux(runtime.WithMarshalerOption(runtime.MIMEWildcard, &runtime.JSONPb{EmitDefaults: true})) // grpc-gateway
+
+	opts := []grpc.DialOption{
+		grpc.WithInsecure(),
+		grpc.WithUnaryInterceptor(otgrpc.OpenTracingClientInterceptor(tracer)), // opentracing (outgoing)
+	}
+
+	conn, err := grpc.Dial(o.Host, opts...)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		<-ctx.Done()
+		if err := conn.Close(); err != nil {
+			log.WithError(err).Warn("Unable to close connection to the gRPC server")
+		}
+	}()
+
+	err = ociobjectstorewatcherpb.RegisterOciObjectstoreWatcherHandler(ctx, mux, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	spec, err := swaggerSpec()
+	if err != nil {
+		return nil, fmt.Errorf("invalid swagger spec - %v", err)
+	}
+
+	// The live feeds and the REST contract are served next to the
+	// grpc-gateway routes
+	client := ociobjectstorewatcherpb.NewOciObjectstoreWatcherClient(conn)
+	routes := http.NewServeMux()
+	routes.Handle(eventStreamPath, eventStreamHandler(client))
+	routes.Handle(eventWebSocketPath, eventWebSocketHandler(client, o.CORSOrigins))
+	routes.Handle(swaggerPath, staticHandler("application/json", spec))
+	routes.Handle(explorerPath, staticHandler("text/html; charset=utf-8", []byte(explorerHTML)))
+	routes.Handle("/", mux)
+
+	// The following handlers will be called in reversed order (ie. bottom to top)
+	var handler http.Handler = routes
+	handler = gzipHandler(handler)                  // compress responses
+	handler = corsHandler(handler, o.CORSOrigins)   // cross-origin requests from browsers
+	handler = recoverHandler(handler)               // panics become a 500
+	handler = logHandler(handler)                   // request log
+	handler = trace.HTTPMiddleware(handler, tracer) // opentracing + expose trace ID
+	return handler, nil
+}
+
 type gatewayOptions struct {
 	*conf.TraceOptions
 
-	Port int
-	Host string
+	Port        int
+	Host        string
+	CORSOrigins []string
 }
 
 func parseGatewayOptions(c *cli.Context) (*gatewayOptions, error) {
@@ -140,7 +187,8 @@ func parseGatewayOptions(c *cli.Context) (*gatewayOptions, error) {
 	return &gatewayOptions{
 		TraceOptions: traceOptions,
 
-		Port: port,
-		Host: c.String("host"),
+		Port:        port,
+		Host:        c.String("host"),
+		CORSOrigins: c.StringSlice("cors-origins"),
 	}, nil
 }
@@ -0,0 +1,329 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2017 Oracle and/or its affiliates.  All rights reserved.
+// This program is free software: you can modify it and/or redistribute it
+// under the terms of:
+//
+// (i)  the Universal Permissive License v 1.0 or at your option, any
+//      later version (http://oss.oracle.com/licenses/upl); and/or
+//
+// (ii) the Apache License v 2.0. (http://www.apache.org/licenses/LICENSE-2.0)
+//-----------------------------------------------------------------------------
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+
+	"github.com/fnproject/oci-objectstore-watcher/objectstoretest"
+	"github.com/fnproject/oci-objectstore-watcher/ociobjectstorewatcherpb"
+	"github.com/fnproject/oci-objectstore-watcher/server"
+)
+
+const watchesPath = "/api/v3/oci-objectstore-watcher/watches"
+
+// testGateway is a gateway in front of a gRPC server that watches the
+// buckets of a fake object store.
+type testGateway struct {
+	*httptest.Server
+
+	store   *objectstoretest.Server
+	watcher *server.ObjectWatcher
+	hook    *httptest.Server
+	close   func()
+}
+
+func newTestGateway(t *testing.T) *testGateway {
+	dir, err := ioutil.TempDir("", "gateway-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Snapshots are written to the working directory
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	store := objectstoretest.NewServer()
+	client, err := store.Client()
+	if err != nil {
+		t.Fatal(err)
+	}
+	watcher := server.NewObjectWatcher(server.NewOCIObjectStore(client), server.Watch{
+		Namespace:    "ns",
+		PollInterval: 20 * time.Millisecond,
+	}, server.DeliveryOptions{Retries: 1, Timeout: time.Second})
+	srv, err := server.New(watcher)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := grpc.NewServer()
+	ociobjectstorewatcherpb.RegisterOciObjectstoreWatcherServer(s, srv)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(lis)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	handler, err := newGatewayHandler(ctx, &gatewayOptions{
+		Host:        lis.Addr().String(),
+		CORSOrigins: []string{"http://example.com"},
+	}, opentracing.NoopTracer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g := &testGateway{
+		Server:  httptest.NewServer(handler),
+		store:   store,
+		watcher: watcher,
+		hook:    httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})),
+	}
+	g.close = func() {
+		g.Server.Close()
+		cancel()
+		s.Stop()
+		watcher.Shutdown()
+		store.Close()
+		g.hook.Close()
+		os.Chdir(wd)
+		os.RemoveAll(dir)
+	}
+	return g
+}
+
+// call sends a JSON request and decodes the JSON response into v, if it is
+// not nil. It returns the status of the response.
+func (g *testGateway) call(t *testing.T, method, path string, body, v interface{}) int {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, g.URL+path, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, path, err)
+	}
+	defer res.Body.Close()
+
+	if v != nil && res.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+			t.Fatalf("%s %s: invalid response - %v", method, path, err)
+		}
+	}
+	return res.StatusCode
+}
+
+func TestGatewayWatches(t *testing.T) {
+	g := newTestGateway(t)
+	defer g.close()
+
+	var created ociobjectstorewatcherpb.Watch
+	status := g.call(t, http.MethodPost, watchesPath, map[string]interface{}{
+		"id":         "uploads",
+		"bucket":     "bucket",
+		"webhookUrl": g.hook.URL,
+		"prefix":     "uploads/",
+	}, &created)
+	if status != http.StatusOK || created.Id != "uploads" || created.Namespace != "ns" {
+		t.Fatalf("Unexpected create response %d %+v", status, created)
+	}
+	if w, err := g.watcher.Get("uploads"); err != nil || w.Prefix != "uploads/" {
+		t.Errorf("Expected the watch to reach the watcher, got %+v (%v)", w, err)
+	}
+
+	var got ociobjectstorewatcherpb.Watch
+	if status := g.call(t, http.MethodGet, watchesPath+"/uploads", nil, &got); status != http.StatusOK || got.Bucket != "bucket" {
+		t.Errorf("Unexpected get response %d %+v", status, got)
+	}
+
+	var updated ociobjectstorewatcherpb.Watch
+	status = g.call(t, http.MethodPut, watchesPath+"/uploads", map[string]interface{}{
+		"bucket":     "bucket",
+		"webhookUrl": g.hook.URL,
+		"prefix":     "logs/",
+	}, &updated)
+	if status != http.StatusOK || updated.Prefix != "logs/" {
+		t.Errorf("Unexpected update response %d %+v", status, updated)
+	}
+
+	var list ociobjectstorewatcherpb.ListWatchesResponse
+	if status := g.call(t, http.MethodGet, watchesPath, nil, &list); status != http.StatusOK || len(list.Watches) != 1 {
+		t.Errorf("Unexpected list response %d %+v", status, list)
+	}
+
+	if status := g.call(t, http.MethodDelete, watchesPath+"/uploads", nil, nil); status != http.StatusOK {
+		t.Errorf("Expected the watch to be deleted, got %d", status)
+	}
+	if status := g.call(t, http.MethodGet, watchesPath+"/uploads", nil, nil); status != http.StatusNotFound {
+		t.Errorf("Expected 404 for a deleted watch, got %d", status)
+	}
+	if status := g.call(t, http.MethodPost, watchesPath, map[string]interface{}{"id": "no-bucket"}, nil); status != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid watch, got %d", status)
+	}
+}
+
+func TestGatewayRejectsLocalSinks(t *testing.T) {
+	g := newTestGateway(t)
+	defer g.close()
+
+	dir, err := ioutil.TempDir("", "gateway-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	watches := map[string]map[string]interface{}{
+		"exec":    {"bucket": "bucket", "sinks": []string{g.hook.URL, "exec:touch " + filepath.Join(dir, "exec")}},
+		"file":    {"bucket": "bucket", "sinks": []string{"file:" + filepath.Join(dir, "file")}},
+		"webhook": {"bucket": "bucket", "webhookUrl": "exec:touch " + filepath.Join(dir, "webhook")},
+	}
+	for name, watch := range watches {
+		if status := g.call(t, http.MethodPost, watchesPath, watch, nil); status != http.StatusForbidden {
+			t.Errorf("%s: expected 403, got %d", name, status)
+		}
+	}
+
+	if status := g.call(t, http.MethodPost, watchesPath, map[string]interface{}{"bucket": "bucket", "webhookUrl": g.hook.URL}, nil); status != http.StatusOK {
+		t.Fatalf("Unable to create watch: %d", status)
+	}
+	if status := g.call(t, http.MethodPut, watchesPath+"/bucket", watches["file"], nil); status != http.StatusForbidden {
+		t.Errorf("Expected 403 for an update with a file sink, got %d", status)
+	}
+
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("Expected no sink to run, got %v", files)
+	}
+}
+
+func TestGatewayStreamsGzippedEvents(t *testing.T) {
+	g := newTestGateway(t)
+	defer g.close()
+
+	req, err := http.NewRequest(http.MethodGet, g.URL+"/api/v3/oci-objectstore-watcher/events?bucket=bucket", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept-Encoding", "gzip")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK || res.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Expected a gzipped stream, got %d %v", res.StatusCode, res.Header)
+	}
+
+	// The stream is subscribed once the headers arrive
+	g.store.PutObject("ns", "bucket", "a", []byte("a"))
+	if status := g.call(t, http.MethodPost, watchesPath, map[string]interface{}{"bucket": "bucket", "webhookUrl": g.hook.URL}, nil); status != http.StatusOK {
+		t.Fatalf("Unable to create watch: %d", status)
+	}
+
+	events := make(chan ociobjectstorewatcherpb.Event, 1)
+	go func() {
+		gz, err := gzip.NewReader(res.Body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		// The event is decoded as protobuf JSON, which has int64 as strings
+		var chunk struct {
+			Result json.RawMessage `json:"result"`
+		}
+		if err := json.NewDecoder(gz).Decode(&chunk); err != nil {
+			t.Error(err)
+			return
+		}
+		var e ociobjectstorewatcherpb.Event
+		if err := eventMarshaler.Unmarshal(chunk.Result, &e); err != nil {
+			t.Error(err)
+			return
+		}
+		events <- e
+	}()
+
+	select {
+	case e := <-events:
+		if e.Type != "NEW" || e.Bucket != "bucket" || e.ObjectName != "a" {
+			t.Errorf("Unexpected event %+v", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected an event through the gateway")
+	}
+}
+
+func TestGatewayCORS(t *testing.T) {
+	g := newTestGateway(t)
+	defer g.close()
+
+	req, err := http.NewRequest(http.MethodOptions, g.URL+watchesPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Origin", "http://example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	req.Header.Set("Access-Control-Request-Headers", "content-type")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNoContent ||
+		res.Header.Get("Access-Control-Allow-Origin") != "http://example.com" ||
+		res.Header.Get("Access-Control-Allow-Headers") != "content-type" {
+		t.Errorf("Unexpected preflight response %d %v", res.StatusCode, res.Header)
+	}
+
+	req, err = http.NewRequest(http.MethodGet, g.URL+watchesPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Origin", "http://elsewhere.com")
+	res, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || res.Header.Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("Expected other origins not to be allowed, got %d %v", res.StatusCode, res.Header)
+	}
+}
+
+func TestRecoverHandler(t *testing.T) {
+	h := logHandler(recoverHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected a panic to become a 500, got %d", w.Code)
+	}
+}
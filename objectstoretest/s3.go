@@ -0,0 +1,220 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2017 Oracle and/or its affiliates.  All rights reserved.
+// This program is free software: you can modify it and/or redistribute it
+// under the terms of:
+//
+// (i)  the Universal Permissive License v 1.0 or at your option, any
+//      later version (http://oss.oracle.com/licenses/upl); and/or
+//
+// (ii) the Apache License v 2.0. (http://www.apache.org/licenses/LICENSE-2.0)
+//-----------------------------------------------------------------------------
+
+package objectstoretest
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The credentials accepted by a server started with NewS3Server.
+const (
+	S3AccessKey = "minioadmin"
+	S3SecretKey = "minioadmin"
+)
+
+// NewS3Server starts a fake S3 compatible server, like MinIO, that serves the
+// buckets of namespace with path style addressing. Requests have to be
+// signed with Signature Version 4 for S3AccessKey, the signature itself is
+// not checked. It must be closed when the test is done.
+func NewS3Server(namespace string) *Server {
+	s := &Server{
+		buckets:     make(map[string]map[string]*Object),
+		pageSize:    1000,
+		s3Namespace: namespace,
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// parseS3Path splits a path like /{bucket}/{object}.
+func (s *Server) parseS3Path(p string) (namespace, bucket, object string, ok bool) {
+	parts := strings.SplitN(strings.TrimPrefix(p, "/"), "/", 2)
+	if parts[0] == "" {
+		return "", "", "", false
+	}
+	if len(parts) == 2 {
+		object = parts[1]
+	}
+	return s.s3Namespace, parts[0], object, true
+}
+
+func (s *Server) serveS3(w http.ResponseWriter, r *http.Request, bucket, object string, ok bool) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential="+S3AccessKey+"/") || r.Header.Get("X-Amz-Date") == "" {
+		writeS3Error(w, http.StatusForbidden, "AccessDenied", "request is not signed for "+S3AccessKey)
+		return
+	}
+
+	switch {
+	case !ok:
+		writeS3Error(w, http.StatusBadRequest, "InvalidRequest", "unknown path "+r.URL.Path)
+	case object == "" && r.Method == http.MethodGet:
+		s.listObjectsV2(w, r, bucket)
+	case object != "" && (r.Method == http.MethodGet || r.Method == http.MethodHead):
+		s.getS3Object(w, r, bucket, object)
+	default:
+		writeS3Error(w, http.StatusMethodNotAllowed, "MethodNotAllowed", r.Method+" is not supported")
+	}
+}
+
+type s3Contents struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int    `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type listBucketResult struct {
+	XMLName               xml.Name     `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListBucketResult"`
+	Name                  string       `xml:"Name"`
+	Prefix                string       `xml:"Prefix"`
+	KeyCount              int          `xml:"KeyCount"`
+	MaxKeys               int          `xml:"MaxKeys"`
+	IsTruncated           bool         `xml:"IsTruncated"`
+	ContinuationToken     string       `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string       `xml:"NextContinuationToken,omitempty"`
+	Contents              []s3Contents `xml:"Contents"`
+}
+
+func (s *Server) listObjectsV2(w http.ResponseWriter, r *http.Request, bucket string) {
+	q := r.URL.Query()
+	if q.Get("list-type") != "2" {
+		writeS3Error(w, http.StatusNotImplemented, "NotImplemented", "only ListObjectsV2 is supported")
+		return
+	}
+
+	prefix, token := q.Get("prefix"), q.Get("continuation-token")
+	start := q.Get("start-after")
+	if token != "" {
+		b, err := base64.RawURLEncoding.DecodeString(token)
+		if err != nil {
+			writeS3Error(w, http.StatusBadRequest, "InvalidArgument", "invalid continuation token")
+			return
+		}
+		start = string(b)
+	}
+
+	limit := 1000
+	if l := q.Get("max-keys"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 0 {
+			writeS3Error(w, http.StatusBadRequest, "InvalidArgument", "invalid max-keys "+l)
+			return
+		}
+		limit = n
+	}
+
+	s.mu.Lock()
+	objects, ok := s.buckets[bucketKey(s.s3Namespace, bucket)]
+	if !ok {
+		s.mu.Unlock()
+		writeS3Error(w, http.StatusNotFound, "NoSuchBucket", "bucket "+bucket+" does not exist")
+		return
+	}
+	if s.pageSize < limit {
+		limit = s.pageSize
+	}
+
+	var names []string
+	for name := range objects {
+		// The continuation token holds the first name of the next page,
+		// start-after is exclusive
+		if strings.HasPrefix(name, prefix) && (name > start || token != "" && name == start) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	result := listBucketResult{
+		Name:              bucket,
+		Prefix:            prefix,
+		MaxKeys:           limit,
+		ContinuationToken: token,
+	}
+	for i, name := range names {
+		if i == limit {
+			result.IsTruncated = true
+			result.NextContinuationToken = base64.RawURLEncoding.EncodeToString([]byte(name))
+			break
+		}
+
+		o := objects[name]
+		result.Contents = append(result.Contents, s3Contents{
+			Key:          o.Name,
+			LastModified: o.TimeCreated.Format("2006-01-02T15:04:05.000Z"),
+			ETag:         s3ETag(o),
+			Size:         len(o.Content),
+			StorageClass: "STANDARD",
+		})
+	}
+	result.KeyCount = len(result.Contents)
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write([]byte(xml.Header))
+	xml.NewEncoder(w).Encode(result)
+}
+
+func (s *Server) getS3Object(w http.ResponseWriter, r *http.Request, bucket, name string) {
+	s.mu.Lock()
+	objects, ok := s.buckets[bucketKey(s.s3Namespace, bucket)]
+	if !ok {
+		s.mu.Unlock()
+		writeS3Error(w, http.StatusNotFound, "NoSuchBucket", "bucket "+bucket+" does not exist")
+		return
+	}
+	o, ok := objects[name]
+	if !ok {
+		s.mu.Unlock()
+		writeS3Error(w, http.StatusNotFound, "NoSuchKey", "object "+name+" does not exist")
+		return
+	}
+	object := *o
+	s.mu.Unlock()
+
+	w.Header().Set("ETag", s3ETag(&object))
+	w.Header().Set("Content-Length", strconv.Itoa(len(object.Content)))
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Last-Modified", object.TimeCreated.Format(http.TimeFormat))
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodGet {
+		w.Write(object.Content)
+	}
+}
+
+// s3ETag returns the quoted hex MD5 that S3 uses as the ETag of objects that
+// were not uploaded in parts.
+func s3ETag(o *Object) string {
+	sum, _ := base64.StdEncoding.DecodeString(o.MD5)
+	return `"` + hex.EncodeToString(sum) + `"`
+}
+
+type s3Error struct {
+	XMLName xml.Name `xml:"Error"`
+	Code    string   `xml:"Code"`
+	Message string   `xml:"Message"`
+}
+
+func writeS3Error(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	w.Write([]byte(xml.Header))
+	xml.NewEncoder(w).Encode(s3Error{Code: code, Message: message})
+}
@@ -0,0 +1,380 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2017 Oracle and/or its affiliates.  All rights reserved.
+// This program is free software: you can modify it and/or redistribute it
+// under the terms of:
+//
+// (i)  the Universal Permissive License v 1.0 or at your option, any
+//      later version (http://oss.oracle.com/licenses/upl); and/or
+//
+// (ii) the Apache License v 2.0. (http://www.apache.org/licenses/LICENSE-2.0)
+//-----------------------------------------------------------------------------
+
+// Package objectstoretest provides fake object storage servers for tests.
+// They serve the ListObjects, HeadObject and GetObject calls of the OCI
+// objectstorage client, or their S3 counterparts, from memory, and let tests
+// change objects, inject errors and slow down responses while a watcher is
+// polling them.
+package objectstoretest
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oracle/oci-go-sdk/common"
+	"github.com/oracle/oci-go-sdk/objectstorage"
+)
+
+// Object is an object stored in the fake server.
+type Object struct {
+	Name        string
+	Content     []byte
+	MD5         string
+	ETag        string
+	TimeCreated time.Time
+	StorageTier string
+}
+
+// Request is a request that was received by the fake server.
+type Request struct {
+	Method    string
+	Namespace string
+	Bucket    string
+	Object    string
+	Query     url.Values
+}
+
+// Server is a fake OCI Object Storage server. Buckets are created when the
+// first object is put into them, or with CreateBucket.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	buckets  map[string]map[string]*Object
+	pageSize int
+	latency  time.Duration
+	failures []int
+	requests []Request
+	etag     int
+
+	// s3Namespace is set for servers started with NewS3Server, it holds the
+	// buckets served over the S3 API.
+	s3Namespace string
+}
+
+// NewServer starts a fake server. It must be closed when the test is done.
+func NewServer() *Server {
+	s := &Server{
+		buckets:  make(map[string]map[string]*Object),
+		pageSize: 1000,
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Client returns an objectstorage client that talks to s. The requests are
+// signed with a throwaway key, s does not check the signatures.
+func (s *Server) Client() (objectstorage.ObjectStorageClient, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		return objectstorage.ObjectStorageClient{}, err
+	}
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	provider := common.NewRawConfigurationProvider("ocid1.tenancy.oc1..test", "ocid1.user.oc1..test", "us-phoenix-1", "00:00", string(pemKey), nil)
+	client, err := objectstorage.NewObjectStorageClientWithConfigurationProvider(provider)
+	if err != nil {
+		return objectstorage.ObjectStorageClient{}, err
+	}
+	client.Host = s.URL
+	return client, nil
+}
+
+func bucketKey(namespace, bucket string) string {
+	return namespace + "/" + bucket
+}
+
+// CreateBucket creates an empty bucket, if it does not exist yet.
+func (s *Server) CreateBucket(namespace, bucket string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.buckets[bucketKey(namespace, bucket)]; !ok {
+		s.buckets[bucketKey(namespace, bucket)] = make(map[string]*Object)
+	}
+}
+
+// PutObject adds an object, or replaces its content if it already exists.
+func (s *Server) PutObject(namespace, bucket, name string, content []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	objects, ok := s.buckets[bucketKey(namespace, bucket)]
+	if !ok {
+		objects = make(map[string]*Object)
+		s.buckets[bucketKey(namespace, bucket)] = objects
+	}
+
+	sum := md5.Sum(content)
+	s.etag++
+	objects[name] = &Object{
+		Name:        name,
+		Content:     append([]byte(nil), content...),
+		MD5:         base64.StdEncoding.EncodeToString(sum[:]),
+		ETag:        fmt.Sprintf("etag-%d", s.etag),
+		TimeCreated: time.Now().UTC().Truncate(time.Millisecond),
+		StorageTier: "Standard",
+	}
+}
+
+// DeleteObject removes an object, if it exists.
+func (s *Server) DeleteObject(namespace, bucket, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.buckets[bucketKey(namespace, bucket)], name)
+}
+
+// Object returns a copy of an object.
+func (s *Server) Object(namespace, bucket, name string) (Object, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.buckets[bucketKey(namespace, bucket)][name]
+	if !ok {
+		return Object{}, false
+	}
+	return *o, true
+}
+
+// SetPageSize limits the number of objects in a ListObjects response, the
+// rest is left to the next page which starts with NextStartWith.
+func (s *Server) SetPageSize(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pageSize = n
+}
+
+// SetLatency delays every response by d.
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = d
+}
+
+// FailNext makes the next n requests fail with status.
+func (s *Server) FailNext(n int, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i < n; i++ {
+		s.failures = append(s.failures, status)
+	}
+}
+
+// Requests returns all requests received so far.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// parsePath splits a path like /n/{namespace}/b/{bucket}/o/{object}.
+func parsePath(p string) (namespace, bucket, object string, ok bool) {
+	parts := strings.SplitN(strings.TrimPrefix(p, "/"), "/", 6)
+	if len(parts) < 5 || parts[0] != "n" || parts[2] != "b" || parts[4] != "o" {
+		return "", "", "", false
+	}
+	if len(parts) == 6 {
+		object = parts[5]
+	}
+	return parts[1], parts[3], object, true
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	namespace, bucket, object, ok := parsePath(r.URL.Path)
+	if s.s3Namespace != "" {
+		namespace, bucket, object, ok = s.parseS3Path(r.URL.Path)
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{
+		Method:    r.Method,
+		Namespace: namespace,
+		Bucket:    bucket,
+		Object:    object,
+		Query:     r.URL.Query(),
+	})
+	latency := s.latency
+	var failure int
+	if len(s.failures) > 0 {
+		failure, s.failures = s.failures[0], s.failures[1:]
+	}
+	s.mu.Unlock()
+
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	w.Header().Set("opc-request-id", strconv.FormatInt(time.Now().UnixNano(), 36))
+	switch {
+	case failure != 0:
+		s.writeError(w, failure, "InjectedFailure", "injected failure")
+	case s.s3Namespace != "":
+		s.serveS3(w, r, bucket, object, ok)
+	case !ok:
+		s.writeError(w, http.StatusNotFound, "NotFound", "unknown path "+r.URL.Path)
+	case object == "" && r.Method == http.MethodGet:
+		s.listObjects(w, r, namespace, bucket)
+	case object != "" && (r.Method == http.MethodGet || r.Method == http.MethodHead):
+		s.getObject(w, r, namespace, bucket, object)
+	default:
+		s.writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", r.Method+" is not supported")
+	}
+}
+
+func (s *Server) listObjects(w http.ResponseWriter, r *http.Request, namespace, bucket string) {
+	q := r.URL.Query()
+	prefix, start, end := q.Get("prefix"), q.Get("start"), q.Get("end")
+	fields := q.Get("fields")
+
+	limit := 1000
+	if l := q.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 {
+			s.writeError(w, http.StatusBadRequest, "InvalidParameter", "invalid limit "+l)
+			return
+		}
+		limit = n
+	}
+
+	s.mu.Lock()
+	objects, ok := s.buckets[bucketKey(namespace, bucket)]
+	if !ok {
+		s.mu.Unlock()
+		s.writeError(w, http.StatusNotFound, "BucketNotFound", "bucket "+bucket+" does not exist")
+		return
+	}
+	if s.pageSize < limit {
+		limit = s.pageSize
+	}
+
+	var names []string
+	for name := range objects {
+		if strings.HasPrefix(name, prefix) && name >= start && (end == "" || name < end) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var list listObjects
+	list.Objects = []objectSummary{}
+	for i, name := range names {
+		if i == limit {
+			list.NextStartWith = common.String(name)
+			break
+		}
+
+		o := objects[name]
+		summary := objectSummary{ObjectSummary: objectstorage.ObjectSummary{Name: common.String(o.Name)}}
+		if hasField(fields, "size") {
+			summary.Size = common.Int(len(o.Content))
+		}
+		if hasField(fields, "md5") {
+			summary.Md5 = common.String(o.MD5)
+		}
+		if hasField(fields, "etag") {
+			summary.Etag = o.ETag
+		}
+		if hasField(fields, "timeCreated") {
+			summary.TimeCreated = &common.SDKTime{Time: o.TimeCreated}
+		}
+		if hasField(fields, "storageTier") {
+			summary.StorageTier = o.StorageTier
+		}
+		list.Objects = append(list.Objects, summary)
+	}
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// listObjects is objectstorage.ListObjects with the fields that
+// objectstorage.ObjectSummary of this SDK version is missing.
+type listObjects struct {
+	Objects       []objectSummary `json:"objects"`
+	NextStartWith *string         `json:"nextStartWith,omitempty"`
+}
+
+type objectSummary struct {
+	objectstorage.ObjectSummary
+	Etag        string `json:"etag,omitempty"`
+	StorageTier string `json:"storageTier,omitempty"`
+}
+
+// hasField returns true if field was asked for in fields. Like Object
+// Storage, the name is always returned.
+func hasField(fields, field string) bool {
+	for _, f := range strings.Split(fields, ",") {
+		if strings.TrimSpace(f) == field {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) getObject(w http.ResponseWriter, r *http.Request, namespace, bucket, name string) {
+	s.mu.Lock()
+	objects, ok := s.buckets[bucketKey(namespace, bucket)]
+	if !ok {
+		s.mu.Unlock()
+		s.writeError(w, http.StatusNotFound, "BucketNotFound", "bucket "+bucket+" does not exist")
+		return
+	}
+	o, ok := objects[name]
+	if !ok {
+		s.mu.Unlock()
+		s.writeError(w, http.StatusNotFound, "ObjectNotFound", "object "+name+" does not exist")
+		return
+	}
+	object := *o
+	s.mu.Unlock()
+
+	w.Header().Set("ETag", object.ETag)
+	w.Header().Set("Content-MD5", object.MD5)
+	w.Header().Set("Content-Length", strconv.Itoa(len(object.Content)))
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Last-Modified", object.TimeCreated.Format(http.TimeFormat))
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodGet {
+		w.Write(object.Content)
+	}
+}
+
+func (s *Server) writeError(w http.ResponseWriter, status int, code, message string) {
+	if s.s3Namespace != "" {
+		writeS3Error(w, status, code, message)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"code": code, "message": message})
+}
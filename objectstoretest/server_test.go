@@ -0,0 +1,181 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2017 Oracle and/or its affiliates.  All rights reserved.
+// This program is free software: you can modify it and/or redistribute it
+// under the terms of:
+//
+// (i)  the Universal Permissive License v 1.0 or at your option, any
+//      later version (http://oss.oracle.com/licenses/upl); and/or
+//
+// (ii) the Apache License v 2.0. (http://www.apache.org/licenses/LICENSE-2.0)
+//-----------------------------------------------------------------------------
+
+package objectstoretest
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/oracle/oci-go-sdk/common"
+	"github.com/oracle/oci-go-sdk/objectstorage"
+)
+
+func newClient(t *testing.T, s *Server) objectstorage.ObjectStorageClient {
+	client, err := s.Client()
+	if err != nil {
+		t.Fatalf("Unable to create client: %v", err)
+	}
+	return client
+}
+
+func TestListObjectsPaginates(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	client := newClient(t, s)
+
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		s.PutObject("ns", "bucket", name, []byte(name))
+	}
+	s.SetPageSize(2)
+
+	var names []string
+	start := ""
+	for pages := 1; ; pages++ {
+		res, err := client.ListObjects(context.Background(), objectstorage.ListObjectsRequest{
+			NamespaceName: common.String("ns"),
+			BucketName:    common.String("bucket"),
+			Fields:        "name,md5",
+			Start:         &start,
+		})
+		if err != nil {
+			t.Fatalf("ListObjects failed: %v", err)
+		}
+		for _, o := range res.ListObjects.Objects {
+			if o.Md5 == nil {
+				t.Errorf("Object %s has no md5", *o.Name)
+			}
+			names = append(names, *o.Name)
+		}
+
+		if res.NextStartWith == nil {
+			if pages != 3 {
+				t.Errorf("Expected 3 pages, got %d", pages)
+			}
+			break
+		}
+		start = *res.NextStartWith
+	}
+
+	if len(names) != 5 {
+		t.Errorf("Expected 5 objects, got %v", names)
+	}
+}
+
+func TestListObjectsPrefix(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	client := newClient(t, s)
+
+	s.PutObject("ns", "bucket", "logs/a", nil)
+	s.PutObject("ns", "bucket", "uploads/a.csv", nil)
+
+	res, err := client.ListObjects(context.Background(), objectstorage.ListObjectsRequest{
+		NamespaceName: common.String("ns"),
+		BucketName:    common.String("bucket"),
+		Prefix:        common.String("uploads/"),
+	})
+	if err != nil {
+		t.Fatalf("ListObjects failed: %v", err)
+	}
+	if len(res.ListObjects.Objects) != 1 || *res.ListObjects.Objects[0].Name != "uploads/a.csv" {
+		t.Errorf("Expected only uploads/a.csv, got %v", res.ListObjects.Objects)
+	}
+}
+
+func TestListObjectsUnknownBucket(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	client := newClient(t, s)
+
+	_, err := client.ListObjects(context.Background(), objectstorage.ListObjectsRequest{
+		NamespaceName: common.String("ns"),
+		BucketName:    common.String("missing"),
+	})
+	failure, ok := common.IsServiceError(err)
+	if !ok || failure.GetHTTPStatusCode() != http.StatusNotFound {
+		t.Errorf("Expected a 404 service error, got %v", err)
+	}
+}
+
+func TestGetObject(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	client := newClient(t, s)
+
+	s.PutObject("ns", "bucket", "dir/file.txt", []byte("hello"))
+
+	res, err := client.GetObject(context.Background(), objectstorage.GetObjectRequest{
+		NamespaceName: common.String("ns"),
+		BucketName:    common.String("bucket"),
+		ObjectName:    common.String("dir/file.txt"),
+	})
+	if err != nil {
+		t.Fatalf("GetObject failed: %v", err)
+	}
+	defer res.Content.Close()
+
+	b, err := ioutil.ReadAll(res.Content)
+	if err != nil || string(b) != "hello" {
+		t.Errorf("Expected hello, got %q (%v)", b, err)
+	}
+
+	o, _ := s.Object("ns", "bucket", "dir/file.txt")
+	if res.ETag == nil || *res.ETag != o.ETag {
+		t.Errorf("Expected etag %s, got %v", o.ETag, res.ETag)
+	}
+}
+
+func TestFailNext(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	client := newClient(t, s)
+
+	s.CreateBucket("ns", "bucket")
+	s.FailNext(1, http.StatusServiceUnavailable)
+
+	request := objectstorage.ListObjectsRequest{
+		NamespaceName: common.String("ns"),
+		BucketName:    common.String("bucket"),
+	}
+	if _, err := client.ListObjects(context.Background(), request); err == nil {
+		t.Error("Expected the first request to fail")
+	}
+	if _, err := client.ListObjects(context.Background(), request); err != nil {
+		t.Errorf("Expected the second request to succeed, got %v", err)
+	}
+	if n := len(s.Requests()); n != 2 {
+		t.Errorf("Expected 2 requests, got %d", n)
+	}
+}
+
+func TestLatency(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	client := newClient(t, s)
+
+	s.CreateBucket("ns", "bucket")
+	s.SetLatency(time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := client.ListObjects(ctx, objectstorage.ListObjectsRequest{
+		NamespaceName: common.String("ns"),
+		BucketName:    common.String("bucket"),
+	})
+	if err == nil {
+		t.Error("Expected the request to time out")
+	}
+}
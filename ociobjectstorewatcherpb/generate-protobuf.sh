@@ -31,4 +31,21 @@ $protoc --go_out=plugins=grpc:$ROOT/ociobjectstorewatcherpb \
         --flow_out=$ROOT/ociobjectstorewatcherpb \
         ociobjectstorewatcher.proto
 
+echo "Embedding swagger"
+swagger=ociobjectstorewatcherpb/ociobjectstorewatcher.swagger.json
+if grep -q '`' $swagger; then
+  echo "$swagger contains a backquote, it cannot be embedded" >&2
+  exit 1
+fi
+{
+  echo "// Code generated by generate-protobuf.sh. DO NOT EDIT."
+  echo
+  echo "package ociobjectstorewatcherpb"
+  echo
+  echo "// SwaggerJSON is the OpenAPI v2 spec of the REST API, generated from"
+  echo "// ociobjectstorewatcher.proto."
+  echo "const SwaggerJSON = \`$(cat $swagger)"
+  echo "\`"
+} > ociobjectstorewatcherpb/ociobjectstorewatcher.swagger.go
+
 )
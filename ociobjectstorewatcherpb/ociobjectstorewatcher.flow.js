@@ -6,16 +6,66 @@
 // THIS FILE IS AUTOMATICALLY GENERATED, DO NOT EDIT!
 // ------------------------------------
 
-declare type ActionRequest = {|
-	resourceApplicationId: string;
-	resourceUserId: string;
-	resource: Resource;
+declare type Watch = {|
+	id: string;
+	namespace: string;
+	bucket: string;
+	pollInterval: string;
+	webhookUrl: string;
+	sinks: Array<string>;
+	prefix: string;
+	include: Array<string>;
+	exclude: Array<string>;
+	events: Array<string>;
+	store: string;
+	initialSync: string;
+	initialSyncSince: string;
 |};
 
-declare type ActionResponse = {|
-	success: boolean;
+declare type CreateWatchRequest = {|
+	watch: Watch;
 |};
 
-declare type Resource = {|
-	kind: string;
+declare type GetWatchRequest = {|
+	id: string;
+|};
+
+declare type ListWatchesRequest = {|
+|};
+
+declare type ListWatchesResponse = {|
+	watches: Array<Watch>;
+|};
+
+declare type UpdateWatchRequest = {|
+	id: string;
+	watch: Watch;
+|};
+
+declare type DeleteWatchRequest = {|
+	id: string;
+|};
+
+declare type DeleteWatchResponse = {|
+|};
+
+declare type StreamEventsRequest = {|
+	namespace: string;
+	bucket: string;
+	prefix: string;
+	lastEventId: string;
+|};
+
+declare type Event = {|
+	namespace: string;
+	bucket: string;
+	objectName: string;
+	contentHash: string;
+	type: string;
+	id: string;
+	size: string;
+	etag: string;
+	timeCreated: string;
+	storageTier: string;
+	archivalState: string;
 |};
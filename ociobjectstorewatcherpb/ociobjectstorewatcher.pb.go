@@ -8,9 +8,16 @@ It is generated from these files:
 	ociobjectstorewatcher.proto
 
 It has these top-level messages:
-	ActionRequest
-	ActionResponse
-	Resource
+	Watch
+	CreateWatchRequest
+	GetWatchRequest
+	ListWatchesRequest
+	ListWatchesResponse
+	UpdateWatchRequest
+	DeleteWatchRequest
+	DeleteWatchResponse
+	StreamEventsRequest
+	Event
 */
 package ociobjectstorewatcherpb
 
@@ -35,74 +42,398 @@ var _ = math.Inf
 // proto package needs to be updated.
 const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
 
-type ActionRequest struct {
-	ResourceApplicationId string    `protobuf:"bytes,1,opt,name=resourceApplicationId" json:"resourceApplicationId,omitempty"`
-	ResourceUserId        string    `protobuf:"bytes,2,opt,name=resourceUserId" json:"resourceUserId,omitempty"`
-	Resource              *Resource `protobuf:"bytes,3,opt,name=resource" json:"resource,omitempty"`
+// Watch is a single object store bucket that is polled for changes. Empty
+// fields fall back to the defaults the server was started with.
+type Watch struct {
+	Id        string `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	Namespace string `protobuf:"bytes,2,opt,name=namespace" json:"namespace,omitempty"`
+	Bucket    string `protobuf:"bytes,3,opt,name=bucket" json:"bucket,omitempty"`
+	// pollInterval is a duration such as "30s" or "5m".
+	PollInterval string `protobuf:"bytes,4,opt,name=pollInterval" json:"pollInterval,omitempty"`
+	WebhookUrl   string `protobuf:"bytes,5,opt,name=webhookUrl" json:"webhookUrl,omitempty"`
+	// sinks receive every change in addition to the webhook. A sink is an
+	// http(s) url, "stdout", "file:<path>", "exec:<command> [args...]",
+	// "fn:<app>/<function>" or "fn:<invoke endpoint>".
+	Sinks []string `protobuf:"bytes,6,rep,name=sinks" json:"sinks,omitempty"`
+	// prefix limits the watch to objects whose name starts with it.
+	Prefix string `protobuf:"bytes,7,opt,name=prefix" json:"prefix,omitempty"`
+	// include and exclude are globs, or regular expressions when they start
+	// with "re:". A glob without a slash matches the base name of an object.
+	// Objects have to match one of the include patterns, if there are any,
+	// and none of the exclude patterns.
+	Include []string `protobuf:"bytes,8,rep,name=include" json:"include,omitempty"`
+	Exclude []string `protobuf:"bytes,9,rep,name=exclude" json:"exclude,omitempty"`
+	// events are the types of changes that are sent, all of them if empty.
+	Events []string `protobuf:"bytes,10,rep,name=events" json:"events,omitempty"`
+	// store names the object store the bucket is in, "oci", "s3" or "fs".
+	// The default store of the server is used if empty.
+	Store string `protobuf:"bytes,11,opt,name=store" json:"store,omitempty"`
+	// initialSync decides which objects are sent when the bucket is listed for
+	// the first time: "baseline" records them without sending anything,
+	// "emit-all" sends all of them as NEW and "since" the ones created after
+	// initialSyncSince. The default of the server is used if empty.
+	InitialSync string `protobuf:"bytes,12,opt,name=initialSync" json:"initialSync,omitempty"`
+	// initialSyncSince is an RFC 3339 timestamp such as "2017-10-01T00:00:00Z".
+	InitialSyncSince string `protobuf:"bytes,13,opt,name=initialSyncSince" json:"initialSyncSince,omitempty"`
 }
 
-func (m *ActionRequest) Reset()                    { *m = ActionRequest{} }
-func (m *ActionRequest) String() string            { return proto.CompactTextString(m) }
-func (*ActionRequest) ProtoMessage()               {}
-func (*ActionRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
+func (m *Watch) Reset()                    { *m = Watch{} }
+func (m *Watch) String() string            { return proto.CompactTextString(m) }
+func (*Watch) ProtoMessage()               {}
+func (*Watch) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
 
-func (m *ActionRequest) GetResourceApplicationId() string {
+func (m *Watch) GetId() string {
 	if m != nil {
-		return m.ResourceApplicationId
+		return m.Id
 	}
 	return ""
 }
 
-func (m *ActionRequest) GetResourceUserId() string {
+func (m *Watch) GetNamespace() string {
 	if m != nil {
-		return m.ResourceUserId
+		return m.Namespace
 	}
 	return ""
 }
 
-func (m *ActionRequest) GetResource() *Resource {
+func (m *Watch) GetBucket() string {
 	if m != nil {
-		return m.Resource
+		return m.Bucket
+	}
+	return ""
+}
+
+func (m *Watch) GetPollInterval() string {
+	if m != nil {
+		return m.PollInterval
+	}
+	return ""
+}
+
+func (m *Watch) GetWebhookUrl() string {
+	if m != nil {
+		return m.WebhookUrl
+	}
+	return ""
+}
+
+func (m *Watch) GetSinks() []string {
+	if m != nil {
+		return m.Sinks
+	}
+	return nil
+}
+
+func (m *Watch) GetPrefix() string {
+	if m != nil {
+		return m.Prefix
+	}
+	return ""
+}
+
+func (m *Watch) GetInclude() []string {
+	if m != nil {
+		return m.Include
+	}
+	return nil
+}
+
+func (m *Watch) GetExclude() []string {
+	if m != nil {
+		return m.Exclude
+	}
+	return nil
+}
+
+func (m *Watch) GetEvents() []string {
+	if m != nil {
+		return m.Events
 	}
 	return nil
 }
 
-type ActionResponse struct {
-	Success bool `protobuf:"varint,1,opt,name=success" json:"success,omitempty"`
+func (m *Watch) GetStore() string {
+	if m != nil {
+		return m.Store
+	}
+	return ""
+}
+
+func (m *Watch) GetInitialSync() string {
+	if m != nil {
+		return m.InitialSync
+	}
+	return ""
+}
+
+func (m *Watch) GetInitialSyncSince() string {
+	if m != nil {
+		return m.InitialSyncSince
+	}
+	return ""
+}
+
+type CreateWatchRequest struct {
+	Watch *Watch `protobuf:"bytes,1,opt,name=watch" json:"watch,omitempty"`
+}
+
+func (m *CreateWatchRequest) Reset()                    { *m = CreateWatchRequest{} }
+func (m *CreateWatchRequest) String() string            { return proto.CompactTextString(m) }
+func (*CreateWatchRequest) ProtoMessage()               {}
+func (*CreateWatchRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
+
+func (m *CreateWatchRequest) GetWatch() *Watch {
+	if m != nil {
+		return m.Watch
+	}
+	return nil
+}
+
+type GetWatchRequest struct {
+	Id string `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+}
+
+func (m *GetWatchRequest) Reset()                    { *m = GetWatchRequest{} }
+func (m *GetWatchRequest) String() string            { return proto.CompactTextString(m) }
+func (*GetWatchRequest) ProtoMessage()               {}
+func (*GetWatchRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
+
+func (m *GetWatchRequest) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+type ListWatchesRequest struct {
+}
+
+func (m *ListWatchesRequest) Reset()                    { *m = ListWatchesRequest{} }
+func (m *ListWatchesRequest) String() string            { return proto.CompactTextString(m) }
+func (*ListWatchesRequest) ProtoMessage()               {}
+func (*ListWatchesRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{3} }
+
+type ListWatchesResponse struct {
+	Watches []*Watch `protobuf:"bytes,1,rep,name=watches" json:"watches,omitempty"`
+}
+
+func (m *ListWatchesResponse) Reset()                    { *m = ListWatchesResponse{} }
+func (m *ListWatchesResponse) String() string            { return proto.CompactTextString(m) }
+func (*ListWatchesResponse) ProtoMessage()               {}
+func (*ListWatchesResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{4} }
+
+func (m *ListWatchesResponse) GetWatches() []*Watch {
+	if m != nil {
+		return m.Watches
+	}
+	return nil
+}
+
+type UpdateWatchRequest struct {
+	Id    string `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+	Watch *Watch `protobuf:"bytes,2,opt,name=watch" json:"watch,omitempty"`
+}
+
+func (m *UpdateWatchRequest) Reset()                    { *m = UpdateWatchRequest{} }
+func (m *UpdateWatchRequest) String() string            { return proto.CompactTextString(m) }
+func (*UpdateWatchRequest) ProtoMessage()               {}
+func (*UpdateWatchRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{5} }
+
+func (m *UpdateWatchRequest) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *UpdateWatchRequest) GetWatch() *Watch {
+	if m != nil {
+		return m.Watch
+	}
+	return nil
+}
+
+type DeleteWatchRequest struct {
+	Id string `protobuf:"bytes,1,opt,name=id" json:"id,omitempty"`
+}
+
+func (m *DeleteWatchRequest) Reset()                    { *m = DeleteWatchRequest{} }
+func (m *DeleteWatchRequest) String() string            { return proto.CompactTextString(m) }
+func (*DeleteWatchRequest) ProtoMessage()               {}
+func (*DeleteWatchRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{6} }
+
+func (m *DeleteWatchRequest) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+type DeleteWatchResponse struct {
+}
+
+func (m *DeleteWatchResponse) Reset()                    { *m = DeleteWatchResponse{} }
+func (m *DeleteWatchResponse) String() string            { return proto.CompactTextString(m) }
+func (*DeleteWatchResponse) ProtoMessage()               {}
+func (*DeleteWatchResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{7} }
+
+// StreamEventsRequest filters the events that are streamed. Empty filters
+// match everything.
+type StreamEventsRequest struct {
+	Namespace string `protobuf:"bytes,1,opt,name=namespace" json:"namespace,omitempty"`
+	Bucket    string `protobuf:"bytes,2,opt,name=bucket" json:"bucket,omitempty"`
+	Prefix    string `protobuf:"bytes,3,opt,name=prefix" json:"prefix,omitempty"`
+	// lastEventId is the id of the last event a reconnecting client received.
+	// The recent events after it are sent first.
+	LastEventId string `protobuf:"bytes,4,opt,name=lastEventId" json:"lastEventId,omitempty"`
+}
+
+func (m *StreamEventsRequest) Reset()                    { *m = StreamEventsRequest{} }
+func (m *StreamEventsRequest) String() string            { return proto.CompactTextString(m) }
+func (*StreamEventsRequest) ProtoMessage()               {}
+func (*StreamEventsRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{8} }
+
+func (m *StreamEventsRequest) GetNamespace() string {
+	if m != nil {
+		return m.Namespace
+	}
+	return ""
+}
+
+func (m *StreamEventsRequest) GetBucket() string {
+	if m != nil {
+		return m.Bucket
+	}
+	return ""
+}
+
+func (m *StreamEventsRequest) GetPrefix() string {
+	if m != nil {
+		return m.Prefix
+	}
+	return ""
+}
+
+func (m *StreamEventsRequest) GetLastEventId() string {
+	if m != nil {
+		return m.LastEventId
+	}
+	return ""
+}
+
+// Event is a change to a single object, it is the same as the payload posted
+// to webhooks.
+type Event struct {
+	Namespace   string `protobuf:"bytes,1,opt,name=namespace" json:"namespace,omitempty"`
+	Bucket      string `protobuf:"bytes,2,opt,name=bucket" json:"bucket,omitempty"`
+	ObjectName  string `protobuf:"bytes,3,opt,name=objectName" json:"objectName,omitempty"`
+	ContentHash string `protobuf:"bytes,4,opt,name=contentHash" json:"contentHash,omitempty"`
+	// type is one of NEW, UPDATE or DELETE.
+	Type string `protobuf:"bytes,5,opt,name=type" json:"type,omitempty"`
+	// id identifies the event to resume from, see StreamEventsRequest.
+	Id string `protobuf:"bytes,6,opt,name=id" json:"id,omitempty"`
+	// The metadata of the object, as far as the object store returns it. It
+	// is left empty for deletes. timeCreated is in RFC 3339 format.
+	Size          int64  `protobuf:"varint,7,opt,name=size" json:"size,omitempty"`
+	Etag          string `protobuf:"bytes,8,opt,name=etag" json:"etag,omitempty"`
+	TimeCreated   string `protobuf:"bytes,9,opt,name=timeCreated" json:"timeCreated,omitempty"`
+	StorageTier   string `protobuf:"bytes,10,opt,name=storageTier" json:"storageTier,omitempty"`
+	ArchivalState string `protobuf:"bytes,11,opt,name=archivalState" json:"archivalState,omitempty"`
+}
+
+func (m *Event) Reset()                    { *m = Event{} }
+func (m *Event) String() string            { return proto.CompactTextString(m) }
+func (*Event) ProtoMessage()               {}
+func (*Event) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{9} }
+
+func (m *Event) GetNamespace() string {
+	if m != nil {
+		return m.Namespace
+	}
+	return ""
+}
+
+func (m *Event) GetBucket() string {
+	if m != nil {
+		return m.Bucket
+	}
+	return ""
+}
+
+func (m *Event) GetObjectName() string {
+	if m != nil {
+		return m.ObjectName
+	}
+	return ""
+}
+
+func (m *Event) GetContentHash() string {
+	if m != nil {
+		return m.ContentHash
+	}
+	return ""
 }
 
-func (m *ActionResponse) Reset()                    { *m = ActionResponse{} }
-func (m *ActionResponse) String() string            { return proto.CompactTextString(m) }
-func (*ActionResponse) ProtoMessage()               {}
-func (*ActionResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
+func (m *Event) GetType() string {
+	if m != nil {
+		return m.Type
+	}
+	return ""
+}
 
-func (m *ActionResponse) GetSuccess() bool {
+func (m *Event) GetId() string {
 	if m != nil {
-		return m.Success
+		return m.Id
 	}
-	return false
+	return ""
 }
 
-type Resource struct {
-	Kind string `protobuf:"bytes,1,opt,name=kind" json:"kind,omitempty"`
+func (m *Event) GetSize() int64 {
+	if m != nil {
+		return m.Size
+	}
+	return 0
 }
 
-func (m *Resource) Reset()                    { *m = Resource{} }
-func (m *Resource) String() string            { return proto.CompactTextString(m) }
-func (*Resource) ProtoMessage()               {}
-func (*Resource) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
+func (m *Event) GetEtag() string {
+	if m != nil {
+		return m.Etag
+	}
+	return ""
+}
 
-func (m *Resource) GetKind() string {
+func (m *Event) GetTimeCreated() string {
 	if m != nil {
-		return m.Kind
+		return m.TimeCreated
+	}
+	return ""
+}
+
+func (m *Event) GetStorageTier() string {
+	if m != nil {
+		return m.StorageTier
+	}
+	return ""
+}
+
+func (m *Event) GetArchivalState() string {
+	if m != nil {
+		return m.ArchivalState
 	}
 	return ""
 }
 
 func init() {
-	proto.RegisterType((*ActionRequest)(nil), "ociobjectstorewatcher.ActionRequest")
-	proto.RegisterType((*ActionResponse)(nil), "ociobjectstorewatcher.ActionResponse")
-	proto.RegisterType((*Resource)(nil), "ociobjectstorewatcher.Resource")
+	proto.RegisterType((*Watch)(nil), "ociobjectstorewatcher.Watch")
+	proto.RegisterType((*CreateWatchRequest)(nil), "ociobjectstorewatcher.CreateWatchRequest")
+	proto.RegisterType((*GetWatchRequest)(nil), "ociobjectstorewatcher.GetWatchRequest")
+	proto.RegisterType((*ListWatchesRequest)(nil), "ociobjectstorewatcher.ListWatchesRequest")
+	proto.RegisterType((*ListWatchesResponse)(nil), "ociobjectstorewatcher.ListWatchesResponse")
+	proto.RegisterType((*UpdateWatchRequest)(nil), "ociobjectstorewatcher.UpdateWatchRequest")
+	proto.RegisterType((*DeleteWatchRequest)(nil), "ociobjectstorewatcher.DeleteWatchRequest")
+	proto.RegisterType((*DeleteWatchResponse)(nil), "ociobjectstorewatcher.DeleteWatchResponse")
+	proto.RegisterType((*StreamEventsRequest)(nil), "ociobjectstorewatcher.StreamEventsRequest")
+	proto.RegisterType((*Event)(nil), "ociobjectstorewatcher.Event")
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -116,7 +447,14 @@ const _ = grpc.SupportPackageIsVersion4
 // Client API for OciObjectstoreWatcher service
 
 type OciObjectstoreWatcherClient interface {
-	Action(ctx context.Context, in *ActionRequest, opts ...grpc.CallOption) (*ActionResponse, error)
+	CreateWatch(ctx context.Context, in *CreateWatchRequest, opts ...grpc.CallOption) (*Watch, error)
+	GetWatch(ctx context.Context, in *GetWatchRequest, opts ...grpc.CallOption) (*Watch, error)
+	ListWatches(ctx context.Context, in *ListWatchesRequest, opts ...grpc.CallOption) (*ListWatchesResponse, error)
+	UpdateWatch(ctx context.Context, in *UpdateWatchRequest, opts ...grpc.CallOption) (*Watch, error)
+	DeleteWatch(ctx context.Context, in *DeleteWatchRequest, opts ...grpc.CallOption) (*DeleteWatchResponse, error)
+	// StreamEvents sends every change detected in a watched bucket that
+	// matches the filters of the request, until the client disconnects.
+	StreamEvents(ctx context.Context, in *StreamEventsRequest, opts ...grpc.CallOption) (OciObjectstoreWatcher_StreamEventsClient, error)
 }
 
 type ociObjectstoreWatcherClient struct {
@@ -127,77 +465,297 @@ func NewOciObjectstoreWatcherClient(cc *grpc.ClientConn) OciObjectstoreWatcherCl
 	return &ociObjectstoreWatcherClient{cc}
 }
 
-func (c *ociObjectstoreWatcherClient) Action(ctx context.Context, in *ActionRequest, opts ...grpc.CallOption) (*ActionResponse, error) {
-	out := new(ActionResponse)
-	err := grpc.Invoke(ctx, "/ociobjectstorewatcher.OciObjectstoreWatcher/Action", in, out, c.cc, opts...)
+func (c *ociObjectstoreWatcherClient) CreateWatch(ctx context.Context, in *CreateWatchRequest, opts ...grpc.CallOption) (*Watch, error) {
+	out := new(Watch)
+	err := grpc.Invoke(ctx, "/ociobjectstorewatcher.OciObjectstoreWatcher/CreateWatch", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ociObjectstoreWatcherClient) GetWatch(ctx context.Context, in *GetWatchRequest, opts ...grpc.CallOption) (*Watch, error) {
+	out := new(Watch)
+	err := grpc.Invoke(ctx, "/ociobjectstorewatcher.OciObjectstoreWatcher/GetWatch", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ociObjectstoreWatcherClient) ListWatches(ctx context.Context, in *ListWatchesRequest, opts ...grpc.CallOption) (*ListWatchesResponse, error) {
+	out := new(ListWatchesResponse)
+	err := grpc.Invoke(ctx, "/ociobjectstorewatcher.OciObjectstoreWatcher/ListWatches", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ociObjectstoreWatcherClient) UpdateWatch(ctx context.Context, in *UpdateWatchRequest, opts ...grpc.CallOption) (*Watch, error) {
+	out := new(Watch)
+	err := grpc.Invoke(ctx, "/ociobjectstorewatcher.OciObjectstoreWatcher/UpdateWatch", in, out, c.cc, opts...)
 	if err != nil {
 		return nil, err
 	}
 	return out, nil
 }
 
+func (c *ociObjectstoreWatcherClient) DeleteWatch(ctx context.Context, in *DeleteWatchRequest, opts ...grpc.CallOption) (*DeleteWatchResponse, error) {
+	out := new(DeleteWatchResponse)
+	err := grpc.Invoke(ctx, "/ociobjectstorewatcher.OciObjectstoreWatcher/DeleteWatch", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ociObjectstoreWatcherClient) StreamEvents(ctx context.Context, in *StreamEventsRequest, opts ...grpc.CallOption) (OciObjectstoreWatcher_StreamEventsClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_OciObjectstoreWatcher_serviceDesc.Streams[0], c.cc, "/ociobjectstorewatcher.OciObjectstoreWatcher/StreamEvents", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &ociObjectstoreWatcherStreamEventsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type OciObjectstoreWatcher_StreamEventsClient interface {
+	Recv() (*Event, error)
+	grpc.ClientStream
+}
+
+type ociObjectstoreWatcherStreamEventsClient struct {
+	grpc.ClientStream
+}
+
+func (x *ociObjectstoreWatcherStreamEventsClient) Recv() (*Event, error) {
+	m := new(Event)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // Server API for OciObjectstoreWatcher service
 
 type OciObjectstoreWatcherServer interface {
-	Action(context.Context, *ActionRequest) (*ActionResponse, error)
+	CreateWatch(context.Context, *CreateWatchRequest) (*Watch, error)
+	GetWatch(context.Context, *GetWatchRequest) (*Watch, error)
+	ListWatches(context.Context, *ListWatchesRequest) (*ListWatchesResponse, error)
+	UpdateWatch(context.Context, *UpdateWatchRequest) (*Watch, error)
+	DeleteWatch(context.Context, *DeleteWatchRequest) (*DeleteWatchResponse, error)
+	// StreamEvents sends every change detected in a watched bucket that
+	// matches the filters of the request, until the client disconnects.
+	StreamEvents(*StreamEventsRequest, OciObjectstoreWatcher_StreamEventsServer) error
 }
 
 func RegisterOciObjectstoreWatcherServer(s *grpc.Server, srv OciObjectstoreWatcherServer) {
 	s.RegisterService(&_OciObjectstoreWatcher_serviceDesc, srv)
 }
 
-func _OciObjectstoreWatcher_Action_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(ActionRequest)
+func _OciObjectstoreWatcher_CreateWatch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateWatchRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(OciObjectstoreWatcherServer).Action(ctx, in)
+		return srv.(OciObjectstoreWatcherServer).CreateWatch(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/ociobjectstorewatcher.OciObjectstoreWatcher/Action",
+		FullMethod: "/ociobjectstorewatcher.OciObjectstoreWatcher/CreateWatch",
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(OciObjectstoreWatcherServer).Action(ctx, req.(*ActionRequest))
+		return srv.(OciObjectstoreWatcherServer).CreateWatch(ctx, req.(*CreateWatchRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
+func _OciObjectstoreWatcher_GetWatch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetWatchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OciObjectstoreWatcherServer).GetWatch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ociobjectstorewatcher.OciObjectstoreWatcher/GetWatch",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OciObjectstoreWatcherServer).GetWatch(ctx, req.(*GetWatchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _OciObjectstoreWatcher_ListWatches_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListWatchesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OciObjectstoreWatcherServer).ListWatches(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ociobjectstorewatcher.OciObjectstoreWatcher/ListWatches",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OciObjectstoreWatcherServer).ListWatches(ctx, req.(*ListWatchesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _OciObjectstoreWatcher_UpdateWatch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateWatchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OciObjectstoreWatcherServer).UpdateWatch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ociobjectstorewatcher.OciObjectstoreWatcher/UpdateWatch",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OciObjectstoreWatcherServer).UpdateWatch(ctx, req.(*UpdateWatchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _OciObjectstoreWatcher_DeleteWatch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteWatchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OciObjectstoreWatcherServer).DeleteWatch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/ociobjectstorewatcher.OciObjectstoreWatcher/DeleteWatch",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OciObjectstoreWatcherServer).DeleteWatch(ctx, req.(*DeleteWatchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _OciObjectstoreWatcher_StreamEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamEventsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(OciObjectstoreWatcherServer).StreamEvents(m, &ociObjectstoreWatcherStreamEventsServer{stream})
+}
+
+type OciObjectstoreWatcher_StreamEventsServer interface {
+	Send(*Event) error
+	grpc.ServerStream
+}
+
+type ociObjectstoreWatcherStreamEventsServer struct {
+	grpc.ServerStream
+}
+
+func (x *ociObjectstoreWatcherStreamEventsServer) Send(m *Event) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 var _OciObjectstoreWatcher_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "ociobjectstorewatcher.OciObjectstoreWatcher",
 	HandlerType: (*OciObjectstoreWatcherServer)(nil),
 	Methods: []grpc.MethodDesc{
 		{
-			MethodName: "Action",
-			Handler:    _OciObjectstoreWatcher_Action_Handler,
+			MethodName: "CreateWatch",
+			Handler:    _OciObjectstoreWatcher_CreateWatch_Handler,
+		},
+		{
+			MethodName: "GetWatch",
+			Handler:    _OciObjectstoreWatcher_GetWatch_Handler,
+		},
+		{
+			MethodName: "ListWatches",
+			Handler:    _OciObjectstoreWatcher_ListWatches_Handler,
+		},
+		{
+			MethodName: "UpdateWatch",
+			Handler:    _OciObjectstoreWatcher_UpdateWatch_Handler,
+		},
+		{
+			MethodName: "DeleteWatch",
+			Handler:    _OciObjectstoreWatcher_DeleteWatch_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamEvents",
+			Handler:       _OciObjectstoreWatcher_StreamEvents_Handler,
+			ServerStreams: true,
 		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "ociobjectstorewatcher.proto",
 }
 
 func init() { proto.RegisterFile("ociobjectstorewatcher.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 299 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0x92, 0xce, 0x4f, 0xce, 0xcc,
-	0x4f, 0xca, 0x4a, 0x4d, 0x2e, 0x29, 0x2e, 0xc9, 0x2f, 0x4a, 0x2d, 0x4f, 0x2c, 0x49, 0xce, 0x48,
-	0x2d, 0xd2, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0x12, 0xc5, 0x2a, 0x29, 0x25, 0x93, 0x9e, 0x9f,
-	0x9f, 0x9e, 0x93, 0xaa, 0x9f, 0x58, 0x90, 0xa9, 0x9f, 0x98, 0x97, 0x97, 0x5f, 0x92, 0x58, 0x92,
-	0x99, 0x9f, 0x57, 0x0c, 0xd1, 0xa4, 0xb4, 0x8a, 0x91, 0x8b, 0xd7, 0x31, 0x19, 0x24, 0x12, 0x94,
-	0x5a, 0x58, 0x9a, 0x5a, 0x5c, 0x22, 0x64, 0xc2, 0x25, 0x5a, 0x94, 0x5a, 0x9c, 0x5f, 0x5a, 0x94,
-	0x9c, 0xea, 0x58, 0x50, 0x90, 0x93, 0x99, 0x0c, 0x56, 0xef, 0x99, 0x22, 0xc1, 0xa8, 0xc0, 0xa8,
-	0xc1, 0x19, 0x84, 0x5d, 0x52, 0x48, 0x8d, 0x8b, 0x0f, 0x26, 0x11, 0x5a, 0x9c, 0x5a, 0xe4, 0x99,
-	0x22, 0xc1, 0x04, 0x56, 0x8e, 0x26, 0x2a, 0x64, 0xcd, 0xc5, 0x01, 0x13, 0x91, 0x60, 0x56, 0x60,
-	0xd4, 0xe0, 0x36, 0x92, 0xd7, 0xc3, 0xee, 0xa9, 0x20, 0xa8, 0xb2, 0x20, 0xb8, 0x06, 0x25, 0x2d,
-	0x2e, 0x3e, 0x98, 0x5b, 0x8b, 0x0b, 0xf2, 0xf3, 0x8a, 0x53, 0x85, 0x24, 0xb8, 0xd8, 0x8b, 0x4b,
-	0x93, 0x93, 0x53, 0x8b, 0x8b, 0xc1, 0xce, 0xe3, 0x08, 0x82, 0x71, 0x95, 0xe4, 0xb8, 0x38, 0x60,
-	0x26, 0x08, 0x09, 0x71, 0xb1, 0x64, 0x67, 0xe6, 0xc1, 0x7c, 0x00, 0x66, 0x1b, 0x2d, 0x62, 0xe4,
-	0x12, 0xf5, 0x4f, 0xce, 0xf4, 0x47, 0x58, 0x1c, 0x0e, 0xb1, 0x58, 0xa8, 0x83, 0x91, 0x8b, 0x0d,
-	0x62, 0x8d, 0x90, 0x0a, 0x0e, 0xb7, 0xa1, 0x84, 0x98, 0x94, 0x2a, 0x01, 0x55, 0x10, 0xb7, 0x2a,
-	0x19, 0x36, 0x5d, 0x7e, 0x32, 0x99, 0x49, 0x5b, 0x49, 0x0d, 0x1c, 0x15, 0x65, 0xc6, 0xfa, 0xf9,
-	0xc9, 0x99, 0xba, 0x48, 0xda, 0x74, 0xa1, 0xfa, 0xf4, 0x13, 0xc1, 0xfa, 0xac, 0x18, 0xb5, 0x9c,
-	0x24, 0xa3, 0xc4, 0xb1, 0x1a, 0x5d, 0x90, 0x94, 0xc4, 0x06, 0x8e, 0x3f, 0x63, 0x40, 0x00, 0x00,
-	0x00, 0xff, 0xff, 0x58, 0x46, 0x60, 0xba, 0x13, 0x02, 0x00, 0x00,
+	// 772 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x9c, 0x56, 0xcd, 0x4e, 0x1b, 0x49,
+	0x10, 0xd6, 0x8c, 0xb1, 0x8d, 0x6b, 0x60, 0x77, 0xd5, 0xc0, 0x6e, 0xaf, 0x17, 0x21, 0xef, 0x08,
+	0xb1, 0x60, 0x2d, 0x36, 0x82, 0x5d, 0x0e, 0xc9, 0x2d, 0x3f, 0x0a, 0x48, 0x49, 0x90, 0xec, 0xa0,
+	0x44, 0xb9, 0xb5, 0xc7, 0x15, 0xbb, 0xc3, 0x78, 0x66, 0x32, 0xdd, 0x18, 0x48, 0x94, 0x4b, 0xa4,
+	0x44, 0x4a, 0x0e, 0xb9, 0xa0, 0x5c, 0xf2, 0x1e, 0x79, 0x92, 0xbc, 0x42, 0xee, 0x79, 0x85, 0x68,
+	0xba, 0xc7, 0x30, 0x63, 0x7b, 0xb0, 0xc9, 0x89, 0xa9, 0xaf, 0xbe, 0xee, 0xaa, 0xae, 0xfa, 0xaa,
+	0x30, 0xfc, 0xe5, 0x3b, 0xdc, 0x6f, 0x3d, 0x47, 0x47, 0x0a, 0xe9, 0x87, 0x78, 0xc2, 0xa4, 0xd3,
+	0xc5, 0xb0, 0x16, 0x84, 0xbe, 0xf4, 0xc9, 0xd2, 0x58, 0x67, 0x79, 0xb9, 0xe3, 0xfb, 0x1d, 0x17,
+	0xeb, 0x2c, 0xe0, 0x75, 0xe6, 0x79, 0xbe, 0x64, 0x92, 0xfb, 0x9e, 0xd0, 0x87, 0xec, 0xef, 0x26,
+	0xe4, 0x1f, 0x47, 0x4c, 0xf2, 0x0b, 0x98, 0xbc, 0x4d, 0x8d, 0x8a, 0xb1, 0x5e, 0x6a, 0x98, 0xbc,
+	0x4d, 0x96, 0xa1, 0xe4, 0xb1, 0x1e, 0x8a, 0x80, 0x39, 0x48, 0x4d, 0x05, 0x5f, 0x02, 0xe4, 0x77,
+	0x28, 0xb4, 0x8e, 0x9d, 0x23, 0x94, 0x34, 0xa7, 0x5c, 0xb1, 0x45, 0x6c, 0x98, 0x0b, 0x7c, 0xd7,
+	0xdd, 0xf7, 0x24, 0x86, 0x7d, 0xe6, 0xd2, 0x19, 0xe5, 0x4d, 0x61, 0x64, 0x05, 0xe0, 0x04, 0x5b,
+	0x5d, 0xdf, 0x3f, 0x3a, 0x0c, 0x5d, 0x9a, 0x57, 0x8c, 0x04, 0x42, 0x16, 0x21, 0x2f, 0xb8, 0x77,
+	0x24, 0x68, 0xa1, 0x92, 0x5b, 0x2f, 0x35, 0xb4, 0x11, 0x45, 0x0c, 0x42, 0x7c, 0xc6, 0x4f, 0x69,
+	0x51, 0x47, 0xd4, 0x16, 0xa1, 0x50, 0xe4, 0x9e, 0xe3, 0x1e, 0xb7, 0x91, 0xce, 0x2a, 0xfe, 0xc0,
+	0x8c, 0x3c, 0x78, 0xaa, 0x3d, 0x25, 0xed, 0x89, 0xcd, 0xe8, 0x2e, 0xec, 0xa3, 0x27, 0x05, 0x05,
+	0xe5, 0x88, 0x2d, 0x15, 0x39, 0xaa, 0x1d, 0xb5, 0x54, 0x08, 0x6d, 0x90, 0x0a, 0x58, 0xdc, 0xe3,
+	0x92, 0x33, 0xb7, 0x79, 0xe6, 0x39, 0x74, 0x4e, 0xf9, 0x92, 0x10, 0xa9, 0xc2, 0x6f, 0x09, 0xb3,
+	0xc9, 0x3d, 0x07, 0xe9, 0xbc, 0xa2, 0x8d, 0xe0, 0xf6, 0x1e, 0x90, 0xdb, 0x21, 0x32, 0x89, 0xaa,
+	0xec, 0x0d, 0x7c, 0x71, 0x8c, 0x42, 0x92, 0x6d, 0xc8, 0xab, 0x86, 0xa9, 0x06, 0x58, 0xdb, 0xcb,
+	0xb5, 0xf1, 0x9d, 0xd6, 0x67, 0x34, 0xd5, 0xfe, 0x1b, 0x7e, 0xbd, 0x87, 0x32, 0x75, 0xcd, 0x50,
+	0x13, 0xed, 0x45, 0x20, 0xf7, 0xb9, 0xd0, 0x1c, 0x14, 0x31, 0xcb, 0x7e, 0x00, 0x0b, 0x29, 0x54,
+	0x04, 0xbe, 0x27, 0x90, 0xec, 0x42, 0x51, 0xc7, 0x11, 0xd4, 0xa8, 0xe4, 0x26, 0x66, 0x31, 0x20,
+	0xdb, 0x4f, 0x80, 0x1c, 0x06, 0xed, 0xe1, 0x17, 0x0d, 0xeb, 0xe9, 0xe2, 0x85, 0xe6, 0xf4, 0x2f,
+	0x5c, 0x05, 0x72, 0x07, 0x5d, 0xbc, 0xfa, 0x66, 0x7b, 0x09, 0x16, 0x52, 0x2c, 0xfd, 0x1c, 0xfb,
+	0xad, 0x01, 0x0b, 0x4d, 0x19, 0x22, 0xeb, 0xdd, 0x55, 0xdd, 0x1d, 0x1c, 0x4f, 0x09, 0xdb, 0xc8,
+	0x16, 0xb6, 0x99, 0x12, 0xf6, 0xa5, 0xfc, 0x72, 0x29, 0xf9, 0x55, 0xc0, 0x72, 0x99, 0x90, 0x2a,
+	0xc4, 0x7e, 0x3b, 0xd6, 0x7b, 0x12, 0xb2, 0xbf, 0x98, 0x90, 0x57, 0xdf, 0x3f, 0x19, 0x79, 0x05,
+	0x40, 0xd7, 0xe9, 0x21, 0xeb, 0x61, 0x1c, 0x3d, 0x81, 0x44, 0x19, 0x38, 0xbe, 0x27, 0xd1, 0x93,
+	0x7b, 0x4c, 0x74, 0x07, 0x19, 0x24, 0x20, 0x42, 0x60, 0x46, 0x9e, 0x05, 0x18, 0x8f, 0x9a, 0xfa,
+	0x8e, 0x8b, 0x58, 0xb8, 0x68, 0x0f, 0x81, 0x19, 0xc1, 0x5f, 0xa2, 0x1a, 0xae, 0x5c, 0x43, 0x7d,
+	0x47, 0x18, 0x4a, 0xd6, 0xa1, 0xb3, 0xfa, 0x5c, 0xf4, 0x1d, 0x45, 0x93, 0xbc, 0x87, 0x5a, 0xc2,
+	0x6d, 0x5a, 0xd2, 0xd1, 0x12, 0x50, 0xc4, 0x88, 0x3a, 0xca, 0x3a, 0xf8, 0x88, 0x63, 0x48, 0x41,
+	0x33, 0x12, 0x10, 0x59, 0x85, 0x79, 0x16, 0x3a, 0x5d, 0xde, 0x67, 0x6e, 0x53, 0x32, 0x39, 0x18,
+	0xb7, 0x34, 0xb8, 0xfd, 0xbe, 0x08, 0x4b, 0x07, 0x0e, 0x3f, 0xb8, 0xd4, 0x88, 0x16, 0x6c, 0x48,
+	0x3e, 0x1a, 0x60, 0x25, 0x66, 0x88, 0x6c, 0x64, 0x68, 0x69, 0x74, 0xce, 0xca, 0x57, 0xca, 0xce,
+	0xde, 0x7d, 0xf3, 0xf5, 0xdb, 0xb9, 0xb9, 0x65, 0xff, 0xa3, 0xb6, 0x65, 0x7f, 0xa7, 0xee, 0x3b,
+	0x7c, 0x33, 0xc1, 0xde, 0x8c, 0xe9, 0x75, 0xfd, 0x57, 0xdc, 0xd0, 0x3a, 0x25, 0xef, 0x0c, 0x98,
+	0x1d, 0x8c, 0x22, 0x59, 0xcb, 0x08, 0x31, 0x34, 0xab, 0x13, 0x52, 0xf9, 0x4f, 0xa5, 0x52, 0x23,
+	0xff, 0x4e, 0x99, 0x4a, 0xfd, 0x15, 0x6f, 0xbf, 0x26, 0x9f, 0x0c, 0xb0, 0x12, 0xa3, 0x9d, 0x59,
+	0x99, 0xd1, 0xa5, 0x50, 0xae, 0x4e, 0x43, 0x8d, 0x47, 0xab, 0xae, 0x92, 0xdb, 0x20, 0xd3, 0xd6,
+	0x89, 0x9c, 0x1b, 0x60, 0x25, 0x76, 0x44, 0x66, 0x5e, 0xa3, 0x7b, 0x64, 0x42, 0x99, 0x6e, 0xaa,
+	0x4c, 0xfe, 0x2f, 0x5f, 0xab, 0x4c, 0x83, 0xb6, 0x7d, 0x36, 0xc0, 0x4a, 0x6c, 0x8e, 0xcc, 0xac,
+	0x46, 0x77, 0x50, 0xb9, 0x3a, 0x0d, 0x35, 0xae, 0x56, 0xdc, 0xca, 0xea, 0xf5, 0x5a, 0xf9, 0xc1,
+	0x80, 0xb9, 0xe4, 0xfa, 0x22, 0x59, 0x21, 0xc7, 0xec, 0xb8, 0xcc, 0xa2, 0x29, 0x96, 0x5d, 0x53,
+	0x09, 0xad, 0x93, 0xb5, 0x49, 0x09, 0xe9, 0x7f, 0x8b, 0x5b, 0xc6, 0xad, 0x3f, 0x9f, 0xfe, 0x31,
+	0xf6, 0xc2, 0xa0, 0xd5, 0x2a, 0xa8, 0x1f, 0x12, 0x3b, 0x3f, 0x06, 0x00, 0xf8, 0xdc, 0x2d, 0x8a,
+	0x9c, 0x08, 0x00, 0x00,
 }
@@ -19,14 +19,17 @@ import (
 	"net/url"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"regexp"
 	"syscall"
 	"time"
 
-	"github.com/oracle/oci-go-sdk/common/auth"
+	"github.com/oracle/oci-go-sdk/common"
 	obstore "github.com/oracle/oci-go-sdk/objectstorage"
 
 	"github.com/fnproject/oci-objectstore-watcher/ociobjectstorewatcherpb"
 	"github.com/fnproject/oci-objectstore-watcher/server"
+	"github.com/fnproject/oci-objectstore-watcher/state"
 	grpc_prometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
 	grpcmw "github.com/mwitkow/go-grpc-middleware"
 	"github.com/pkg/errors"
@@ -36,6 +39,7 @@ import (
 	"github.com/wercker/pkg/log"
 	"github.com/wercker/pkg/trace"
 	"google.golang.org/grpc"
+	"gopkg.in/mgo.v2"
 	cli "gopkg.in/urfave/cli.v1"
 )
 
@@ -46,6 +50,20 @@ var serverCommand = cli.Command{
 	Flags:  append(serverFlags, conf.TraceFlags()...),
 }
 
+// The object stores watches can select with their store field.
+const (
+	storeOCI = "oci"
+	storeS3  = "s3"
+	storeFS  = "fs"
+)
+
+// The stores the state of watches can be kept in.
+const (
+	stateStoreFile  = "file"
+	stateStoreBolt  = "bolt"
+	stateStoreMongo = "mongo"
+)
+
 var serverFlags = []cli.Flag{
 	cli.IntFlag{
 		Name:   "port",
@@ -62,27 +80,238 @@ var serverFlags = []cli.Flag{
 		Value:  43406,
 		EnvVar: "METRICS_PORT",
 	},
+	cli.StringFlag{
+		Name:   "config",
+		Usage:  "YAML or JSON file with the watches to start on startup",
+		EnvVar: "WATCHER_CONFIG",
+	},
+	cli.StringFlag{
+		Name:   "config-reload-interval",
+		Usage:  "How often the config file is checked for changes, 0 to only reload on SIGHUP",
+		Value:  "10s",
+		EnvVar: "WATCHER_CONFIG_RELOAD_INTERVAL",
+	},
+	cli.StringFlag{
+		Name:   "store",
+		Usage:  "Default object store of watches: oci, s3 for an S3 compatible store configured with the s3 flags, or fs for the local directory of fs-root",
+		Value:  storeOCI,
+		EnvVar: "OBJECTSTORE_STORE",
+	},
+	cli.StringFlag{
+		Name:   "auth",
+		Usage:  "Object store authentication: instance-principal, resource-principal, config-file or api-key",
+		Value:  authInstancePrincipal,
+		EnvVar: "OCI_AUTH",
+	},
+	cli.StringFlag{
+		Name:   "oci-config",
+		Usage:  "OCI config file used by config-file authentication",
+		Value:  "~/.oci/config",
+		EnvVar: "OCI_CONFIG_FILE",
+	},
+	cli.StringFlag{
+		Name:   "oci-profile",
+		Usage:  "Profile of the OCI config file used by config-file authentication",
+		Value:  "DEFAULT",
+		EnvVar: "OCI_CONFIG_PROFILE",
+	},
+	cli.StringFlag{
+		Name:   "oci-tenancy",
+		Usage:  "Tenancy OCID used by api-key authentication",
+		EnvVar: "OCI_TENANCY",
+	},
+	cli.StringFlag{
+		Name:   "oci-user",
+		Usage:  "User OCID used by api-key authentication",
+		EnvVar: "OCI_USER",
+	},
+	cli.StringFlag{
+		Name:   "oci-fingerprint",
+		Usage:  "Fingerprint of the API key used by api-key authentication",
+		EnvVar: "OCI_FINGERPRINT",
+	},
+	cli.StringFlag{
+		Name:   "oci-key-file",
+		Usage:  "PEM file with the private API key used by api-key authentication",
+		EnvVar: "OCI_KEY_FILE",
+	},
+	cli.StringFlag{
+		Name:   "oci-key-passphrase",
+		Usage:  "Passphrase of the private key used by config-file and api-key authentication",
+		EnvVar: "OCI_KEY_PASSPHRASE",
+	},
+	cli.StringFlag{
+		Name:   "oci-region",
+		Usage:  "Region used by api-key authentication, defaults to region",
+		EnvVar: "OCI_REGION",
+	},
+	cli.StringFlag{
+		Name:   "region",
+		Usage:  "Object store region, overrides the region of the authentication",
+		EnvVar: "OBJECTSTORE_REGION",
+	},
+	cli.StringFlag{
+		Name:   "endpoint",
+		Usage:  "Object store endpoint, such as http://localhost:8080 for a local stand-in. Overrides region",
+		EnvVar: "OBJECTSTORE_ENDPOINT",
+	},
+	cli.StringFlag{
+		Name:   "s3-endpoint",
+		Usage:  "S3 compatible endpoint, such as https://<namespace>.compat.objectstorage.<region>.oraclecloud.com or a MinIO server. Enables the s3 store",
+		EnvVar: "S3_ENDPOINT",
+	},
+	cli.StringFlag{
+		Name:   "s3-region",
+		Usage:  "Region used to sign S3 requests, the OCI region for the OCI compatibility endpoint",
+		Value:  server.DefaultS3Region,
+		EnvVar: "S3_REGION",
+	},
+	cli.StringFlag{
+		Name:   "s3-access-key",
+		Usage:  "Access key of the s3 store",
+		EnvVar: "S3_ACCESS_KEY,AWS_ACCESS_KEY_ID",
+	},
+	cli.StringFlag{
+		Name:   "s3-secret-key",
+		Usage:  "Secret key of the s3 store",
+		EnvVar: "S3_SECRET_KEY,AWS_SECRET_ACCESS_KEY",
+	},
+	cli.StringFlag{
+		Name:   "fs-root",
+		Usage:  "Local directory whose directories are watched as buckets, for development and testing. Enables the fs store",
+		EnvVar: "OBJECTSTORE_FS_ROOT",
+	},
+	cli.StringFlag{
+		Name:   "state-store",
+		Usage:  "Where the object caches, undelivered changes and change history of watches are kept: bolt for a database in data-dir, mongo for the database of mongodb-uri, or file for a file per watch in the working directory without history",
+		Value:  stateStoreBolt,
+		EnvVar: "WATCHER_STATE_STORE",
+	},
+	cli.StringFlag{
+		Name:   "data-dir",
+		Usage:  "Directory of the bolt state store",
+		Value:  "/var/lib/oci-objectstore-watcher",
+		EnvVar: "WATCHER_DATA_DIR",
+	},
+	cli.StringFlag{
+		Name:   "legacy-snapshot-dir",
+		Usage:  "Directory of the snapshot files of the file state-store, watches without a snapshot in the bolt or mongo state store continue from their file in it. Empty to start them without a snapshot",
+		EnvVar: "WATCHER_LEGACY_SNAPSHOT_DIR",
+	},
+	cli.StringFlag{
+		Name:   "history-retention",
+		Usage:  "How long changes are kept in the change history of the bolt and mongo state stores, 0 to keep them forever",
+		Value:  "168h",
+		EnvVar: "WATCHER_HISTORY_RETENTION",
+	},
+	cli.StringFlag{
+		Name:   "mongodb-uri",
+		Usage:  "Connection string of the mongo state store",
+		EnvVar: "MONGODB_URI",
+	},
 	cli.StringSliceFlag{
 		Name:   "buckets",
-		Usage:  "Object store buckets to watch",
+		Usage:  "Object store buckets to watch on startup, more can be added through the API",
 		EnvVar: "OBJECTSTORE_BUCKETS",
 	},
+	cli.StringFlag{
+		Name:   "prefix",
+		Usage:  "Only watch objects starting with this prefix in the buckets from the flags",
+		EnvVar: "OBJECTSTORE_PREFIX",
+	},
+	cli.StringSliceFlag{
+		Name:   "include",
+		Usage:  "Only watch objects matching one of these globs, or regexps prefixed with re:, in the buckets from the flags",
+		EnvVar: "OBJECTSTORE_INCLUDE",
+	},
+	cli.StringSliceFlag{
+		Name:   "exclude",
+		Usage:  "Ignore objects matching any of these globs, or regexps prefixed with re:, in the buckets from the flags",
+		EnvVar: "OBJECTSTORE_EXCLUDE",
+	},
 	cli.StringFlag{
 		Name:   "namespace",
-		Usage:  "Object store namespace",
+		Usage:  "Default object store namespace of watches",
 		EnvVar: "OBJECTSTORE_NAMESPACE",
 	},
 	cli.StringFlag{
 		Name:   "poll-interval",
-		Usage:  "Polling interval to check bucket changes",
+		Usage:  "Default polling interval to check bucket changes",
 		Value:  "30s",
 		EnvVar: "OBJECTSTORE_POLL_INTERVAL",
 	},
+	cli.StringFlag{
+		Name:   "initial-sync",
+		Usage:  "Default of what is sent when a bucket is listed for the first time: baseline records the objects silently, emit-all sends all of them as NEW, since sends the ones created after initial-sync-since",
+		Value:  server.SyncEmitAll,
+		EnvVar: "WATCHER_INITIAL_SYNC",
+	},
+	cli.StringFlag{
+		Name:   "initial-sync-since",
+		Usage:  "RFC 3339 timestamp of the since initial sync, such as 2017-10-01T00:00:00Z",
+		EnvVar: "WATCHER_INITIAL_SYNC_SINCE",
+	},
 	cli.StringFlag{
 		Name:   "webhook-url",
-		Usage:  "Webhook callback url at which changes are notified",
+		Usage:  "Default webhook callback url at which changes are notified",
 		EnvVar: "WEBHOOK_URL",
 	},
+	cli.StringSliceFlag{
+		Name:   "sink",
+		Usage:  "Default sink that receives changes, an http(s) url, stdout, file:<path>, exec:<command> [args...], fn:<app>/<function> or fn:<invoke endpoint>. Can be repeated",
+		EnvVar: "SINKS",
+	},
+	cli.BoolFlag{
+		Name:   "api-local-sinks",
+		Usage:  "Allow watches created or updated through the API to use the stdout, file and exec sinks, which write to and run commands on this host",
+		EnvVar: "WATCHER_API_LOCAL_SINKS",
+	},
+	cli.StringFlag{
+		Name:   "fn-api-url",
+		Usage:  "Fn API used to look up the functions of fn sinks by app and function name",
+		EnvVar: "FN_API_URL",
+	},
+	cli.IntFlag{
+		Name:   "webhook-retries",
+		Usage:  "Number of times a failed webhook call is retried",
+		Value:  server.DefaultDeliveryOptions.Retries,
+		EnvVar: "WEBHOOK_RETRIES",
+	},
+	cli.StringFlag{
+		Name:   "webhook-backoff",
+		Usage:  "Wait before the first retry of a webhook call, doubles for every next retry",
+		Value:  server.DefaultDeliveryOptions.InitialBackoff.String(),
+		EnvVar: "WEBHOOK_BACKOFF",
+	},
+	cli.StringFlag{
+		Name:   "webhook-max-backoff",
+		Usage:  "Maximum wait between retries of a webhook call",
+		Value:  server.DefaultDeliveryOptions.MaxBackoff.String(),
+		EnvVar: "WEBHOOK_MAX_BACKOFF",
+	},
+	cli.StringFlag{
+		Name:   "webhook-timeout",
+		Usage:  "Timeout of a single webhook call",
+		Value:  server.DefaultDeliveryOptions.Timeout.String(),
+		EnvVar: "WEBHOOK_TIMEOUT",
+	},
+	cli.IntFlag{
+		Name:   "delivery-attempts",
+		Usage:  "Number of times a change is handed to a sink before it is dropped, webhook calls are retried within every attempt. 0 to never drop changes",
+		Value:  server.DefaultDeliveryOptions.Attempts,
+		EnvVar: "WATCHER_DELIVERY_ATTEMPTS",
+	},
+	cli.StringFlag{
+		Name:   "webhook-secret",
+		Usage:  "Shared secret used to sign webhook calls with HMAC-SHA256",
+		EnvVar: "WEBHOOK_SECRET",
+	},
+	cli.StringFlag{
+		Name:   "webhook-format",
+		Usage:  "Format of webhook calls: json, cloudevents (structured mode) or cloudevents-binary",
+		Value:  string(server.FormatJSON),
+		EnvVar: "WEBHOOK_FORMAT",
+	},
 }
 
 var serverAction = func(c *cli.Context) error {
@@ -103,23 +332,71 @@ var serverAction = func(c *cli.Context) error {
 		return errorExitCode
 	}
 
-	cfgProvider, err := auth.InstancePrincipalConfigurationProvider()
-	if err != nil {
-		log.WithError(err).Error("Unable to get a Instance Principal Config Provider")
-		return errorExitCode
+	stores := make(map[string]server.ObjectStore)
+	if o.Store == storeOCI {
+		log.WithField("auth", o.Auth.Mode).Info("Authenticating against the object store")
+		cfgProvider, err := configurationProvider(o.Auth)
+		if err != nil {
+			log.WithField("auth", o.Auth.Mode).WithError(err).Error("Unable to get a Config Provider")
+			return errorExitCode
+		}
+		client, err := newObjectStorageClient(cfgProvider, o.Region, o.Endpoint)
+		if err != nil {
+			log.WithError(err).Error("Unable to connect to object store")
+			return errorExitCode
+		}
+		log.WithField("host", client.Host).Info("Using object store endpoint")
+		stores[storeOCI] = server.NewOCIObjectStore(client)
 	}
-	client, err := obstore.NewObjectStorageClientWithConfigurationProvider(cfgProvider)
-	if err != nil {
-		log.WithError(err).Error("Unable to connect to object store")
-		return errorExitCode
+	if o.S3.Endpoint != "" {
+		s3, err := server.NewS3ObjectStore(o.S3)
+		if err != nil {
+			log.WithError(err).Error("Unable to create s3 store")
+			return errorExitCode
+		}
+		log.WithField("host", o.S3.Endpoint).Info("Using s3 endpoint")
+		stores[storeS3] = s3
+	}
+	if o.FSRoot != "" {
+		fs, err := server.NewFileObjectStore(o.FSRoot)
+		if err != nil {
+			log.WithError(err).Error("Unable to create fs store")
+			return errorExitCode
+		}
+		log.WithField("root", o.FSRoot).Info("Using local directory as object store")
+		stores[storeFS] = fs
+	}
+
+	watcher := server.NewObjectWatcher(stores[o.Store], o.defaults(), o.Delivery)
+	for name, store := range stores {
+		watcher.AddStore(name, store)
+	}
+
+	if o.StateStore != stateStoreFile {
+		store, err := openStateStore(o)
+		if err != nil {
+			log.WithField("state-store", o.StateStore).WithError(err).Error("Unable to open the state store")
+			return errorExitCode
+		}
+		store = state.NewMetricsStore(store)
+		store = state.NewTraceStore(store, tracer)
+		defer store.Close()
+
+		if err := store.Initialize(); err != nil {
+			log.WithField("state-store", o.StateStore).WithError(err).Error("Unable to initialize the state store")
+			return errorExitCode
+		}
+		healthService.RegisterProbe(o.StateStore, store)
+		watcher.SetStateStore(store, o.LegacySnapshotDir)
 	}
 
 	log.Debug("Creating server")
-	srv, err := server.New(client)
+	srv, err := server.New(watcher)
 	if err != nil {
 		log.WithError(err).Error("Unable to create server")
 		return errorExitCode
 	}
+	srv.AllowLocalSinks = o.APILocalSinks
 
 	// The following interceptors will be called in order (ie. top to bottom)
 	interceptors := []grpc.UnaryServerInterceptor{
@@ -127,7 +404,14 @@ var serverAction = func(c *cli.Context) error {
 		grpc_prometheus.UnaryServerInterceptor, // prometheus
 	}
 
-	s := grpc.NewServer(grpcmw.WithUnaryServerChain(interceptors...))
+	streamInterceptors := []grpc.StreamServerInterceptor{
+		grpc_prometheus.StreamServerInterceptor, // prometheus
+	}
+
+	s := grpc.NewServer(
+		grpcmw.WithUnaryServerChain(interceptors...),
+		grpcmw.WithStreamServerChain(streamInterceptors...),
+	)
 	ociobjectstorewatcherpb.RegisterOciObjectstoreWatcherServer(s, srv)
 	grpc_prometheus.EnableHandlingTimeHistogram()
 	grpc_prometheus.Register(s)
@@ -138,13 +422,6 @@ var serverAction = func(c *cli.Context) error {
 		return errorExitCode
 	}
 
-	watcher := server.ObjectWatcher{
-		Namespace:    o.Namespace,
-		Buckets:      o.Buckets,
-		WebhookURI:   o.WebHookURL,
-		PollInterval: o.BucketPollInterval,
-	}
-
 	errc := make(chan error, 4)
 
 	// Shutdown on SIGINT, SIGTERM
@@ -175,11 +452,34 @@ var serverAction = func(c *cli.Context) error {
 		errc <- http.ListenAndServe(fmt.Sprintf(":%d", o.MetricsPort), nil)
 	}()
 
-	// Start watching object store buckets
-	go func() {
-		log.Info("Start watching buckets")
-		watcher.Watch(client)
-	}()
+	// Start the watches from the config file and the buckets from the flags
+	log.Info("Start watching buckets")
+	if o.Config != "" {
+		reloader := server.NewConfigReloader(watcher, o.Config, o.defaults())
+		if err := reloader.Apply(o.Watches); err != nil {
+			log.WithField("config", o.Config).WithError(err).Error("Unable to watch buckets from config")
+			return errorExitCode
+		}
+
+		// Reload on SIGHUP or when the config file changes
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		stop := make(chan struct{})
+		defer close(stop)
+		go reloader.Run(hup, o.ConfigReloadInterval, stop)
+	}
+	for _, bucket := range o.Buckets {
+		_, err := watcher.Add(server.Watch{
+			Bucket:  bucket,
+			Prefix:  o.Prefix,
+			Include: o.Include,
+			Exclude: o.Exclude,
+		})
+		if err != nil {
+			log.WithField("bucket", bucket).WithError(err).Error("Unable to watch bucket")
+			return errorExitCode
+		}
+	}
 
 	err = <-errc
 	log.WithError(err).Info("Shutting down")
@@ -194,18 +494,99 @@ var serverAction = func(c *cli.Context) error {
 	return nil
 }
 
+// openStateStore opens the state store selected by o.
+func openStateStore(o *serverOptions) (state.Store, error) {
+	switch o.StateStore {
+	case stateStoreBolt:
+		log.WithField("dir", o.DataDir).Info("Opening the bolt state store")
+		store, err := state.NewBoltStore(o.DataDir)
+		if err != nil {
+			return nil, err
+		}
+		store.EventRetention = o.HistoryRetention
+		return store, nil
+	case stateStoreMongo:
+		log.Info("Connecting to the mongo state store")
+		session, err := mgo.Dial(o.MongoURI)
+		if err != nil {
+			return nil, err
+		}
+		store, err := state.NewMongoStore(session, "")
+		if err != nil {
+			return nil, err
+		}
+		store.EventRetention = o.HistoryRetention
+		return store, nil
+	}
+	return nil, fmt.Errorf("unknown state store %q", o.StateStore)
+}
+
+// regionPattern matches the names of OCI regions, like us-phoenix-1.
+var regionPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// validateRegion returns an error if region is not the name of a region.
+func validateRegion(region string) error {
+	if !regionPattern.MatchString(region) {
+		return fmt.Errorf("invalid region %q", region)
+	}
+	return nil
+}
+
+// newObjectStorageClient returns a client of the object store authenticated
+// by provider. The host is endpoint if set, or the one of region, and falls
+// back to the region of provider.
+func newObjectStorageClient(provider common.ConfigurationProvider, region, endpoint string) (obstore.ObjectStorageClient, error) {
+	client, err := obstore.NewObjectStorageClientWithConfigurationProvider(provider)
+	if err != nil {
+		return client, err
+	}
+	switch {
+	case endpoint != "":
+		client.Host = endpoint
+	case region != "":
+		if err := validateRegion(region); err != nil {
+			return client, err
+		}
+		client.Host = fmt.Sprintf(common.DefaultHostURLTemplate, "objectstorage", region)
+	}
+	return client, nil
+}
+
 type serverOptions struct {
 	*conf.TraceOptions
 
 	WebHookURL         string
+	Sinks              []string
+	APILocalSinks      bool
 	Buckets            []string
+	Prefix             string
+	Include            []string
+	Exclude            []string
 	Namespace          string
 	BucketPollInterval time.Duration
-
-	Port        int
-	HealthPort  int
-	MetricsPort int
-	StateStore  string
+	InitialSync        string
+	InitialSyncSince   time.Time
+	Delivery           server.DeliveryOptions
+
+	Config               string
+	ConfigReloadInterval time.Duration
+	Watches              []server.Watch
+
+	Store    string
+	Auth     authOptions
+	Region   string
+	Endpoint string
+	S3       server.S3Options
+	FSRoot   string
+
+	Port              int
+	HealthPort        int
+	MetricsPort       int
+	StateStore        string
+	DataDir           string
+	LegacySnapshotDir string
+	HistoryRetention  time.Duration
+	MongoURI          string
 }
 
 func parseServerOptions(c *cli.Context) (*serverOptions, error) {
@@ -239,14 +620,8 @@ func parseServerOptions(c *cli.Context) (*serverOptions, error) {
 	}
 
 	namespace := c.String("namespace")
-	if namespace == "" {
-		return nil, errors.New("namespace is required")
-	}
 
 	webHook := c.String("webhook-url")
-	if webHook == "" {
-		return nil, errors.New("webhook-url is required")
-	}
 	_, err := url.Parse(webHook)
 	if err != nil {
 		return nil, fmt.Errorf("invalid webhook-url - %v", err)
@@ -257,22 +632,225 @@ func parseServerOptions(c *cli.Context) (*serverOptions, error) {
 		return nil, fmt.Errorf("invalid poll interval - %v", err)
 	}
 
+	initialSync := c.String("initial-sync")
+	var since time.Time
+	if s := c.String("initial-sync-since"); s != "" {
+		since, err = time.Parse(time.RFC3339, s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid initial-sync-since - %v", err)
+		}
+	}
+	if err := (server.Watch{InitialSync: initialSync, InitialSyncSince: since}).ValidateInitialSync(); err != nil {
+		return nil, fmt.Errorf("invalid initial-sync - %v", err)
+	}
+
+	retries := c.Int("webhook-retries")
+	if retries < 0 {
+		return nil, fmt.Errorf("invalid webhook-retries: %d", retries)
+	}
+
+	backoff, err := time.ParseDuration(c.String("webhook-backoff"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhook-backoff - %v", err)
+	}
+
+	maxBackoff, err := time.ParseDuration(c.String("webhook-max-backoff"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhook-max-backoff - %v", err)
+	}
+
+	if maxBackoff < backoff {
+		return nil, errors.New("webhook-max-backoff cannot be less than webhook-backoff")
+	}
+
+	timeout, err := time.ParseDuration(c.String("webhook-timeout"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhook-timeout - %v", err)
+	}
+
+	attempts := c.Int("delivery-attempts")
+	if attempts < 0 {
+		return nil, fmt.Errorf("invalid delivery-attempts: %d", attempts)
+	}
+
+	format, err := server.ParseFormat(c.String("webhook-format"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhook-format - %v", err)
+	}
+
+	delivery := server.DeliveryOptions{
+		Retries:        retries,
+		InitialBackoff: backoff,
+		MaxBackoff:     maxBackoff,
+		Timeout:        timeout,
+		Attempts:       attempts,
+		Secret:         c.String("webhook-secret"),
+		Format:         format,
+		FnAPIURL:       c.String("fn-api-url"),
+	}
+
+	sinks := c.StringSlice("sink")
+	for _, sink := range sinks {
+		if err := server.ValidateSink(sink); err != nil {
+			return nil, fmt.Errorf("invalid sink - %v", err)
+		}
+	}
+
 	buckets := c.StringSlice("buckets")
-	if len(buckets) == 0 {
-		return nil, errors.New("Atleast one bucket must be specified")
-	} else if len(buckets) > 10 {
-		return nil, errors.New("A maximum of 10 buckets is supported")
+	if len(buckets) > 0 {
+		if namespace == "" {
+			return nil, errors.New("namespace is required when watching buckets")
+		}
+		if webHook == "" && len(sinks) == 0 {
+			return nil, errors.New("webhook-url or sink is required when watching buckets")
+		}
+	}
+
+	region := c.String("region")
+	if region != "" {
+		if err := validateRegion(region); err != nil {
+			return nil, err
+		}
+	}
+	endpoint := c.String("endpoint")
+	if endpoint != "" {
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("invalid endpoint - %v", err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+			return nil, fmt.Errorf("invalid endpoint %q, must be an http or https url", endpoint)
+		}
+	}
+
+	store := c.String("store")
+	if store != storeOCI && store != storeS3 && store != storeFS {
+		return nil, fmt.Errorf("invalid store %q, must be %s, %s or %s", store, storeOCI, storeS3, storeFS)
+	}
+
+	s3 := server.S3Options{
+		Endpoint:  c.String("s3-endpoint"),
+		Region:    c.String("s3-region"),
+		AccessKey: c.String("s3-access-key"),
+		SecretKey: c.String("s3-secret-key"),
+	}
+	if store == storeS3 && s3.Endpoint == "" {
+		return nil, errors.New("s3-endpoint is required when the store is s3")
+	}
+	fsRoot := c.String("fs-root")
+	if store == storeFS && fsRoot == "" {
+		return nil, errors.New("fs-root is required when the store is fs")
 	}
 
-	return &serverOptions{
+	stateStore := c.String("state-store")
+	if stateStore != stateStoreBolt && stateStore != stateStoreMongo && stateStore != stateStoreFile {
+		return nil, fmt.Errorf("invalid state-store %q, must be %s, %s or %s", stateStore, stateStoreBolt, stateStoreMongo, stateStoreFile)
+	}
+	dataDir := c.String("data-dir")
+	if stateStore == stateStoreBolt && dataDir == "" {
+		return nil, errors.New("data-dir is required when the state-store is bolt")
+	}
+	legacySnapshotDir := c.String("legacy-snapshot-dir")
+	if legacySnapshotDir != "" {
+		dir, err := filepath.Abs(legacySnapshotDir)
+		if err != nil {
+			return nil, fmt.Errorf("invalid legacy-snapshot-dir - %v", err)
+		}
+		legacySnapshotDir = dir
+	}
+	historyRetention, err := time.ParseDuration(c.String("history-retention"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid history-retention - %v", err)
+	}
+	if historyRetention != 0 && historyRetention < time.Second {
+		return nil, errors.New("history-retention must be 0 or at least 1s")
+	}
+	mongoURI := c.String("mongodb-uri")
+	if stateStore == stateStoreMongo {
+		if mongoURI == "" {
+			return nil, errors.New("mongodb-uri is required when the state-store is mongo")
+		}
+		if _, err := mgo.ParseURL(mongoURI); err != nil {
+			return nil, fmt.Errorf("invalid mongodb-uri - %v", err)
+		}
+	}
+
+	authOpts := authOptions{
+		Mode:          c.String("auth"),
+		ConfigFile:    c.String("oci-config"),
+		Profile:       c.String("oci-profile"),
+		Tenancy:       c.String("oci-tenancy"),
+		User:          c.String("oci-user"),
+		Fingerprint:   c.String("oci-fingerprint"),
+		KeyFile:       c.String("oci-key-file"),
+		Region:        c.String("oci-region"),
+		KeyPassphrase: c.String("oci-key-passphrase"),
+	}
+	if authOpts.Region == "" {
+		authOpts.Region = region
+	}
+	if err := authOpts.validate(); err != nil {
+		return nil, fmt.Errorf("invalid auth - %v", err)
+	}
+
+	o := &serverOptions{
 		TraceOptions:       traceOptions,
 		Buckets:            buckets,
+		Prefix:             c.String("prefix"),
+		Include:            c.StringSlice("include"),
+		Exclude:            c.StringSlice("exclude"),
 		Namespace:          namespace,
 		WebHookURL:         webHook,
+		Sinks:              sinks,
+		APILocalSinks:      c.Bool("api-local-sinks"),
 		BucketPollInterval: duration,
+		InitialSync:        initialSync,
+		InitialSyncSince:   since,
+		Delivery:           delivery,
 		Port:               port,
 		HealthPort:         healthPort,
 		MetricsPort:        metricsPort,
-		StateStore:         c.String("state-store"),
-	}, nil
+		StateStore:         stateStore,
+		DataDir:            dataDir,
+		LegacySnapshotDir:  legacySnapshotDir,
+		HistoryRetention:   historyRetention,
+		MongoURI:           mongoURI,
+		Store:              store,
+		Auth:               authOpts,
+		Region:             region,
+		Endpoint:           endpoint,
+		S3:                 s3,
+		FSRoot:             fsRoot,
+	}
+
+	if path := c.String("config"); path != "" {
+		watches, err := server.LoadConfig(path, o.defaults())
+		if err != nil {
+			return nil, fmt.Errorf("invalid config %s - %v", path, err)
+		}
+
+		interval, err := time.ParseDuration(c.String("config-reload-interval"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid config-reload-interval - %v", err)
+		}
+
+		o.Config = path
+		o.ConfigReloadInterval = interval
+		o.Watches = watches
+	}
+
+	return o, nil
+}
+
+// defaults returns the defaults of watches that are added without them.
+func (o *serverOptions) defaults() server.Watch {
+	return server.Watch{
+		Namespace:        o.Namespace,
+		PollInterval:     o.BucketPollInterval,
+		WebhookURI:       o.WebHookURL,
+		Sinks:            o.Sinks,
+		Store:            o.Store,
+		InitialSync:      o.InitialSync,
+		InitialSyncSince: o.InitialSyncSince,
+	}
 }
@@ -0,0 +1,163 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2017 Oracle and/or its affiliates.  All rights reserved.
+// This program is free software: you can modify it and/or redistribute it
+// under the terms of:
+//
+// (i)  the Universal Permissive License v 1.0 or at your option, any
+//      later version (http://oss.oracle.com/licenses/upl); and/or
+//
+// (ii) the Apache License v 2.0. (http://www.apache.org/licenses/LICENSE-2.0)
+//-----------------------------------------------------------------------------
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Format is the shape in which changes are posted to webhooks.
+type Format string
+
+const (
+	// FormatJSON posts the Payload as a plain JSON document.
+	FormatJSON Format = "json"
+
+	// FormatCloudEvents posts a CloudEvents 1.0 event in structured mode,
+	// the attributes and the Payload as data are sent in a single JSON
+	// document.
+	FormatCloudEvents Format = "cloudevents"
+
+	// FormatCloudEventsBinary posts a CloudEvents 1.0 event in binary mode,
+	// the attributes are sent as ce- headers and the body is the Payload.
+	FormatCloudEventsBinary Format = "cloudevents-binary"
+)
+
+const (
+	cloudEventsVersion     = "1.0"
+	cloudEventsContentType = "application/cloudevents+json"
+	cloudEventsTypePrefix  = "com.oraclecloud.objectstorage.object."
+	jsonContentType        = "application/json"
+)
+
+// cloudEventTypes maps the type of a Payload to the CloudEvents type.
+var cloudEventTypes = map[string]string{
+	add: cloudEventsTypePrefix + "created",
+	upd: cloudEventsTypePrefix + "updated",
+	del: cloudEventsTypePrefix + "deleted",
+}
+
+// ParseFormat returns the Format named s. An empty s is FormatJSON.
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(s); f {
+	case "":
+		return FormatJSON, nil
+	case FormatJSON, FormatCloudEvents, FormatCloudEventsBinary:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unknown format %q", s)
+	}
+}
+
+// cloudEvent is a CloudEvents 1.0 event in the structured JSON format.
+type cloudEvent struct {
+	SpecVersion     string  `json:"specversion"`
+	ID              string  `json:"id"`
+	Source          string  `json:"source"`
+	Type            string  `json:"type"`
+	Subject         string  `json:"subject"`
+	Time            string  `json:"time,omitempty"`
+	DataContentType string  `json:"datacontenttype"`
+	Data            Payload `json:"data"`
+}
+
+// message is an encoded change, ready to be posted.
+type message struct {
+	Header http.Header
+	Body   []byte
+}
+
+// encode returns c in format f. The delivery ID is used as the ID of
+// CloudEvents, so retries of a change have the same event ID.
+func encode(f Format, c Change) (*message, error) {
+	data, err := json.Marshal(c.Payload)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &message{Header: make(http.Header)}
+	if f == FormatJSON || f == "" {
+		m.Header.Set("Content-Type", jsonContentType)
+		m.Body = data
+		return m, nil
+	}
+
+	ce := newCloudEvent(c)
+
+	switch f {
+	case FormatCloudEvents:
+		m.Header.Set("Content-Type", cloudEventsContentType)
+		m.Body, err = json.Marshal(ce)
+		if err != nil {
+			return nil, err
+		}
+	case FormatCloudEventsBinary:
+		m.Header.Set("Content-Type", ce.DataContentType)
+		m.Header.Set("ce-specversion", ce.SpecVersion)
+		m.Header.Set("ce-id", headerValue(ce.ID))
+		m.Header.Set("ce-source", headerValue(ce.Source))
+		m.Header.Set("ce-type", ce.Type)
+		m.Header.Set("ce-subject", headerValue(ce.Subject))
+		if ce.Time != "" {
+			m.Header.Set("ce-time", ce.Time)
+		}
+		m.Body = data
+	default:
+		return nil, fmt.Errorf("unknown format %q", f)
+	}
+	return m, nil
+}
+
+// headerValue percent-encodes s as required for the values of ce- headers:
+// spaces, double quotes, percent signs and every byte outside of printable
+// ASCII are encoded, so object names with any character can be sent.
+func headerValue(s string) string {
+	var b bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c <= ' ' || c > '~' || c == '"' || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// encodeLine returns c in format f as a single line of JSON. There are no
+// headers outside of HTTP, so CloudEvents are always in structured mode.
+func encodeLine(f Format, c Change) ([]byte, error) {
+	if f == FormatCloudEvents || f == FormatCloudEventsBinary {
+		return json.Marshal(newCloudEvent(c))
+	}
+	return json.Marshal(c.Payload)
+}
+
+func newCloudEvent(c Change) cloudEvent {
+	ce := cloudEvent{
+		SpecVersion:     cloudEventsVersion,
+		ID:              c.DeliveryID,
+		Source:          c.Payload.Namespace + "/" + c.Payload.Bucket,
+		Type:            cloudEventTypes[c.Payload.Type],
+		Subject:         c.Payload.ObjectName,
+		DataContentType: jsonContentType,
+		Data:            c.Payload,
+	}
+	if !c.Time.IsZero() {
+		ce.Time = c.Time.UTC().Format(time.RFC3339Nano)
+	}
+	return ce
+}
@@ -0,0 +1,141 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2017 Oracle and/or its affiliates.  All rights reserved.
+// This program is free software: you can modify it and/or redistribute it
+// under the terms of:
+//
+// (i)  the Universal Permissive License v 1.0 or at your option, any
+//      later version (http://oss.oracle.com/licenses/upl); and/or
+//
+// (ii) the Apache License v 2.0. (http://www.apache.org/licenses/LICENSE-2.0)
+//-----------------------------------------------------------------------------
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func testChange(name string) Change {
+	return Change{
+		DeliveryID: "1",
+		Time:       time.Date(2017, 11, 1, 12, 0, 0, 0, time.UTC),
+		Payload:    Payload{Namespace: testNamespace, Bucket: testBucket, ObjectName: name, ContentHash: "md5", Type: add},
+	}
+}
+
+func TestEncodeCloudEvents(t *testing.T) {
+	c := testChange("dir/a.txt")
+
+	m, err := encode(FormatCloudEvents, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := m.Header.Get("Content-Type"); ct != cloudEventsContentType {
+		t.Errorf("Expected the content type %s, got %s", cloudEventsContentType, ct)
+	}
+	var ce cloudEvent
+	if err := json.Unmarshal(m.Body, &ce); err != nil {
+		t.Fatal(err)
+	}
+	expected := cloudEvent{
+		SpecVersion:     "1.0",
+		ID:              "1",
+		Source:          testNamespace + "/" + testBucket,
+		Type:            "com.oraclecloud.objectstorage.object.created",
+		Subject:         "dir/a.txt",
+		Time:            "2017-11-01T12:00:00Z",
+		DataContentType: jsonContentType,
+		Data:            c.Payload,
+	}
+	if ce != expected {
+		t.Errorf("Expected the event\n%+v\ngot\n%+v", expected, ce)
+	}
+
+	// Lines have no headers, so they are always structured
+	line, err := encodeLine(FormatCloudEventsBinary, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ce = cloudEvent{}
+	if err := json.Unmarshal(line, &ce); err != nil || ce != expected {
+		t.Errorf("Expected the event\n%+v\ngot\n%+v %v", expected, ce, err)
+	}
+}
+
+func TestEncodeCloudEventsBinary(t *testing.T) {
+	c := testChange("dir/a.txt")
+
+	m, err := encode(FormatCloudEventsBinary, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"Content-Type":   jsonContentType,
+		"ce-specversion": "1.0",
+		"ce-id":          "1",
+		"ce-source":      testNamespace + "/" + testBucket,
+		"ce-type":        "com.oraclecloud.objectstorage.object.created",
+		"ce-subject":     "dir/a.txt",
+		"ce-time":        "2017-11-01T12:00:00Z",
+	}
+	for k, v := range expected {
+		if got := m.Header.Get(k); got != v {
+			t.Errorf("Expected %s: %s, got %s", k, v, got)
+		}
+	}
+	var p Payload
+	if err := json.Unmarshal(m.Body, &p); err != nil || p != c.Payload {
+		t.Errorf("Expected the payload as the body, got %s %v", m.Body, err)
+	}
+}
+
+func TestEncodeCloudEventsBinarySubject(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{name: "a.txt", expected: "a.txt"},
+		{name: "my file.txt", expected: "my%20file.txt"},
+		{name: `100% "done"`, expected: "100%25%20%22done%22"},
+		{name: "café", expected: "caf%C3%A9"},
+		{name: "a\r\nX-Injected: 1", expected: "a%0D%0AX-Injected:%201"},
+	}
+
+	for _, test := range tests {
+		m, err := encode(FormatCloudEventsBinary, testChange(test.name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := m.Header.Get("ce-subject"); got != test.expected {
+			t.Errorf("%q: expected the subject %s, got %s", test.name, test.expected, got)
+		}
+	}
+}
+
+// TestWebhookSinkCloudEventsBinary checks that objects whose name is not
+// valid in a header are delivered in binary mode.
+func TestWebhookSinkCloudEventsBinary(t *testing.T) {
+	subjects := make(chan string, 1)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		subjects <- r.Header.Get("ce-subject")
+	}))
+	defer hook.Close()
+
+	sink, err := NewSink(hook.URL, DeliveryOptions{Timeout: time.Second, Format: FormatCloudEventsBinary})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	if err := sink.Send(context.Background(), testChange("déjà\nvu")); err != nil {
+		t.Fatal(err)
+	}
+	if s := <-subjects; s != "d%C3%A9j%C3%A0%0Avu" {
+		t.Errorf("Unexpected subject %s", s)
+	}
+}
@@ -0,0 +1,142 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2017 Oracle and/or its affiliates.  All rights reserved.
+// This program is free software: you can modify it and/or redistribute it
+// under the terms of:
+//
+// (i)  the Universal Permissive License v 1.0 or at your option, any
+//      later version (http://oss.oracle.com/licenses/upl); and/or
+//
+// (ii) the Apache License v 2.0. (http://www.apache.org/licenses/LICENSE-2.0)
+//-----------------------------------------------------------------------------
+
+package server
+
+import (
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Config is the content of a configuration file. It is YAML, or JSON which
+// is read as YAML as well:
+//
+//	watches:
+//	- id: team-a-uploads
+//	  namespace: mynamespace
+//	  bucket: team-a
+//	  prefix: uploads/
+//	  include: ["*.csv"]
+//	  pollInterval: 1m
+//	  sinks: ["https://team-a.example.com/hook", "file:/var/log/team-a.jsonl"]
+//	  events: [NEW, UPDATE]
+//	  initialSync: since
+//	  initialSyncSince: 2017-10-01T00:00:00Z
+//
+// Fields that are left out fall back to the defaults from the command line.
+type Config struct {
+	Watches []WatchConfig `yaml:"watches"`
+}
+
+// WatchConfig is a single watch in a configuration file, see Watch for the
+// meaning of the fields.
+type WatchConfig struct {
+	ID           string   `yaml:"id"`
+	Namespace    string   `yaml:"namespace"`
+	Bucket       string   `yaml:"bucket"`
+	Prefix       string   `yaml:"prefix"`
+	Include      []string `yaml:"include"`
+	Exclude      []string `yaml:"exclude"`
+	PollInterval string   `yaml:"pollInterval"`
+	WebhookURL   string   `yaml:"webhookUrl"`
+	Sinks        []string `yaml:"sinks"`
+	Events       []string `yaml:"events"`
+	Store        string   `yaml:"store"`
+
+	InitialSync      string `yaml:"initialSync"`
+	InitialSyncSince string `yaml:"initialSyncSince"`
+}
+
+// LoadConfig reads the configuration file at path and returns its watches
+// with defaults applied. An error names the entry that is invalid.
+func LoadConfig(path string, defaults Watch) ([]Watch, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseConfig(b, defaults)
+}
+
+// ParseConfig parses the content of a configuration file, see LoadConfig.
+func ParseConfig(b []byte, defaults Watch) ([]Watch, error) {
+	var c Config
+	if err := yaml.UnmarshalStrict(b, &c); err != nil {
+		return nil, err
+	}
+
+	watches := make([]Watch, 0, len(c.Watches))
+	seen := make(map[string]int)
+	for i, wc := range c.Watches {
+		w, err := wc.watch()
+		if err == nil {
+			w = w.withDefaults(defaults)
+			err = w.Validate()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", wc.describe(i), err)
+		}
+
+		if j, ok := seen[w.ID]; ok {
+			return nil, fmt.Errorf("%s: id %q is already used by watches[%d]", wc.describe(i), w.ID, j)
+		}
+		seen[w.ID] = i
+
+		watches = append(watches, w)
+	}
+	return watches, nil
+}
+
+// watch converts wc to a Watch, without applying defaults.
+func (wc WatchConfig) watch() (Watch, error) {
+	w := Watch{
+		ID:          wc.ID,
+		Namespace:   wc.Namespace,
+		Bucket:      wc.Bucket,
+		WebhookURI:  wc.WebhookURL,
+		Sinks:       wc.Sinks,
+		Prefix:      wc.Prefix,
+		Include:     wc.Include,
+		Exclude:     wc.Exclude,
+		Events:      wc.Events,
+		Store:       wc.Store,
+		InitialSync: wc.InitialSync,
+	}
+
+	if wc.PollInterval != "" {
+		d, err := time.ParseDuration(wc.PollInterval)
+		if err != nil {
+			return Watch{}, fmt.Errorf("invalid poll interval - %v", err)
+		}
+		w.PollInterval = d
+	}
+	if wc.InitialSyncSince != "" {
+		t, err := time.Parse(time.RFC3339, wc.InitialSyncSince)
+		if err != nil {
+			return Watch{}, fmt.Errorf("invalid initial sync since - %v", err)
+		}
+		w.InitialSyncSince = t
+	}
+	return w, nil
+}
+
+// describe names the entry at index i for error messages.
+func (wc WatchConfig) describe(i int) string {
+	switch {
+	case wc.ID != "":
+		return fmt.Sprintf("watches[%d] (id %q)", i, wc.ID)
+	case wc.Bucket != "":
+		return fmt.Sprintf("watches[%d] (bucket %q)", i, wc.Bucket)
+	}
+	return fmt.Sprintf("watches[%d]", i)
+}
@@ -0,0 +1,117 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2017 Oracle and/or its affiliates.  All rights reserved.
+// This program is free software: you can modify it and/or redistribute it
+// under the terms of:
+//
+// (i)  the Universal Permissive License v 1.0 or at your option, any
+//      later version (http://oss.oracle.com/licenses/upl); and/or
+//
+// (ii) the Apache License v 2.0. (http://www.apache.org/licenses/LICENSE-2.0)
+//-----------------------------------------------------------------------------
+
+package server
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+var testConfigDefaults = Watch{
+	Namespace:    testNamespace,
+	PollInterval: 30 * time.Second,
+	Sinks:        []string{"stdout"},
+}
+
+func TestParseConfig(t *testing.T) {
+	config := `
+watches:
+- id: uploads
+  bucket: team-a
+  prefix: uploads/
+  pollInterval: 1m
+  sinks: ["https://team-a.example.com/hook"]
+  events: [NEW]
+- id: other
+  namespace: other
+  bucket: team-b
+`
+	watches, err := ParseConfig([]byte(config), testConfigDefaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(watches) != 2 {
+		t.Fatalf("Expected 2 watches, got %+v", watches)
+	}
+
+	w := watches[0]
+	if w.ID != "uploads" || w.Namespace != testNamespace || w.Bucket != "team-a" || w.Prefix != "uploads/" || w.PollInterval != time.Minute {
+		t.Errorf("Unexpected watch %+v", w)
+	}
+	if len(w.Sinks) != 1 || w.Sinks[0] != "https://team-a.example.com/hook" || len(w.Events) != 1 || w.Events[0] != add {
+		t.Errorf("Unexpected sinks or events of %+v", w)
+	}
+
+	// Fields that are left out fall back to the defaults
+	w = watches[1]
+	if w.Namespace != "other" || w.PollInterval != testConfigDefaults.PollInterval || len(w.Sinks) != 1 || w.Sinks[0] != "stdout" {
+		t.Errorf("Expected the defaults to be applied, got %+v", w)
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		expected []string
+	}{
+		{
+			name:     "unknown field",
+			config:   "watches:\n- id: a\n  bukcet: team-a\n",
+			expected: []string{"bukcet"},
+		},
+		{
+			name:     "unknown top level field",
+			config:   "watch:\n- id: a\n  bucket: team-a\n",
+			expected: []string{"watch"},
+		},
+		{
+			name:     "duplicate id",
+			config:   "watches:\n- id: a\n  bucket: team-a\n- id: a\n  bucket: team-b\n",
+			expected: []string{`watches[1] (id "a")`, "already used by watches[0]"},
+		},
+		{
+			name:     "bad duration",
+			config:   "watches:\n- id: a\n  bucket: team-a\n- id: b\n  bucket: team-b\n  pollInterval: soon\n",
+			expected: []string{`watches[1] (id "b")`, "invalid poll interval"},
+		},
+		{
+			name:     "missing bucket",
+			config:   "watches:\n- id: a\n  bucket: team-a\n- id: b\n",
+			expected: []string{`watches[1] (id "b")`, "bucket is required"},
+		},
+		{
+			name:     "missing bucket without id",
+			config:   "watches:\n- id: a\n  bucket: team-a\n- prefix: uploads/\n",
+			expected: []string{"watches[1]: "},
+		},
+		{
+			name:     "bad initial sync since",
+			config:   "watches:\n- bucket: team-a\n  initialSync: since\n  initialSyncSince: yesterday\n",
+			expected: []string{`watches[0] (bucket "team-a")`, "invalid initial sync since"},
+		},
+	}
+
+	for _, test := range tests {
+		_, err := ParseConfig([]byte(test.config), testConfigDefaults)
+		if err == nil {
+			t.Errorf("%s: expected an error", test.name)
+			continue
+		}
+		for _, s := range test.expected {
+			if !strings.Contains(err.Error(), s) {
+				t.Errorf("%s: expected the error to contain %q, got %v", test.name, s, err)
+			}
+		}
+	}
+}
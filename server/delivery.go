@@ -0,0 +1,193 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2017 Oracle and/or its affiliates.  All rights reserved.
+// This program is free software: you can modify it and/or redistribute it
+// under the terms of:
+//
+// (i)  the Universal Permissive License v 1.0 or at your option, any
+//      later version (http://oss.oracle.com/licenses/upl); and/or
+//
+// (ii) the Apache License v 2.0. (http://www.apache.org/licenses/LICENSE-2.0)
+//-----------------------------------------------------------------------------
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/wercker/pkg/log"
+)
+
+// DeliveryOptions controls how often and how long a webhook call is retried.
+type DeliveryOptions struct {
+	// Retries is the number of attempts after the first one failed.
+	Retries int
+
+	// InitialBackoff is the wait before the first retry, it doubles for every
+	// following retry up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+
+	// Timeout limits a single attempt.
+	Timeout time.Duration
+
+	// Attempts is the number of times a change is handed to a sink, which
+	// may retry it on its own, before the change is dropped so it does not
+	// hold up the changes after it. 0 means there is no limit.
+	Attempts int
+
+	// Secret is used to sign every request, requests are not signed if it
+	// is empty. See WebhookVerifier for checking the signature.
+	Secret string
+
+	// Format is the shape of the posted changes, FormatJSON if empty.
+	Format Format
+
+	// FnAPIURL is the Fn API used to look up functions of fn sinks that are
+	// configured by app and function name.
+	FnAPIURL string
+}
+
+// DefaultDeliveryOptions are used when no DeliveryOptions are configured.
+var DefaultDeliveryOptions = DeliveryOptions{
+	Retries:        5,
+	InitialBackoff: 500 * time.Millisecond,
+	MaxBackoff:     30 * time.Second,
+	Timeout:        10 * time.Second,
+	Attempts:       3,
+}
+
+// StatusError is returned when a webhook responded with a non-2xx status.
+type StatusError struct {
+	URL        string
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("webhook %s responded with status %d", e.URL, e.StatusCode)
+}
+
+// Temporary returns false for client errors that will not go away by
+// retrying the same request.
+func (e *StatusError) Temporary() bool {
+	if e.StatusCode == http.StatusRequestTimeout || e.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	return e.StatusCode < 400 || e.StatusCode >= 500
+}
+
+// permanent returns true if err says that sending the same change again will
+// fail again, such as a webhook that rejected it as a bad request.
+func permanent(err error) bool {
+	serr, ok := err.(*StatusError)
+	return ok && !serr.Temporary()
+}
+
+// deliverer posts payloads to webhooks, retrying failed attempts with
+// exponential backoff.
+type deliverer struct {
+	client *http.Client
+	opts   DeliveryOptions
+}
+
+func newDeliverer(opts DeliveryOptions) *deliverer {
+	return &deliverer{
+		client: &http.Client{},
+		opts:   opts,
+	}
+}
+
+// deliver posts m to url until it is accepted, the retries are used up, or
+// ctx is done. The headers of the last response are returned, together with
+// the last error if it never got accepted.
+func (d *deliverer) deliver(ctx context.Context, url string, deliveryID string, m *message) (http.Header, error) {
+	for attempt := 0; ; attempt++ {
+		header, err := d.post(ctx, url, deliveryID, m)
+		if err == nil {
+			return header, nil
+		}
+
+		if permanent(err) {
+			return header, err
+		}
+		if attempt >= d.opts.Retries {
+			return header, err
+		}
+
+		wait := d.backoff(attempt)
+		log.WithField("url", url).WithField("attempt", attempt+1).WithError(err).Warnf("Webhook call failed, retrying in %v", wait)
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// post makes a single attempt at delivering m to url.
+func (d *deliverer) post(ctx context.Context, url string, deliveryID string, m *message) (http.Header, error) {
+	if d.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.opts.Timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(m.Body))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	for k, v := range m.Header {
+		req.Header[k] = v
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set(DeliveryHeader, deliveryID)
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	if d.opts.Secret != "" {
+		nonce := newDeliveryID()
+		req.Header.Set(NonceHeader, nonce)
+		req.Header.Set(SignatureHeader, Sign([]byte(d.opts.Secret), timestamp, deliveryID, nonce, m.Body))
+	}
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	// Drain the body so the connection can be reused
+	io.Copy(ioutil.Discard, io.LimitReader(res.Body, 64*1024))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.Header, &StatusError{URL: url, StatusCode: res.StatusCode}
+	}
+	return res.Header, nil
+}
+
+// backoff returns the wait before retry attempt+1. It doubles for every
+// attempt and a random jitter of up to half of it is taken off, so watchers
+// that failed at the same time do not retry in lockstep.
+func (d *deliverer) backoff(attempt int) time.Duration {
+	wait := d.opts.InitialBackoff
+	for i := 0; i < attempt && wait < d.opts.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if d.opts.MaxBackoff > 0 && wait > d.opts.MaxBackoff {
+		wait = d.opts.MaxBackoff
+	}
+	if wait <= 0 {
+		return 0
+	}
+
+	half := int64(wait / 2)
+	return time.Duration(half + rand.Int63n(half+1))
+}
@@ -0,0 +1,198 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2017 Oracle and/or its affiliates.  All rights reserved.
+// This program is free software: you can modify it and/or redistribute it
+// under the terms of:
+//
+// (i)  the Universal Permissive License v 1.0 or at your option, any
+//      later version (http://oss.oracle.com/licenses/upl); and/or
+//
+// (ii) the Apache License v 2.0. (http://www.apache.org/licenses/LICENSE-2.0)
+//-----------------------------------------------------------------------------
+
+package server
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// subscriptionBuffer is the number of events a subscriber can fall behind
+// before it gets dropped.
+const subscriptionBuffer = 256
+
+// recentEvents is the number of published events that are kept, so
+// subscribers can resume after they disconnect.
+const recentEvents = 1024
+
+// Event is a published change. Events are numbered in the order they are
+// published, the ID also identifies the run of the server, so IDs from a
+// previous run are not mistaken for recent ones.
+type Event struct {
+	ID string
+	Payload
+}
+
+// EventFilter selects events for a subscription. Empty fields match
+// everything.
+type EventFilter struct {
+	Namespace string
+	Bucket    string
+	Prefix    string
+}
+
+// Match returns true if p passes all filters of f.
+func (f EventFilter) Match(p Payload) bool {
+	if f.Namespace != "" && f.Namespace != p.Namespace {
+		return false
+	}
+	if f.Bucket != "" && f.Bucket != p.Bucket {
+		return false
+	}
+	return strings.HasPrefix(p.ObjectName, f.Prefix)
+}
+
+// Subscription receives the events published to an eventHub that match its
+// filter.
+type Subscription struct {
+	hub    *eventHub
+	filter EventFilter
+	events chan Event
+
+	// overflow is closed when the subscriber did not keep up and events were
+	// dropped, Events is closed right after.
+	overflow chan struct{}
+}
+
+// Events returns the channel on which matching events are delivered. It is
+// closed when the subscription ends.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Overflowed returns true if the subscription was ended because the
+// subscriber fell too far behind.
+func (s *Subscription) Overflowed() bool {
+	select {
+	case <-s.overflow:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close ends the subscription.
+func (s *Subscription) Close() {
+	s.hub.unsubscribe(s)
+}
+
+// eventHub fans out events to all subscriptions and keeps the most recent
+// ones.
+type eventHub struct {
+	mu   sync.Mutex
+	subs map[*Subscription]struct{}
+
+	epoch string
+	seq   uint64
+	// recent holds at least the last recentEvents events, oldest first.
+	recent []Event
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{
+		subs:  make(map[*Subscription]struct{}),
+		epoch: strconv.FormatInt(time.Now().UnixNano(), 36),
+	}
+}
+
+// subscribe starts a subscription. If lastEventID is set, the recent events
+// published after it are delivered first. An ID the hub does not know, such
+// as one from a previous run, replays all recent events.
+func (h *eventHub) subscribe(filter EventFilter, lastEventID string) *Subscription {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var replay []Event
+	if lastEventID != "" {
+		for _, e := range h.since(lastEventID) {
+			if filter.Match(e.Payload) {
+				replay = append(replay, e)
+			}
+		}
+	}
+
+	s := &Subscription{
+		hub:      h,
+		filter:   filter,
+		events:   make(chan Event, subscriptionBuffer+len(replay)),
+		overflow: make(chan struct{}),
+	}
+	for _, e := range replay {
+		s.events <- e
+	}
+	h.subs[s] = struct{}{}
+
+	return s
+}
+
+// since returns the recent events published after the event id. h.mu must
+// be held.
+func (h *eventHub) since(id string) []Event {
+	i := strings.LastIndex(id, "-")
+	if i < 0 || id[:i] != h.epoch {
+		return h.recent
+	}
+	seq, err := strconv.ParseUint(id[i+1:], 10, 64)
+	if err != nil {
+		return h.recent
+	}
+
+	// The events are numbered without gaps
+	if len(h.recent) == 0 || seq >= h.seq {
+		return nil
+	}
+	first := h.seq - uint64(len(h.recent)) + 1
+	if seq < first {
+		return h.recent
+	}
+	return h.recent[seq-first+1:]
+}
+
+func (h *eventHub) unsubscribe(s *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.subs[s]; ok {
+		delete(h.subs, s)
+		close(s.events)
+	}
+}
+
+// publish numbers p and sends it to every matching subscription without
+// blocking. Slow subscribers are dropped rather than holding up the watcher.
+func (h *eventHub) publish(p Payload) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.seq++
+	e := Event{ID: h.epoch + "-" + strconv.FormatUint(h.seq, 10), Payload: p}
+	h.recent = append(h.recent, e)
+	if len(h.recent) >= 2*recentEvents {
+		h.recent = append([]Event(nil), h.recent[len(h.recent)-recentEvents:]...)
+	}
+
+	for s := range h.subs {
+		if !s.filter.Match(p) {
+			continue
+		}
+
+		select {
+		case s.events <- e:
+		default:
+			close(s.overflow)
+			delete(h.subs, s)
+			close(s.events)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2017 Oracle and/or its affiliates.  All rights reserved.
+// This program is free software: you can modify it and/or redistribute it
+// under the terms of:
+//
+// (i)  the Universal Permissive License v 1.0 or at your option, any
+//      later version (http://oss.oracle.com/licenses/upl); and/or
+//
+// (ii) the Apache License v 2.0. (http://www.apache.org/licenses/LICENSE-2.0)
+//-----------------------------------------------------------------------------
+
+package server
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// received returns the names of the events buffered for s.
+func received(s *Subscription) []string {
+	var names []string
+	for {
+		select {
+		case e := <-s.Events():
+			names = append(names, e.ObjectName)
+		default:
+			return names
+		}
+	}
+}
+
+func TestEventHubResumes(t *testing.T) {
+	h := newEventHub()
+	live := h.subscribe(EventFilter{}, "")
+	defer live.Close()
+
+	for _, name := range []string{"a", "b", "c", "d"} {
+		h.publish(Payload{Bucket: testBucket, ObjectName: name})
+	}
+	var ids []string
+	for i := 0; i < 4; i++ {
+		ids = append(ids, (<-live.Events()).ID)
+	}
+
+	tests := []struct {
+		lastEventID string
+		filter      EventFilter
+		expected    string
+	}{
+		{"", EventFilter{}, ""},
+		{ids[1], EventFilter{}, "c,d"},
+		{ids[3], EventFilter{}, ""},
+		{ids[0], EventFilter{Prefix: "d"}, "d"},
+		// IDs of another run replay every recent event
+		{"previous-2", EventFilter{}, "a,b,c,d"},
+		{"invalid", EventFilter{}, "a,b,c,d"},
+	}
+	for _, test := range tests {
+		s := h.subscribe(test.filter, test.lastEventID)
+		if got := strings.Join(received(s), ","); got != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.lastEventID, test.expected, got)
+		}
+		s.Close()
+	}
+
+	// Live events follow the replayed ones
+	s := h.subscribe(EventFilter{}, ids[2])
+	defer s.Close()
+	h.publish(Payload{Bucket: testBucket, ObjectName: "e"})
+	if got := strings.Join(received(s), ","); got != "d,e" {
+		t.Errorf("Expected d,e, got %q", got)
+	}
+}
+
+func TestEventHubKeepsRecentEvents(t *testing.T) {
+	h := newEventHub()
+	live := h.subscribe(EventFilter{}, "")
+	defer live.Close()
+
+	var first string
+	for i := 0; i < 3*recentEvents; i++ {
+		h.publish(Payload{ObjectName: fmt.Sprint(i)})
+		e := <-live.Events()
+		if i == 0 {
+			first = e.ID
+		}
+	}
+
+	// Events older than the buffer are lost, the rest is replayed
+	s := h.subscribe(EventFilter{}, first)
+	defer s.Close()
+	names := received(s)
+	if len(names) < recentEvents || names[len(names)-1] != fmt.Sprint(3*recentEvents-1) {
+		t.Errorf("Expected at least %d recent events, got %d", recentEvents, len(names))
+	}
+}
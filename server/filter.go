@@ -0,0 +1,102 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2017 Oracle and/or its affiliates.  All rights reserved.
+// This program is free software: you can modify it and/or redistribute it
+// under the terms of:
+//
+// (i)  the Universal Permissive License v 1.0 or at your option, any
+//      later version (http://oss.oracle.com/licenses/upl); and/or
+//
+// (ii) the Apache License v 2.0. (http://www.apache.org/licenses/LICENSE-2.0)
+//-----------------------------------------------------------------------------
+
+package server
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// regexpPrefix marks a pattern as a regular expression instead of a glob.
+const regexpPrefix = "re:"
+
+// objectFilter selects the objects of a watch by name. An object has to
+// start with the prefix, match one of the include patterns if there are any
+// and none of the exclude patterns.
+//
+// Patterns are globs as understood by path.Match. A glob without a slash is
+// matched against the base name of an object, so "*.csv" matches csv files
+// in any folder, other globs are matched against the full name. Patterns
+// starting with "re:" are regular expressions matched against the full name.
+type objectFilter struct {
+	prefix  string
+	include []func(string) bool
+	exclude []func(string) bool
+}
+
+func newObjectFilter(w Watch) (*objectFilter, error) {
+	f := &objectFilter{prefix: w.Prefix}
+	for _, p := range w.Include {
+		m, err := compilePattern(p)
+		if err != nil {
+			return nil, err
+		}
+		f.include = append(f.include, m)
+	}
+	for _, p := range w.Exclude {
+		m, err := compilePattern(p)
+		if err != nil {
+			return nil, err
+		}
+		f.exclude = append(f.exclude, m)
+	}
+	return f, nil
+}
+
+func compilePattern(pattern string) (func(string) bool, error) {
+	if strings.HasPrefix(pattern, regexpPrefix) {
+		re, err := regexp.Compile(strings.TrimPrefix(pattern, regexpPrefix))
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q - %v", pattern, err)
+		}
+		return re.MatchString, nil
+	}
+
+	if pattern == "" {
+		return nil, fmt.Errorf("invalid pattern %q", pattern)
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid pattern %q - %v", pattern, err)
+	}
+
+	base := !strings.Contains(pattern, "/")
+	return func(name string) bool {
+		if base {
+			name = path.Base(name)
+		}
+		ok, _ := path.Match(pattern, name)
+		return ok
+	}, nil
+}
+
+// match returns true if the object called name is selected by f.
+func (f *objectFilter) match(name string) bool {
+	if !strings.HasPrefix(name, f.prefix) {
+		return false
+	}
+	for _, m := range f.exclude {
+		if m(name) {
+			return false
+		}
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, m := range f.include {
+		if m(name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,228 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2017 Oracle and/or its affiliates.  All rights reserved.
+// This program is free software: you can modify it and/or redistribute it
+// under the terms of:
+//
+// (i)  the Universal Permissive License v 1.0 or at your option, any
+//      later version (http://oss.oracle.com/licenses/upl); and/or
+//
+// (ii) the Apache License v 2.0. (http://www.apache.org/licenses/LICENSE-2.0)
+//-----------------------------------------------------------------------------
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/wercker/pkg/log"
+)
+
+const (
+	// fnCallIDHeader is set by Fn on the response of an invocation.
+	fnCallIDHeader = "Fn-Call-Id"
+
+	// fnInvokeEndpointAnnotation is the annotation Fn sets on a function
+	// with the url at which it is invoked.
+	fnInvokeEndpointAnnotation = "fnproject.io/fn/invokeEndpoint"
+)
+
+// ErrFnNotFound is returned when an Fn app or function does not exist.
+var ErrFnNotFound = errors.New("fn function not found")
+
+// fnSink invokes an Fn function with the change as the request body. The
+// function is either given as its invoke endpoint, or as an app and function
+// name that are looked up through the Fn API.
+type fnSink struct {
+	deliverer *deliverer
+
+	apiURL   string
+	app      string
+	function string
+
+	mu     sync.Mutex
+	invoke string
+}
+
+// newFnSink creates a sink for arg, which is an invoke endpoint url or
+// "<app>/<function>".
+func newFnSink(arg string, opts DeliveryOptions) (*fnSink, error) {
+	s := &fnSink{deliverer: newDeliverer(opts)}
+	if isFnInvokeEndpoint(arg) {
+		s.invoke = arg
+		return s, nil
+	}
+
+	if opts.FnAPIURL == "" {
+		return nil, errors.New("fn api url is required to invoke functions by name")
+	}
+	s.apiURL = strings.TrimSuffix(opts.FnAPIURL, "/")
+	s.app, s.function = splitFnName(arg)
+	return s, nil
+}
+
+// validateFnSink returns an error if arg does not name a function.
+func validateFnSink(arg string) error {
+	if isFnInvokeEndpoint(arg) {
+		u, err := url.Parse(arg)
+		if err != nil {
+			return fmt.Errorf("invalid fn invoke endpoint - %v", err)
+		}
+		if u.Host == "" {
+			return fmt.Errorf("invalid fn invoke endpoint %q", arg)
+		}
+		return nil
+	}
+
+	app, function := splitFnName(arg)
+	if app == "" || function == "" {
+		return fmt.Errorf("fn sink requires an invoke endpoint or <app>/<function>, got %q", arg)
+	}
+	return nil
+}
+
+func isFnInvokeEndpoint(arg string) bool {
+	return strings.HasPrefix(arg, "http://") || strings.HasPrefix(arg, "https://")
+}
+
+func splitFnName(arg string) (string, string) {
+	parts := strings.Split(arg, "/")
+	if len(parts) != 2 {
+		return "", ""
+	}
+	return parts[0], parts[1]
+}
+
+func (s *fnSink) Send(ctx context.Context, c Change) error {
+	m, err := encode(s.deliverer.opts.Format, c)
+	if err != nil {
+		return err
+	}
+
+	endpoint, err := s.endpoint(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = s.invokeAt(ctx, endpoint, c, m)
+	if serr, ok := err.(*StatusError); ok && serr.StatusCode == http.StatusNotFound && s.apiURL != "" {
+		// The function may have been recreated with a new ID, which is
+		// invoked right away so the change is not dropped
+		s.forget(endpoint)
+		next, lerr := s.endpoint(ctx)
+		if lerr != nil {
+			return lerr
+		}
+		if next != endpoint {
+			return s.invokeAt(ctx, next, c, m)
+		}
+	}
+	return err
+}
+
+// invokeAt delivers m to the invoke endpoint of the function.
+func (s *fnSink) invokeAt(ctx context.Context, endpoint string, c Change, m *message) error {
+	header, err := s.deliverer.deliver(ctx, endpoint, c.DeliveryID, m)
+	entry := log.WithField("endpoint", endpoint).WithField("delivery", c.DeliveryID).WithField("call", header.Get(fnCallIDHeader))
+	if err != nil {
+		entry.WithError(err).Warn("Fn function invocation failed")
+		return err
+	}
+
+	entry.Info("Invoked fn function")
+	return nil
+}
+
+// forget drops the invoke endpoint so it is looked up again, unless it was
+// looked up again in the meantime.
+func (s *fnSink) forget(endpoint string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.invoke == endpoint {
+		s.invoke = ""
+	}
+}
+
+func (s *fnSink) Close() error {
+	return nil
+}
+
+// endpoint returns the invoke endpoint of the function, it is looked up
+// through the Fn API the first time.
+func (s *fnSink) endpoint(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.invoke != "" {
+		return s.invoke, nil
+	}
+
+	var apps struct {
+		Items []struct {
+			ID string `json:"id"`
+		} `json:"items"`
+	}
+	q := url.Values{"name": {s.app}}
+	if err := s.get(ctx, "/v2/apps?"+q.Encode(), &apps); err != nil {
+		return "", err
+	}
+	if len(apps.Items) == 0 {
+		return "", fmt.Errorf("%v: app %s", ErrFnNotFound, s.app)
+	}
+
+	var fns struct {
+		Items []struct {
+			ID          string            `json:"id"`
+			Annotations map[string]string `json:"annotations"`
+		} `json:"items"`
+	}
+	q = url.Values{"app_id": {apps.Items[0].ID}, "name": {s.function}}
+	if err := s.get(ctx, "/v2/fns?"+q.Encode(), &fns); err != nil {
+		return "", err
+	}
+	if len(fns.Items) == 0 {
+		return "", fmt.Errorf("%v: %s/%s", ErrFnNotFound, s.app, s.function)
+	}
+
+	fn := fns.Items[0]
+	s.invoke = fn.Annotations[fnInvokeEndpointAnnotation]
+	if s.invoke == "" {
+		s.invoke = s.apiURL + "/invoke/" + url.PathEscape(fn.ID)
+	}
+
+	log.WithField("function", s.app+"/"+s.function).WithField("endpoint", s.invoke).Debug("Resolved fn invoke endpoint")
+	return s.invoke, nil
+}
+
+// get reads the JSON response of path on the Fn API into v.
+func (s *fnSink) get(ctx context.Context, path string, v interface{}) error {
+	if s.deliverer.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.deliverer.opts.Timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequest(http.MethodGet, s.apiURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", jsonContentType)
+
+	res, err := s.deliverer.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return &StatusError{URL: s.apiURL + path, StatusCode: res.StatusCode}
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
@@ -0,0 +1,191 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2017 Oracle and/or its affiliates.  All rights reserved.
+// This program is free software: you can modify it and/or redistribute it
+// under the terms of:
+//
+// (i)  the Universal Permissive License v 1.0 or at your option, any
+//      later version (http://oss.oracle.com/licenses/upl); and/or
+//
+// (ii) the Apache License v 2.0. (http://www.apache.org/licenses/LICENSE-2.0)
+//-----------------------------------------------------------------------------
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fnServer is a stand-in for the Fn API and the invoke endpoint of a single
+// function, app/func, whose ID is fnID.
+type fnServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	fnID     string
+	lookups  int
+	calls    []hookCall
+	notFound int
+}
+
+func newFnServer() *fnServer {
+	f := &fnServer{fnID: "fn-id"}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v2/apps", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		f.lookups++
+		f.mu.Unlock()
+
+		items := []map[string]string{}
+		if r.URL.Query().Get("name") == "app" {
+			items = append(items, map[string]string{"id": "app-id"})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"items": items})
+	})
+	mux.HandleFunc("/v2/fns", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		id := f.fnID
+		f.mu.Unlock()
+
+		items := []interface{}{}
+		if q := r.URL.Query(); q.Get("app_id") == "app-id" && q.Get("name") == "func" {
+			items = append(items, map[string]interface{}{
+				"id":          id,
+				"annotations": map[string]string{fnInvokeEndpointAnnotation: f.URL + "/invoke/" + id},
+			})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"items": items})
+	})
+	mux.HandleFunc("/invoke/", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		if r.URL.Path != "/invoke/"+f.fnID {
+			http.NotFound(w, r)
+			return
+		}
+		if f.notFound > 0 {
+			f.notFound--
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var p Payload
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.calls = append(f.calls, hookCall{DeliveryID: r.Header.Get(DeliveryHeader), Payload: p})
+		w.Header().Set(fnCallIDHeader, fmt.Sprintf("call-%d", len(f.calls)))
+	})
+	f.Server = httptest.NewServer(mux)
+	return f
+}
+
+func TestFnSinkInvokesByName(t *testing.T) {
+	f := newFnServer()
+	defer f.Close()
+
+	sink, err := NewSink("fn:app/func", DeliveryOptions{Timeout: time.Second, FnAPIURL: f.URL + "/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	ctx := context.Background()
+
+	c := Change{DeliveryID: "1", Time: time.Now(), Payload: Payload{Namespace: testNamespace, Bucket: testBucket, ObjectName: "a", Type: add}}
+	for _, id := range []string{"1", "2"} {
+		c.DeliveryID = id
+		if err := sink.Send(ctx, c); err != nil {
+			t.Fatalf("Send failed: %v", err)
+		}
+	}
+
+	f.mu.Lock()
+	if f.lookups != 1 || len(f.calls) != 2 || f.calls[1].DeliveryID != "2" || f.calls[1].Payload != c.Payload {
+		t.Errorf("Expected 2 invocations after 1 lookup, got %d lookups and %+v", f.lookups, f.calls)
+	}
+	// A 404 makes the sink look up the function again, which fails the
+	// change if the ID did not change
+	f.notFound = 1
+	f.mu.Unlock()
+
+	if err := sink.Send(ctx, c); err == nil {
+		t.Fatal("Expected Send to fail for a missing function")
+	}
+	if err := sink.Send(ctx, c); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.lookups != 2 || len(f.calls) != 3 {
+		t.Errorf("Expected the function to be looked up once more, got %d lookups and %d calls", f.lookups, len(f.calls))
+	}
+}
+
+func TestFnSinkFunctionRecreated(t *testing.T) {
+	f := newFnServer()
+	defer f.Close()
+
+	sink, err := NewSink("fn:app/func", DeliveryOptions{Timeout: time.Second, FnAPIURL: f.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	ctx := context.Background()
+
+	c := Change{DeliveryID: "1", Time: time.Now(), Payload: Payload{Namespace: testNamespace, Bucket: testBucket, ObjectName: "a", Type: add}}
+	if err := sink.Send(ctx, c); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	// Redeployed with a new ID, the first change after it is delivered to
+	// the new function
+	f.mu.Lock()
+	f.fnID = "new-fn-id"
+	f.mu.Unlock()
+
+	c.DeliveryID = "2"
+	if err := sink.Send(ctx, c); err != nil {
+		t.Fatalf("Expected the change to be delivered to the new function, got %v", err)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.lookups != 2 || len(f.calls) != 2 || f.calls[1].DeliveryID != "2" {
+		t.Errorf("Expected 2 invocations after 2 lookups, got %d lookups and %+v", f.lookups, f.calls)
+	}
+}
+
+func TestFnSinkUnknownFunction(t *testing.T) {
+	f := newFnServer()
+	defer f.Close()
+
+	sink, err := NewSink("fn:app/missing", DeliveryOptions{Timeout: time.Second, FnAPIURL: f.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	if err := sink.Send(context.Background(), Change{DeliveryID: "1"}); err == nil {
+		t.Error("Expected Send to fail for an unknown function")
+	}
+}
+
+func TestWatcherRejectsFnSinkWithoutAPIURL(t *testing.T) {
+	defer inTempDir(t)()
+
+	o := NewObjectWatcher(&memoryStore{}, Watch{Namespace: testNamespace, PollInterval: testPollInterval}, DeliveryOptions{})
+	defer o.Shutdown()
+
+	if _, err := o.Add(Watch{Bucket: testBucket, Sinks: []string{"fn:app/func"}}); err == nil {
+		t.Error("Expected a fn sink by name to require the fn api url")
+	}
+	if _, err := o.Add(Watch{Bucket: testBucket, Sinks: []string{"fn:http://fn.example.com/invoke/fn-id"}}); err != nil {
+		t.Errorf("Expected an invoke endpoint to be accepted, got %v", err)
+	}
+}
@@ -0,0 +1,293 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2017 Oracle and/or its affiliates.  All rights reserved.
+// This program is free software: you can modify it and/or redistribute it
+// under the terms of:
+//
+// (i)  the Universal Permissive License v 1.0 or at your option, any
+//      later version (http://oss.oracle.com/licenses/upl); and/or
+//
+// (ii) the Apache License v 2.0. (http://www.apache.org/licenses/LICENSE-2.0)
+//-----------------------------------------------------------------------------
+
+package server
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fileObjectStore is an ObjectStore of a local directory. Each directory
+// in the root is a bucket, the objects are the regular files below it, named
+// by their slash separated path in the bucket. The namespace of watches is
+// not used.
+type fileObjectStore struct {
+	root string
+
+	mu sync.Mutex
+	// sums caches the MD5 of files, so unchanged files are not read on
+	// every poll.
+	sums map[string]fileSum
+	// listings holds the names left to list by the listings in progress,
+	// by bucket and prefix, so a listing walks the bucket once and not for
+	// every page.
+	listings map[string]fileListing
+}
+
+type fileListing struct {
+	next  string
+	names []string
+}
+
+type fileSum struct {
+	size    int64
+	modTime time.Time
+	md5     string
+}
+
+// NewFileObjectStore returns an ObjectStore of the buckets in the root
+// directory. Changes are found by polling, like for the other stores.
+func NewFileObjectStore(root string) (ObjectStore, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("invalid fs root - %v", err)
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, fmt.Errorf("invalid fs root - %v", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("invalid fs root %s, must be a directory", root)
+	}
+
+	return &fileObjectStore{
+		root:     root,
+		sums:     make(map[string]fileSum),
+		listings: make(map[string]fileListing),
+	}, nil
+}
+
+// bucketDir returns the directory of a bucket, which must exist.
+func (s *fileObjectStore) bucketDir(bucket string) (string, error) {
+	if bucket == "" || bucket == "." || bucket == ".." || strings.ContainsAny(bucket, `/\`) {
+		return "", fmt.Errorf("invalid bucket name %q", bucket)
+	}
+	dir := filepath.Join(s.root, bucket)
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("bucket %s does not exist in %s", bucket, s.root)
+	}
+	return dir, nil
+}
+
+// objectPath returns the file of an object, names that would leave the
+// bucket are not found.
+func (s *fileObjectStore) objectPath(bucket, name string) (string, error) {
+	dir, err := s.bucketDir(bucket)
+	if err != nil {
+		return "", err
+	}
+	if name == "" || path.Clean("/"+name) != "/"+name {
+		return "", ErrObjectNotFound
+	}
+	return filepath.Join(dir, filepath.FromSlash(name)), nil
+}
+
+// List walks the bucket on the first page of a listing and keeps the names
+// for the next pages. Start is the name of the first object of the page.
+func (s *fileObjectStore) List(ctx context.Context, r ListRequest) (ListPage, error) {
+	dir, err := s.bucketDir(r.Bucket)
+	if err != nil {
+		return ListPage{}, err
+	}
+
+	// Only the directory holding the prefix has to be walked. Like names,
+	// it must not leave the bucket.
+	walkDir := dir
+	if i := strings.LastIndex(r.Prefix, "/"); i >= 0 {
+		prefixDir := r.Prefix[:i]
+		if path.Clean("/"+prefixDir) != "/"+prefixDir {
+			return ListPage{}, fmt.Errorf("invalid prefix %q", r.Prefix)
+		}
+		walkDir = filepath.Join(dir, filepath.FromSlash(prefixDir))
+	}
+	if walkDir != dir && !strings.HasPrefix(walkDir, dir+string(filepath.Separator)) {
+		return ListPage{}, fmt.Errorf("invalid prefix %q", r.Prefix)
+	}
+
+	// Buckets have no slash, so the key is unique. A listing whose names
+	// were replaced by another one of the same prefix walks the bucket
+	// again from Start.
+	key := r.Bucket + "/" + r.Prefix
+	s.mu.Lock()
+	l, ok := s.listings[key]
+	delete(s.listings, key)
+	s.mu.Unlock()
+
+	names := l.names
+	if !ok || r.Start == "" || l.next != r.Start {
+		names, err = s.walk(dir, walkDir, r.Prefix, r.Start)
+		if err != nil {
+			return ListPage{}, err
+		}
+	}
+
+	var page ListPage
+	for i, name := range names {
+		if r.Limit > 0 && i == r.Limit {
+			page.Next = name
+			s.mu.Lock()
+			s.listings[key] = fileListing{next: name, names: names[i:]}
+			s.mu.Unlock()
+			break
+		}
+		info, err := s.stat(filepath.Join(dir, filepath.FromSlash(name)), name)
+		if err == ErrObjectNotFound {
+			// Deleted since the walk
+			continue
+		}
+		if err != nil {
+			return ListPage{}, err
+		}
+		page.Objects = append(page.Objects, info)
+	}
+	return page, nil
+}
+
+// walk returns the sorted names of the files in walkDir that have prefix
+// and are not before start. Directories whose files are all left out are
+// skipped. A walk from the start forgets the MD5 of files with prefix that
+// are gone.
+func (s *fileObjectStore) walk(dir, walkDir, prefix, start string) ([]string, error) {
+	var names []string
+	seen := make(map[string]bool)
+	err := filepath.Walk(walkDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+
+		if info.IsDir() {
+			if p == walkDir {
+				return nil
+			}
+			// The names of the files below are name/...
+			name += "/"
+			if !strings.HasPrefix(name, prefix) && !strings.HasPrefix(prefix, name) ||
+				name < start && !strings.HasPrefix(start, name) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		if strings.HasPrefix(name, prefix) && name >= start {
+			names = append(names, name)
+			seen[p] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+
+	if start == "" {
+		bucketPrefix := dir + string(filepath.Separator)
+		s.mu.Lock()
+		for p := range s.sums {
+			if strings.HasPrefix(p, bucketPrefix) && strings.HasPrefix(filepath.ToSlash(p[len(bucketPrefix):]), prefix) && !seen[p] {
+				delete(s.sums, p)
+			}
+		}
+		s.mu.Unlock()
+	}
+	return names, nil
+}
+
+func (s *fileObjectStore) Head(ctx context.Context, namespace, bucket, name string) (ObjectInfo, error) {
+	p, err := s.objectPath(bucket, name)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return s.stat(p, name)
+}
+
+func (s *fileObjectStore) Get(ctx context.Context, namespace, bucket, name string) (ObjectInfo, io.ReadCloser, error) {
+	p, err := s.objectPath(bucket, name)
+	if err != nil {
+		return ObjectInfo{}, nil, err
+	}
+	info, err := s.stat(p, name)
+	if err != nil {
+		return ObjectInfo{}, nil, err
+	}
+	f, err := os.Open(p)
+	if os.IsNotExist(err) {
+		return ObjectInfo{}, nil, ErrObjectNotFound
+	}
+	if err != nil {
+		return ObjectInfo{}, nil, err
+	}
+	return info, f, nil
+}
+
+// stat returns the metadata of the file p. The MD5 is read from the cache
+// when the size and modification time of the file did not change.
+func (s *fileObjectStore) stat(p, name string) (ObjectInfo, error) {
+	fi, err := os.Stat(p)
+	if os.IsNotExist(err) || err == nil && !fi.Mode().IsRegular() {
+		return ObjectInfo{}, ErrObjectNotFound
+	}
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	info := ObjectInfo{
+		Name:        name,
+		Size:        fi.Size(),
+		TimeCreated: fi.ModTime(),
+	}
+
+	s.mu.Lock()
+	sum, ok := s.sums[p]
+	s.mu.Unlock()
+	if ok && sum.size == fi.Size() && sum.modTime.Equal(fi.ModTime()) {
+		info.MD5 = sum.md5
+		return info, nil
+	}
+
+	f, err := os.Open(p)
+	if os.IsNotExist(err) {
+		return ObjectInfo{}, ErrObjectNotFound
+	}
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	defer f.Close()
+	h := md5.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return ObjectInfo{}, err
+	}
+	info.MD5 = base64.StdEncoding.EncodeToString(h.Sum(nil))
+
+	s.mu.Lock()
+	s.sums[p] = fileSum{size: fi.Size(), modTime: fi.ModTime(), md5: info.MD5}
+	s.mu.Unlock()
+	return info, nil
+}
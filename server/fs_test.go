@@ -0,0 +1,264 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2017 Oracle and/or its affiliates.  All rights reserved.
+// This program is free software: you can modify it and/or redistribute it
+// under the terms of:
+//
+// (i)  the Universal Permissive License v 1.0 or at your option, any
+//      later version (http://oss.oracle.com/licenses/upl); and/or
+//
+// (ii) the Apache License v 2.0. (http://www.apache.org/licenses/LICENSE-2.0)
+//-----------------------------------------------------------------------------
+
+package server
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testRoot is the directory of the buckets of the tests. It is not the
+// current directory, which holds the snapshots of the watches.
+const testRoot = "root"
+
+// writeFile writes a file of the bucket in testRoot.
+func writeFile(t *testing.T, name, content string) {
+	p := filepath.Join(testRoot, testBucket, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func contentMD5(content string) string {
+	sum := md5.Sum([]byte(content))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func TestFileObjectStore(t *testing.T) {
+	defer inTempDir(t)()
+
+	for _, name := range []string{"a.txt", "a/b", "a/c/d", "e"} {
+		writeFile(t, name, name)
+	}
+	store, err := NewFileObjectStore(testRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	request := ListRequest{Bucket: testBucket, Limit: 2}
+	var names []string
+	for {
+		page, err := store.List(ctx, request)
+		if err != nil {
+			t.Fatalf("List failed: %v", err)
+		}
+		for _, o := range page.Objects {
+			if o.MD5 != contentMD5(o.Name) || o.Size != int64(len(o.Name)) {
+				t.Errorf("Unexpected metadata %+v", o)
+			}
+			names = append(names, o.Name)
+		}
+		if page.Next == "" {
+			break
+		}
+		request.Start = page.Next
+	}
+	if got := strings.Join(names, ","); got != "a.txt,a/b,a/c/d,e" {
+		t.Errorf("Expected the files in name order, got %s", got)
+	}
+
+	page, err := store.List(ctx, ListRequest{Bucket: testBucket, Prefix: "a/c/"})
+	if err != nil || len(page.Objects) != 1 || page.Objects[0].Name != "a/c/d" {
+		t.Errorf("Expected a/c/d, got %+v (%v)", page, err)
+	}
+	page, err = store.List(ctx, ListRequest{Bucket: testBucket, Prefix: "missing/"})
+	if err != nil || len(page.Objects) != 0 {
+		t.Errorf("Expected no objects, got %+v (%v)", page, err)
+	}
+
+	info, content, err := store.Get(ctx, "", testBucket, "a/b")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	b, err := ioutil.ReadAll(content)
+	content.Close()
+	if err != nil || string(b) != "a/b" || info.MD5 != contentMD5("a/b") {
+		t.Errorf("Unexpected object %+v %q (%v)", info, b, err)
+	}
+
+	// The hash follows changes to a file
+	writeFile(t, "e", "changed")
+	os.Chtimes(filepath.Join(testRoot, testBucket, "e"), time.Now(), time.Now().Add(time.Minute))
+	if info, err := store.Head(ctx, "", testBucket, "e"); err != nil || info.MD5 != contentMD5("changed") {
+		t.Errorf("Expected the hash of the new content, got %+v (%v)", info, err)
+	}
+
+	for _, name := range []string{"missing", "a", "../bucket/e", "a//b"} {
+		if _, err := store.Head(ctx, "", testBucket, name); err != ErrObjectNotFound {
+			t.Errorf("%s: expected ErrObjectNotFound, got %v", name, err)
+		}
+	}
+	for _, bucket := range []string{"missing", "..", "bucket/a"} {
+		if _, err := store.List(ctx, ListRequest{Bucket: bucket}); err == nil {
+			t.Errorf("%s: expected List to fail", bucket)
+		}
+	}
+}
+
+func TestFileObjectStorePrefixStaysInBucket(t *testing.T) {
+	defer inTempDir(t)()
+
+	writeFile(t, "a/b", "b")
+	if err := os.MkdirAll(filepath.Join(testRoot, "other"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(testRoot, "other", "secret"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewFileObjectStore(testRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, prefix := range []string{"../other/", "../../", "a/../../other/", "/../other/", "a//"} {
+		page, err := store.List(context.Background(), ListRequest{Bucket: testBucket, Prefix: prefix})
+		if err == nil {
+			t.Errorf("%s: expected List to fail, got %+v", prefix, page)
+		}
+	}
+}
+
+// listNames lists all pages of r and returns the names of the objects.
+func listNames(t *testing.T, store ObjectStore, r ListRequest) []string {
+	var names []string
+	for {
+		page, err := store.List(context.Background(), r)
+		if err != nil {
+			t.Fatalf("List failed: %v", err)
+		}
+		for _, o := range page.Objects {
+			names = append(names, o.Name)
+		}
+		if page.Next == "" {
+			return names
+		}
+		r.Start = page.Next
+	}
+}
+
+func TestFileObjectStoreListing(t *testing.T) {
+	defer inTempDir(t)()
+
+	// a-b comes before the files in a/
+	for _, name := range []string{"a-b", "a/b", "a/c/d", "b/e", "c"} {
+		writeFile(t, name, name)
+	}
+	store, err := NewFileObjectStore(testRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs := store.(*fileObjectStore)
+
+	// The names of the first page are kept for the next ones
+	page, err := store.List(context.Background(), ListRequest{Bucket: testBucket, Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := fs.listings[testBucket+"/"]; page.Next != "a/c/d" || l.next != "a/c/d" || len(l.names) != 3 {
+		t.Errorf("Expected the rest of the listing to be kept, got %+v %+v", page, l)
+	}
+	if got := strings.Join(listNames(t, store, ListRequest{Bucket: testBucket, Limit: 2}), ","); got != "a-b,a/b,a/c/d,b/e,c" {
+		t.Errorf("Expected the files in name order, got %s", got)
+	}
+	if len(fs.listings) != 0 {
+		t.Errorf("Expected finished listings to be forgotten, got %+v", fs.listings)
+	}
+
+	// A page that was not listed before skips the directories before Start
+	tests := []struct {
+		start    string
+		expected string
+	}{
+		{start: "a/b", expected: "a/b,a/c/d,b/e,c"},
+		{start: "a/c/d", expected: "a/c/d,b/e,c"},
+		{start: "a/d", expected: "b/e,c"},
+		{start: "b/", expected: "b/e,c"},
+		{start: "c", expected: "c"},
+	}
+	for _, test := range tests {
+		fresh, err := NewFileObjectStore(testRoot)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(listNames(t, fresh, ListRequest{Bucket: testBucket, Start: test.start}), ","); got != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.start, test.expected, got)
+		}
+	}
+
+	// The hashes of files that are gone are forgotten
+	if err := os.RemoveAll(filepath.Join(testRoot, testBucket, "a")); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(listNames(t, store, ListRequest{Bucket: testBucket}), ","); got != "a-b,b/e,c" {
+		t.Errorf("Expected the removed files to be gone, got %s", got)
+	}
+	if len(fs.sums) != 3 {
+		t.Errorf("Expected the hashes of the 3 files, got %+v", fs.sums)
+	}
+
+	// Only the files with the prefix are walked
+	if err := os.Remove(filepath.Join(testRoot, testBucket, "c")); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(listNames(t, store, ListRequest{Bucket: testBucket, Prefix: "b/"}), ","); got != "b/e" {
+		t.Errorf("Expected b/e, got %s", got)
+	}
+	if len(fs.sums) != 3 {
+		t.Errorf("Expected the hashes of files without the prefix to be kept, got %+v", fs.sums)
+	}
+}
+
+func TestWatcherFileStore(t *testing.T) {
+	defer inTempDir(t)()
+
+	hook := newHookRecorder()
+	defer hook.Close()
+
+	writeFile(t, "a", "a")
+	writeFile(t, "dir/b", "b")
+	store, err := NewFileObjectStore(testRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	o := NewObjectWatcher(store, Watch{Namespace: testNamespace, PollInterval: testPollInterval}, testDelivery)
+	defer o.Shutdown()
+	addWatch(t, o, Watch{WebhookURI: hook.URL})
+
+	calls := hook.waitFor(t, 2)
+	expectChanges(t, calls, "NEW a", "NEW dir/b")
+
+	writeFile(t, "a", "changed")
+	os.Chtimes(filepath.Join(testRoot, testBucket, "a"), time.Now(), time.Now().Add(time.Minute))
+	os.Remove(filepath.Join(testRoot, testBucket, "dir", "b"))
+
+	calls = hook.waitFor(t, 4)
+	expectChanges(t, calls[2:], "UPDATE a", "DELETE dir/b")
+	hook.expectNoMoreCalls(t, 4)
+
+	for _, c := range calls[2:] {
+		if c.Payload.Type == upd && c.Payload.ContentHash != contentMD5("changed") {
+			t.Errorf("Expected content hash %s, got %s", contentMD5("changed"), c.Payload.ContentHash)
+		}
+	}
+}
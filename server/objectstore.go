@@ -0,0 +1,220 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2017 Oracle and/or its affiliates.  All rights reserved.
+// This program is free software: you can modify it and/or redistribute it
+// under the terms of:
+//
+// (i)  the Universal Permissive License v 1.0 or at your option, any
+//      later version (http://oss.oracle.com/licenses/upl); and/or
+//
+// (ii) the Apache License v 2.0. (http://www.apache.org/licenses/LICENSE-2.0)
+//-----------------------------------------------------------------------------
+
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/oracle/oci-go-sdk/common"
+	"github.com/oracle/oci-go-sdk/objectstorage"
+)
+
+// ErrObjectNotFound is returned by Head and Get for objects that do not
+// exist.
+var ErrObjectNotFound = errors.New("object not found")
+
+// ObjectStore is the part of an object store the watcher depends on.
+type ObjectStore interface {
+	// List returns one page of the objects in a bucket, in name order.
+	List(ctx context.Context, r ListRequest) (ListPage, error)
+
+	// Head returns the metadata of an object.
+	Head(ctx context.Context, namespace, bucket, name string) (ObjectInfo, error)
+
+	// Get returns the metadata and the content of an object. The caller
+	// must close the content.
+	Get(ctx context.Context, namespace, bucket, name string) (ObjectInfo, io.ReadCloser, error)
+}
+
+// ListRequest selects a page of objects. Only objects whose name starts
+// with Prefix are included. Start is empty for the first page and the Next
+// of the previous page otherwise. Limit is a hint, stores may return smaller
+// pages.
+type ListRequest struct {
+	Namespace string
+	Bucket    string
+	Prefix    string
+	Start     string
+	Limit     int
+}
+
+// ListPage is a page of objects. Next is the Start of the next page, it is
+// empty on the last page. Stores decide what it holds, such as the name of
+// the next object or a continuation token.
+type ListPage struct {
+	Objects []ObjectInfo
+	Next    string
+}
+
+// ObjectInfo is the metadata of an object. Fields the store did not return
+// are left empty. StorageTier is the tier or storage class the object is
+// stored in, ArchivalState is set for archived objects of OCI Object Storage.
+type ObjectInfo struct {
+	Name          string
+	MD5           string
+	ETag          string
+	Size          int64
+	TimeCreated   time.Time
+	StorageTier   string
+	ArchivalState string
+}
+
+// ociObjectStore is the ObjectStore of an OCI Object Storage client.
+type ociObjectStore struct {
+	client objectstorage.ObjectStorageClient
+}
+
+// NewOCIObjectStore returns an ObjectStore that uses client.
+func NewOCIObjectStore(client objectstorage.ObjectStorageClient) ObjectStore {
+	return &ociObjectStore{client: client}
+}
+
+func (s *ociObjectStore) List(ctx context.Context, r ListRequest) (ListPage, error) {
+	listRequest := objectstorage.ListObjectsRequest{
+		NamespaceName: &r.Namespace,
+		BucketName:    &r.Bucket,
+		Fields:        "name,size,etag,md5,timeCreated,storageTier,archivalState",
+		Start:         &r.Start,
+	}
+	if r.Prefix != "" {
+		listRequest.Prefix = &r.Prefix
+	}
+	if r.Limit > 0 {
+		listRequest.Limit = &r.Limit
+	}
+
+	// ObjectSummary of this SDK version has no etag nor storage tier, so the
+	// request is made here to read them.
+	request, err := common.MakeDefaultHTTPRequestWithTaggedStruct(http.MethodGet, "/n/{namespaceName}/b/{bucketName}/o", listRequest)
+	if err != nil {
+		return ListPage{}, err
+	}
+
+	httpResponse, err := s.client.Call(ctx, &request)
+	defer common.CloseBodyIfValid(httpResponse)
+	if err != nil {
+		return ListPage{}, err
+	}
+
+	var response listObjectsResponse
+	if err := common.UnmarshalResponse(httpResponse, &response); err != nil {
+		return ListPage{}, err
+	}
+
+	page := ListPage{Objects: make([]ObjectInfo, 0, len(response.ListObjects.Objects))}
+	for _, object := range response.ListObjects.Objects {
+		info := ObjectInfo{
+			Name:          object.Name,
+			MD5:           object.Md5,
+			ETag:          object.Etag,
+			StorageTier:   object.StorageTier,
+			ArchivalState: object.ArchivalState,
+		}
+		if object.Size != nil {
+			info.Size = *object.Size
+		}
+		if object.TimeCreated != nil {
+			info.TimeCreated = object.TimeCreated.Time
+		}
+		page.Objects = append(page.Objects, info)
+	}
+	page.Next = response.ListObjects.NextStartWith
+	return page, nil
+}
+
+// listObjectsResponse is the response of ListObjects with the fields that
+// objectstorage.ObjectSummary is missing.
+type listObjectsResponse struct {
+	ListObjects struct {
+		Objects []struct {
+			Name          string          `json:"name"`
+			Size          *int64          `json:"size"`
+			Md5           string          `json:"md5"`
+			Etag          string          `json:"etag"`
+			TimeCreated   *common.SDKTime `json:"timeCreated"`
+			StorageTier   string          `json:"storageTier"`
+			ArchivalState string          `json:"archivalState"`
+		} `json:"objects"`
+		NextStartWith string `json:"nextStartWith"`
+	} `presentIn:"body"`
+}
+
+func (s *ociObjectStore) Head(ctx context.Context, namespace, bucket, name string) (ObjectInfo, error) {
+	// HeadObject of this SDK version drops the response, so the request is
+	// made here to read the headers.
+	request, err := common.MakeDefaultHTTPRequestWithTaggedStruct(http.MethodHead, "/n/{namespaceName}/b/{bucketName}/o/{objectName}", objectstorage.HeadObjectRequest{
+		NamespaceName: &namespace,
+		BucketName:    &bucket,
+		ObjectName:    &name,
+	})
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	httpResponse, err := s.client.Call(ctx, &request)
+	defer common.CloseBodyIfValid(httpResponse)
+	if err != nil {
+		return ObjectInfo{}, objectError(err)
+	}
+
+	var response objectstorage.GetObjectResponse
+	if err := common.UnmarshalResponse(httpResponse, &response); err != nil {
+		return ObjectInfo{}, err
+	}
+	return objectInfo(name, response), nil
+}
+
+func (s *ociObjectStore) Get(ctx context.Context, namespace, bucket, name string) (ObjectInfo, io.ReadCloser, error) {
+	response, err := s.client.GetObject(ctx, objectstorage.GetObjectRequest{
+		NamespaceName: &namespace,
+		BucketName:    &bucket,
+		ObjectName:    &name,
+	})
+	if err != nil {
+		common.CloseBodyIfValid(response.RawResponse)
+		return ObjectInfo{}, nil, objectError(err)
+	}
+	return objectInfo(name, response), response.Content, nil
+}
+
+// objectInfo returns the metadata from the headers of a GetObject or
+// HeadObject response.
+func objectInfo(name string, r objectstorage.GetObjectResponse) ObjectInfo {
+	info := ObjectInfo{Name: name}
+	if r.ContentMd5 != nil {
+		info.MD5 = *r.ContentMd5
+	} else if r.OpcMultipartMd5 != nil {
+		info.MD5 = *r.OpcMultipartMd5
+	}
+	if r.ETag != nil {
+		info.ETag = *r.ETag
+	}
+	if r.ContentLength != nil {
+		info.Size = int64(*r.ContentLength)
+	}
+	if r.LastModified != nil {
+		info.TimeCreated = r.LastModified.Time
+	}
+	return info
+}
+
+// objectError maps a 404 from the object store to ErrObjectNotFound.
+func objectError(err error) error {
+	if failure, ok := common.IsServiceError(err); ok && failure.GetHTTPStatusCode() == http.StatusNotFound {
+		return ErrObjectNotFound
+	}
+	return err
+}
@@ -0,0 +1,201 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2017 Oracle and/or its affiliates.  All rights reserved.
+// This program is free software: you can modify it and/or redistribute it
+// under the terms of:
+//
+// (i)  the Universal Permissive License v 1.0 or at your option, any
+//      later version (http://oss.oracle.com/licenses/upl); and/or
+//
+// (ii) the Apache License v 2.0. (http://www.apache.org/licenses/LICENSE-2.0)
+//-----------------------------------------------------------------------------
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fnproject/oci-objectstore-watcher/objectstoretest"
+)
+
+// memoryStore is an ObjectStore of a single bucket that returns pages of
+// pageSize objects.
+type memoryStore struct {
+	objects  map[string]string
+	pageSize int
+}
+
+func (s *memoryStore) List(ctx context.Context, r ListRequest) (ListPage, error) {
+	var names []string
+	for name := range s.objects {
+		if strings.HasPrefix(name, r.Prefix) && name >= r.Start {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var page ListPage
+	for i, name := range names {
+		if i == s.pageSize {
+			page.Next = name
+			break
+		}
+		page.Objects = append(page.Objects, ObjectInfo{Name: name, MD5: s.objects[name]})
+	}
+	return page, nil
+}
+
+func (s *memoryStore) Head(ctx context.Context, namespace, bucket, name string) (ObjectInfo, error) {
+	md5, ok := s.objects[name]
+	if !ok {
+		return ObjectInfo{}, ErrObjectNotFound
+	}
+	return ObjectInfo{Name: name, MD5: md5}, nil
+}
+
+func (s *memoryStore) Get(ctx context.Context, namespace, bucket, name string) (ObjectInfo, io.ReadCloser, error) {
+	info, err := s.Head(ctx, namespace, bucket, name)
+	if err != nil {
+		return ObjectInfo{}, nil, err
+	}
+	return info, ioutil.NopCloser(bytes.NewReader(nil)), nil
+}
+
+func TestListAndDiff(t *testing.T) {
+	store := &memoryStore{
+		objects: map[string]string{
+			"uploads/a.csv": "1",
+			"uploads/b.csv": "2",
+			"uploads/c.log": "3",
+			"uploads/d.csv": "4",
+			"logs/e.csv":    "5",
+		},
+		pageSize: 1,
+	}
+	w := Watch{Namespace: "ns", Bucket: "bucket", Prefix: "uploads/", Include: []string{"*.csv"}}
+
+	filter, err := newObjectFilter(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	objects, err := list(context.Background(), store, w, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 3 || objects["uploads/d.csv"].MD5 != "4" {
+		t.Fatalf("Expected the 3 csv uploads, got %v", objects)
+	}
+
+	cache := knownObjects{md5s: map[string]string{
+		"uploads/a.csv": "1",
+		"uploads/b.csv": "old",
+		"uploads/z.csv": "9",
+		"logs/e.csv":    "5",
+	}}
+	var got []string
+	for _, p := range diff(w, filter, cache, objects) {
+		got = append(got, p.Type+" "+p.ObjectName)
+	}
+	sort.Strings(got)
+
+	expected := []string{"DELETE uploads/z.csv", "NEW uploads/d.csv", "UPDATE uploads/b.csv"}
+	if strings.Join(got, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
+
+func TestDiffETags(t *testing.T) {
+	w := Watch{Namespace: "ns", Bucket: "bucket"}
+	filter, err := newObjectFilter(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	created := time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)
+	cache := knownObjects{
+		md5s:  map[string]string{"a": "1", "b": "2", "c": "3"},
+		etags: map[string]string{"a": "etag-1", "b": "etag-2"},
+	}
+	objects := map[string]ObjectInfo{
+		"a": {Name: "a", MD5: "1", ETag: "etag-1"},
+		"b": {Name: "b", MD5: "2", ETag: "etag-9", Size: 42, TimeCreated: created, StorageTier: "Standard"},
+		// Objects committed without an ETag are compared by MD5 only
+		"c": {Name: "c", MD5: "3", ETag: "etag-3"},
+	}
+
+	changes := diff(w, filter, cache, objects)
+	if len(changes) != 1 {
+		t.Fatalf("Expected only b to be updated, got %v", changes)
+	}
+	expected := Payload{
+		Namespace:   "ns",
+		Bucket:      "bucket",
+		ObjectName:  "b",
+		ContentHash: "2",
+		Type:        upd,
+		Size:        42,
+		ETag:        "etag-9",
+		TimeCreated: "2018-01-02T03:04:05Z",
+		StorageTier: "Standard",
+	}
+	if changes[0] != expected {
+		t.Errorf("Expected %+v, got %+v", expected, changes[0])
+	}
+}
+
+func TestOCIObjectStore(t *testing.T) {
+	s := objectstoretest.NewServer()
+	defer s.Close()
+	client, err := s.Client()
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewOCIObjectStore(client)
+	ctx := context.Background()
+
+	s.PutObject("ns", "bucket", "a", []byte("hello"))
+	object, _ := s.Object("ns", "bucket", "a")
+
+	info, err := store.Head(ctx, "ns", "bucket", "a")
+	if err != nil {
+		t.Fatalf("Head failed: %v", err)
+	}
+	if info.MD5 != object.MD5 || info.ETag != object.ETag || info.Size != 5 {
+		t.Errorf("Unexpected metadata %+v", info)
+	}
+
+	info, content, err := store.Get(ctx, "ns", "bucket", "a")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	b, err := ioutil.ReadAll(content)
+	content.Close()
+	if err != nil || string(b) != "hello" || info.MD5 != object.MD5 {
+		t.Errorf("Unexpected object %+v %q (%v)", info, b, err)
+	}
+
+	page, err := store.List(ctx, ListRequest{Namespace: "ns", Bucket: "bucket"})
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(page.Objects) != 1 {
+		t.Fatalf("Expected 1 object, got %+v", page.Objects)
+	}
+	listed := page.Objects[0]
+	if listed.MD5 != object.MD5 || listed.ETag != object.ETag || listed.Size != 5 || listed.StorageTier != "Standard" || listed.TimeCreated.IsZero() {
+		t.Errorf("Unexpected metadata %+v", listed)
+	}
+
+	if _, err := store.Head(ctx, "ns", "bucket", "missing"); err != ErrObjectNotFound {
+		t.Errorf("Expected ErrObjectNotFound, got %v", err)
+	}
+	if _, _, err := store.Get(ctx, "ns", "bucket", "missing"); err != ErrObjectNotFound {
+		t.Errorf("Expected ErrObjectNotFound, got %v", err)
+	}
+}
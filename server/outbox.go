@@ -0,0 +1,227 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2017 Oracle and/or its affiliates.  All rights reserved.
+// This program is free software: you can modify it and/or redistribute it
+// under the terms of:
+//
+// (i)  the Universal Permissive License v 1.0 or at your option, any
+//      later version (http://oss.oracle.com/licenses/upl); and/or
+//
+// (ii) the Apache License v 2.0. (http://www.apache.org/licenses/LICENSE-2.0)
+//-----------------------------------------------------------------------------
+
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/wercker/pkg/log"
+)
+
+// ackBatch is the number of delivered changes after which the outbox is
+// persisted, even when it is not drained yet. Changes that were delivered
+// but not persisted as such are delivered again after a crash.
+const ackBatch = 100
+
+// watchState is the in-memory copy of the snapshot of a watch. The poller
+// appends changes to the outbox, once for every sink of the watch. Every sink
+// has its own dispatcher which removes its changes once they are delivered,
+// so a failing sink does not hold up the others.
+type watchState struct {
+	id        string
+	snapshots snapshotStore
+
+	mu      sync.Mutex
+	objects knownObjects
+	initial bool
+	outbox  []outboxEntry
+	acked   int
+
+	// pending is closed and replaced when changes are added to the outbox.
+	pending chan struct{}
+}
+
+// loadWatchState loads the snapshot of watch id from snapshots. Changes for sinks that are
+// no longer configured are dropped, changes saved before the watch had sinks
+// are sent to all of them.
+func loadWatchState(snapshots snapshotStore, id string, sinks []string) (*watchState, error) {
+	s, err := snapshots.load(id)
+	if err != nil {
+		return nil, err
+	}
+
+	configured := make(map[string]bool, len(sinks))
+	for _, sink := range sinks {
+		configured[sink] = true
+	}
+
+	var outbox []outboxEntry
+	for _, e := range s.Outbox {
+		switch {
+		case e.Sink == "":
+			for _, sink := range sinks {
+				e.Sink = sink
+				outbox = append(outbox, e)
+			}
+		case configured[e.Sink]:
+			outbox = append(outbox, e)
+		default:
+			log.WithField("watch", id).WithField("sink", e.Sink).WithField("object", e.Payload.ObjectName).Warn("Dropping change for a sink that is no longer configured")
+		}
+	}
+
+	return &watchState{
+		id:        id,
+		snapshots: snapshots,
+		objects:   knownObjects{md5s: s.Objects, etags: s.ETags},
+		initial:   s.Initial,
+		outbox:    outbox,
+		pending:   make(chan struct{}),
+	}, nil
+}
+
+// commit replaces the known objects and appends changes to the outbox of
+// every sink. Both are persisted before they are applied, if that fails
+// nothing changes and the same changes will be detected on the next poll.
+// The committed changes are returned with their delivery ID. Once committed
+// the objects are no longer initial.
+func (st *watchState) commit(objects knownObjects, changes []Payload, sinks []string) ([]Change, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	outbox := make([]outboxEntry, len(st.outbox), len(st.outbox)+len(changes)*len(sinks))
+	copy(outbox, st.outbox)
+	committed := make([]Change, 0, len(changes))
+	now := time.Now()
+	for _, p := range changes {
+		c := Change{DeliveryID: newDeliveryID(), Time: now, Payload: p}
+		committed = append(committed, c)
+		for _, sink := range sinks {
+			outbox = append(outbox, outboxEntry{Sink: sink, DeliveryID: c.DeliveryID, Time: now, Payload: p})
+		}
+	}
+
+	err := st.snapshots.save(st.id, &snapshot{Objects: objects.md5s, ETags: objects.etags, Outbox: outbox})
+	if err != nil {
+		return nil, err
+	}
+
+	st.objects = objects
+	st.initial = false
+	st.outbox = outbox
+	st.acked = 0
+
+	close(st.pending)
+	st.pending = make(chan struct{})
+	return committed, nil
+}
+
+// known returns the objects that were last committed, which must not be
+// modified, and whether they are initial: the bucket was not listed yet.
+func (st *watchState) known() (knownObjects, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.objects, st.initial
+}
+
+// next returns the oldest change in the outbox of sink. If there is none, the
+// returned channel is closed once changes are committed.
+func (st *watchState) next(sink string) (outboxEntry, bool, <-chan struct{}) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	for _, e := range st.outbox {
+		if e.Sink == sink {
+			return e, true, nil
+		}
+	}
+	return outboxEntry{}, false, st.pending
+}
+
+// ack removes e from the outbox after it was delivered.
+func (st *watchState) ack(e outboxEntry) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	for i, o := range st.outbox {
+		if o.Sink == e.Sink && o.DeliveryID == e.DeliveryID {
+			st.outbox = append(st.outbox[:i], st.outbox[i+1:]...)
+			break
+		}
+	}
+	st.acked++
+	if len(st.outbox) > 0 && st.acked < ackBatch {
+		return nil
+	}
+
+	st.acked = 0
+	return st.snapshots.save(st.id, &snapshot{Objects: st.objects.md5s, ETags: st.objects.etags, Initial: st.initial, Outbox: st.outbox})
+}
+
+// flush persists changes that were acknowledged since the outbox was last
+// saved.
+func (st *watchState) flush() error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.acked == 0 {
+		return nil
+	}
+
+	st.acked = 0
+	return st.snapshots.save(st.id, &snapshot{Objects: st.objects.md5s, ETags: st.objects.etags, Initial: st.initial, Outbox: st.outbox})
+}
+
+// dispatch sends the changes in the outbox of st for the sink configured as
+// spec, oldest first, until lw is stopped. A change stays in the outbox until
+// it is delivered, so every change is delivered at least once and in order,
+// unless the sink rejects it for good or the attempts of the delivery options
+// are used up. Such a change is logged and dropped.
+func (o *ObjectWatcher) dispatch(lw *liveWatch, st *watchState, spec string, sink Sink) {
+	failures := 0
+	for {
+		e, ok, pending := st.next(spec)
+		if !ok {
+			select {
+			case <-pending:
+				continue
+			case <-lw.ctx.Done():
+				return
+			}
+		}
+
+		// A change that was delivered while stopping is still removed, so
+		// it is not sent again after a restart
+		err := sink.Send(lw.ctx, e.change())
+		if err != nil && lw.ctx.Err() != nil {
+			return
+		}
+
+		if err != nil {
+			failures++
+			if permanent(err) || (o.deliverer.opts.Attempts > 0 && failures >= o.deliverer.opts.Attempts) {
+				// Keeping the change would hold up every change after it
+				log.WithField("watch", st.id).WithField("sink", spec).WithField("object", e.Payload.ObjectName).WithField("type", e.Payload.Type).WithField("delivery", e.DeliveryID).WithField("attempts", failures).WithError(err).Error("Dropping change that cannot be delivered")
+				failures = 0
+				if err := st.ack(e); err != nil {
+					log.WithField("watch", st.id).WithError(err).Error("Unable to save outbox, dropped changes may be sent again after a restart")
+				}
+				continue
+			}
+
+			wait := o.deliverer.backoff(failures - 1)
+			log.WithField("watch", st.id).WithField("sink", spec).WithField("object", e.Payload.ObjectName).WithError(err).Errorf("Unable to deliver change, trying again in %v", wait)
+			select {
+			case <-time.After(wait):
+			case <-lw.ctx.Done():
+				return
+			}
+			continue
+		}
+
+		failures = 0
+		if err := st.ack(e); err != nil {
+			log.WithField("watch", st.id).WithError(err).Error("Unable to save outbox, delivered changes may be sent again after a restart")
+		}
+	}
+}
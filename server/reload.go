@@ -0,0 +1,172 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2017 Oracle and/or its affiliates.  All rights reserved.
+// This program is free software: you can modify it and/or redistribute it
+// under the terms of:
+//
+// (i)  the Universal Permissive License v 1.0 or at your option, any
+//      later version (http://oss.oracle.com/licenses/upl); and/or
+//
+// (ii) the Apache License v 2.0. (http://www.apache.org/licenses/LICENSE-2.0)
+//-----------------------------------------------------------------------------
+
+package server
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/wercker/pkg/log"
+)
+
+// ConfigReloader keeps the watches of an ObjectWatcher in sync with a
+// configuration file. Only watches that were started from the file are
+// changed, watches added through the API are left alone.
+type ConfigReloader struct {
+	watcher  *ObjectWatcher
+	path     string
+	defaults Watch
+
+	mu      sync.Mutex
+	managed map[string]Watch
+	modTime time.Time
+}
+
+// NewConfigReloader creates a ConfigReloader for the configuration file at
+// path, see LoadConfig for defaults.
+func NewConfigReloader(watcher *ObjectWatcher, path string, defaults Watch) *ConfigReloader {
+	r := &ConfigReloader{
+		watcher:  watcher,
+		path:     path,
+		defaults: defaults,
+		managed:  make(map[string]Watch),
+	}
+	if fi, err := os.Stat(path); err == nil {
+		r.modTime = fi.ModTime()
+	}
+	return r
+}
+
+// Reload reads the configuration file and applies it. The running watches
+// are kept if the file is invalid.
+func (r *ConfigReloader) Reload() error {
+	if fi, err := os.Stat(r.path); err == nil {
+		r.mu.Lock()
+		r.modTime = fi.ModTime()
+		r.mu.Unlock()
+	}
+
+	watches, err := LoadConfig(r.path, r.defaults)
+	if err != nil {
+		return err
+	}
+	return r.Apply(watches)
+}
+
+// Apply starts the watches that are new, updates the ones that changed and
+// stops the ones that are gone since the last time. Watches that stay keep
+// their cache. Every watch is applied, the first error is returned.
+func (r *ConfigReloader) Apply(watches []Watch) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var first error
+	fail := func(id string, err error) {
+		log.WithField("watch", id).WithError(err).Error("Unable to apply watch from config")
+		if first == nil {
+			first = fmt.Errorf("watch %s: %v", id, err)
+		}
+	}
+
+	next := make(map[string]bool, len(watches))
+	for _, w := range watches {
+		next[w.ID] = true
+	}
+
+	for id := range r.managed {
+		if next[id] {
+			continue
+		}
+		if err := r.watcher.Remove(id); err != nil && err != ErrWatchNotFound {
+			fail(id, err)
+			continue
+		}
+		delete(r.managed, id)
+	}
+
+	for _, w := range watches {
+		old, ok := r.managed[w.ID]
+		switch {
+		case !ok:
+			_, err := r.watcher.Add(w)
+			if err == ErrWatchExists {
+				err = fmt.Errorf("%v and was not started from the config", err)
+			}
+			if err != nil {
+				fail(w.ID, err)
+				continue
+			}
+		case !reflect.DeepEqual(old, w):
+			_, err := r.watcher.Update(w)
+			if err == ErrWatchNotFound {
+				// It was removed through the API in the meantime
+				_, err = r.watcher.Add(w)
+			}
+			if err != nil {
+				fail(w.ID, err)
+				continue
+			}
+		default:
+			continue
+		}
+		r.managed[w.ID] = w
+	}
+
+	return first
+}
+
+// Run reloads the configuration file whenever a value is received on reload
+// and whenever its modification time changes, which is checked every
+// interval. Checking the file is disabled if interval is zero. Run returns
+// when stop is closed.
+func (r *ConfigReloader) Run(reload <-chan os.Signal, interval time.Duration, stop <-chan struct{}) {
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-reload:
+			log.WithField("config", r.path).Info("Reloading config")
+		case <-tick:
+			if !r.modified() {
+				continue
+			}
+			log.WithField("config", r.path).Info("Config changed, reloading")
+		case <-stop:
+			return
+		}
+
+		if err := r.Reload(); err != nil {
+			log.WithField("config", r.path).WithError(err).Error("Unable to reload config")
+		}
+	}
+}
+
+// modified returns true if the modification time of the configuration file
+// changed since it was last read.
+func (r *ConfigReloader) modified() bool {
+	fi, err := os.Stat(r.path)
+	if err != nil {
+		return false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return !fi.ModTime().Equal(r.modTime)
+}
@@ -0,0 +1,156 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2017 Oracle and/or its affiliates.  All rights reserved.
+// This program is free software: you can modify it and/or redistribute it
+// under the terms of:
+//
+// (i)  the Universal Permissive License v 1.0 or at your option, any
+//      later version (http://oss.oracle.com/licenses/upl); and/or
+//
+// (ii) the Apache License v 2.0. (http://www.apache.org/licenses/LICENSE-2.0)
+//-----------------------------------------------------------------------------
+
+package server
+
+import (
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/fnproject/oci-objectstore-watcher/objectstoretest"
+)
+
+// liveWatchOf returns the running watch id of o, nil if there is none.
+func liveWatchOf(o *ObjectWatcher, id string) *liveWatch {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.watches[id]
+}
+
+func TestConfigReloaderApply(t *testing.T) {
+	defer inTempDir(t)()
+
+	store := objectstoretest.NewServer()
+	defer store.Close()
+	hook := newHookRecorder()
+	defer hook.Close()
+
+	store.PutObject(testNamespace, testBucket, "a", []byte("a"))
+	store.PutObject(testNamespace, "other", "b", []byte("b"))
+	store.PutObject(testNamespace, "moved", "c", []byte("c"))
+
+	o := newTestWatcher(t, store)
+	defer o.Shutdown()
+	addWatch(t, o, Watch{ID: "api", WebhookURI: hook.URL})
+	r := NewConfigReloader(o, "config.yml", Watch{})
+
+	one := Watch{ID: "one", Namespace: testNamespace, Bucket: testBucket, PollInterval: testPollInterval, WebhookURI: hook.URL}
+	two := Watch{ID: "two", Namespace: testNamespace, Bucket: "other", PollInterval: testPollInterval, WebhookURI: hook.URL}
+	if err := r.Apply([]Watch{one, two}); err != nil {
+		t.Fatal(err)
+	}
+	expectChanges(t, hook.waitFor(t, 3), "NEW a", "NEW a", "NEW b")
+	running := liveWatchOf(o, "one")
+
+	// Moving a watch to another bucket used to deadlock the watcher
+	two.Bucket = "moved"
+	withinTimeout(t, "Apply", func() {
+		if err := r.Apply([]Watch{one, two}); err != nil {
+			t.Error(err)
+		}
+	})
+	expectChanges(t, hook.waitFor(t, 4)[3:], "NEW c")
+	if w, err := o.Get("two"); err != nil || w.Bucket != "moved" {
+		t.Errorf("Expected two to be moved, got %+v (%v)", w, err)
+	}
+	if liveWatchOf(o, "one") != running {
+		t.Error("Expected the unchanged watch to keep running")
+	}
+
+	// Watches that are gone from the config are removed, the ones added
+	// through the API are left alone
+	if err := r.Apply([]Watch{one}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := o.Get("two"); err != ErrWatchNotFound {
+		t.Errorf("Expected two to be removed, got %v", err)
+	}
+	if liveWatchOf(o, "one") != running {
+		t.Error("Expected the unchanged watch to keep running")
+	}
+	if _, err := o.Get("api"); err != nil {
+		t.Errorf("Expected the watch of the API to be kept, got %v", err)
+	}
+	hook.expectNoMoreCalls(t, 4)
+}
+
+func TestConfigReloaderApplyKeepsAPIWatches(t *testing.T) {
+	defer inTempDir(t)()
+
+	store := objectstoretest.NewServer()
+	defer store.Close()
+
+	o := newTestWatcher(t, store)
+	defer o.Shutdown()
+	addWatch(t, o, Watch{ID: "api", Sinks: []string{"stdout"}})
+	r := NewConfigReloader(o, "config.yml", Watch{})
+
+	// A watch of the config cannot replace one of the API, the others are
+	// still applied
+	err := r.Apply([]Watch{
+		{ID: "api", Namespace: testNamespace, Bucket: "other", Sinks: []string{"stdout"}},
+		{ID: "one", Namespace: testNamespace, Bucket: testBucket, Sinks: []string{"stdout"}},
+	})
+	if err == nil {
+		t.Error("Expected the watch of the API to be reported")
+	}
+	if w, err := o.Get("api"); err != nil || w.Bucket != testBucket {
+		t.Errorf("Expected the watch of the API to be kept, got %+v (%v)", w, err)
+	}
+	if _, err := o.Get("one"); err != nil {
+		t.Errorf("Expected one to be added, got %v", err)
+	}
+
+	// It is not removed with the config either
+	if err := r.Apply(nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := o.Get("api"); err != nil {
+		t.Errorf("Expected the watch of the API to be kept, got %v", err)
+	}
+	if _, err := o.Get("one"); err != ErrWatchNotFound {
+		t.Errorf("Expected one to be removed, got %v", err)
+	}
+}
+
+func TestConfigReloaderReload(t *testing.T) {
+	defer inTempDir(t)()
+
+	store := objectstoretest.NewServer()
+	defer store.Close()
+
+	o := newTestWatcher(t, store)
+	defer o.Shutdown()
+	r := NewConfigReloader(o, "config.yml", Watch{Namespace: testNamespace, PollInterval: testPollInterval, Sinks: []string{"stdout"}})
+
+	writeConfig := func(config string) {
+		if err := ioutil.WriteFile("config.yml", []byte(config), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeConfig(fmt.Sprintf("watches:\n- id: one\n  bucket: %s\n", testBucket))
+	if err := r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if w, err := o.Get("one"); err != nil || w.Bucket != testBucket || len(w.Sinks) != 1 || w.Sinks[0] != "stdout" {
+		t.Errorf("Expected one with the defaults, got %+v (%v)", w, err)
+	}
+
+	// The running watches are kept if the file is invalid
+	writeConfig("watches:\n- id: one\n")
+	if err := r.Reload(); err == nil {
+		t.Error("Expected an invalid config to be rejected")
+	}
+	if _, err := o.Get("one"); err != nil {
+		t.Errorf("Expected one to be kept, got %v", err)
+	}
+}
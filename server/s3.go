@@ -0,0 +1,337 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2017 Oracle and/or its affiliates.  All rights reserved.
+// This program is free software: you can modify it and/or redistribute it
+// under the terms of:
+//
+// (i)  the Universal Permissive License v 1.0 or at your option, any
+//      later version (http://oss.oracle.com/licenses/upl); and/or
+//
+// (ii) the Apache License v 2.0. (http://www.apache.org/licenses/LICENSE-2.0)
+//-----------------------------------------------------------------------------
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// S3Options configures an S3 compatible object store, such as the Amazon
+// S3 Compatibility API of OCI Object Storage or MinIO.
+type S3Options struct {
+	// Endpoint is the url of the store, for OCI it is
+	// https://<namespace>.compat.objectstorage.<region>.oraclecloud.com.
+	// Buckets are addressed in the path.
+	Endpoint string
+
+	// Region is used to sign requests, for OCI it is the OCI region.
+	Region string
+
+	AccessKey string
+	SecretKey string
+}
+
+// DefaultS3Region is the region used when S3Options has none.
+const DefaultS3Region = "us-east-1"
+
+// emptySHA256 is the hash of the empty body of every request.
+const emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// s3ObjectStore is the ObjectStore of an S3 compatible object store. The
+// namespace of watches is not used, buckets are looked up by name.
+type s3ObjectStore struct {
+	opts     S3Options
+	endpoint *url.URL
+	client   *http.Client
+}
+
+// NewS3ObjectStore returns an ObjectStore that uses the S3 ListObjectsV2,
+// HeadObject and GetObject calls, signed with AWS Signature Version 4.
+func NewS3ObjectStore(opts S3Options) (ObjectStore, error) {
+	u, err := url.Parse(opts.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid s3 endpoint - %v", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("invalid s3 endpoint %q, must be an http or https url", opts.Endpoint)
+	}
+	if opts.AccessKey == "" || opts.SecretKey == "" {
+		return nil, errors.New("access key and secret key are required for s3")
+	}
+	if opts.Region == "" {
+		opts.Region = DefaultS3Region
+	}
+
+	return &s3ObjectStore{
+		opts:     opts,
+		endpoint: u,
+		client:   &http.Client{},
+	}, nil
+}
+
+// s3Error is an error response of an S3 compatible store.
+type s3Error struct {
+	Status  int    `xml:"-"`
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+func (e *s3Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("s3 request failed with status %d", e.Status)
+	}
+	return fmt.Sprintf("s3 request failed with status %d: %s: %s", e.Status, e.Code, e.Message)
+}
+
+// listBucketResult is the response of ListObjectsV2.
+type listBucketResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		ETag         string    `xml:"ETag"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+		StorageClass string    `xml:"StorageClass"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// List returns a page of objects. The Start of the request is the
+// continuation token of the previous page.
+func (s *s3ObjectStore) List(ctx context.Context, r ListRequest) (ListPage, error) {
+	query := url.Values{"list-type": {"2"}}
+	if r.Prefix != "" {
+		query.Set("prefix", r.Prefix)
+	}
+	if r.Start != "" {
+		query.Set("continuation-token", r.Start)
+	}
+	if r.Limit > 0 {
+		query.Set("max-keys", strconv.Itoa(r.Limit))
+	}
+
+	res, err := s.do(ctx, http.MethodGet, r.Bucket, "", query)
+	if err != nil {
+		return ListPage{}, err
+	}
+	defer res.Body.Close()
+
+	var result listBucketResult
+	if err := xml.NewDecoder(res.Body).Decode(&result); err != nil {
+		return ListPage{}, fmt.Errorf("invalid s3 list response - %v", err)
+	}
+
+	page := ListPage{Objects: make([]ObjectInfo, 0, len(result.Contents))}
+	for _, c := range result.Contents {
+		etag := strings.Trim(c.ETag, `"`)
+		page.Objects = append(page.Objects, ObjectInfo{
+			Name:        c.Key,
+			MD5:         etagMD5(etag),
+			ETag:        etag,
+			Size:        c.Size,
+			TimeCreated: c.LastModified,
+			StorageTier: c.StorageClass,
+		})
+	}
+	if result.IsTruncated {
+		page.Next = result.NextContinuationToken
+	}
+	return page, nil
+}
+
+func (s *s3ObjectStore) Head(ctx context.Context, namespace, bucket, name string) (ObjectInfo, error) {
+	res, err := s.do(ctx, http.MethodHead, bucket, name, nil)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	res.Body.Close()
+	return s3ObjectInfo(name, res), nil
+}
+
+func (s *s3ObjectStore) Get(ctx context.Context, namespace, bucket, name string) (ObjectInfo, io.ReadCloser, error) {
+	res, err := s.do(ctx, http.MethodGet, bucket, name, nil)
+	if err != nil {
+		return ObjectInfo{}, nil, err
+	}
+	return s3ObjectInfo(name, res), res.Body, nil
+}
+
+// do sends a signed request for bucket, or an object in it. A 404 for an
+// object is returned as ErrObjectNotFound, any other failure as an s3Error.
+func (s *s3ObjectStore) do(ctx context.Context, method, bucket, object string, query url.Values) (*http.Response, error) {
+	u := *s.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + bucket
+	if object != "" {
+		u.Path += "/" + object
+	}
+	u.RawPath = s3Escape(u.Path, false)
+	u.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequest(method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	signV4(req, s.opts.AccessKey, s.opts.SecretKey, s.opts.Region, time.Now())
+
+	res, err := s.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return res, nil
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound && object != "" {
+		return nil, ErrObjectNotFound
+	}
+	failure := &s3Error{Status: res.StatusCode}
+	if b, err := ioutil.ReadAll(io.LimitReader(res.Body, 64*1024)); err == nil {
+		xml.Unmarshal(b, failure)
+	}
+	return nil, failure
+}
+
+// s3ObjectInfo returns the metadata from the headers of a HeadObject or
+// GetObject response.
+func s3ObjectInfo(name string, res *http.Response) ObjectInfo {
+	etag := strings.Trim(res.Header.Get("ETag"), `"`)
+	info := ObjectInfo{
+		Name: name,
+		MD5:  etagMD5(etag),
+		ETag: etag,
+		Size: res.ContentLength,
+	}
+	if t, err := http.ParseTime(res.Header.Get("Last-Modified")); err == nil {
+		info.TimeCreated = t
+	}
+	return info
+}
+
+// etagMD5 returns the MD5 of an object in the base64 encoding used by OCI,
+// so changes look the same whichever store they come from. The ETag of an
+// object that was not uploaded in parts is its hex encoded MD5, the ETag of
+// other objects is returned as is.
+func etagMD5(etag string) string {
+	if b, err := hex.DecodeString(etag); err == nil && len(b) == 16 {
+		return base64.StdEncoding.EncodeToString(b)
+	}
+	return etag
+}
+
+// signV4 signs req with AWS Signature Version 4 for the s3 service. The
+// request must not have a body.
+func signV4(req *http.Request, accessKey, secretKey, region string, t time.Time) {
+	t = t.UTC()
+	amzDate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", emptySHA256)
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{
+		"host":                 host,
+		"x-amz-content-sha256": emptySHA256,
+		"x-amz-date":           amzDate,
+	}
+	if r := req.Header.Get("Range"); r != "" {
+		headers["range"] = r
+	}
+
+	var names []string
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders bytes.Buffer
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s3Escape(req.URL.Path, false),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		emptySHA256,
+	}, "\n")
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQuery encodes query sorted by key, as required by the signature.
+func canonicalQuery(query url.Values) string {
+	var keys []string
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var pairs []string
+	for _, key := range keys {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			pairs = append(pairs, s3Escape(key, true)+"="+s3Escape(value, true))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// s3Escape percent-encodes every byte of s other than the unreserved
+// characters of RFC 3986. Slashes are kept unless escapeSlash is set.
+func s3Escape(s string, escapeSlash bool) string {
+	var b bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !escapeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -12,29 +12,248 @@
 package server
 
 import (
+	"time"
+
 	"github.com/fnproject/oci-objectstore-watcher/ociobjectstorewatcherpb"
-	obstore "github.com/oracle/oci-go-sdk/objectstorage"
 
 	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 // New Creates a new OciObjectstoreWatcherServer which implements ociobjectstorewatcherpb.OciObjectstoreWatcherServer.
-func New(client obstore.ObjectStorageClient) (*OciObjectstoreWatcherServer, error) {
+func New(watcher *ObjectWatcher) (*OciObjectstoreWatcherServer, error) {
 
 	return &OciObjectstoreWatcherServer{
-		objectStoreClient: client,
+		watcher: watcher,
 	}, nil
 }
 
 // OciObjectstoreWatcherServer implements ociobjectstorewatcherpb.OciObjectstoreWatcherServer.
 type OciObjectstoreWatcherServer struct {
-	objectStoreClient obstore.ObjectStorageClient
+	watcher *ObjectWatcher
+
+	// AllowLocalSinks lets clients configure the stdout, file and exec
+	// sinks, which write to the host of the watcher and run commands on it.
+	// Otherwise clients can only configure webhooks and functions, the
+	// other sinks are left to the config file and the flags.
+	AllowLocalSinks bool
+}
+
+// CreateWatch starts watching a new bucket.
+func (s *OciObjectstoreWatcherServer) CreateWatch(ctx context.Context, req *ociobjectstorewatcherpb.CreateWatchRequest) (*ociobjectstorewatcherpb.Watch, error) {
+	w, err := watchFromProto(req.Watch)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkSinks(w); err != nil {
+		return nil, err
+	}
+
+	w, err = s.watcher.Add(w)
+	if err != nil {
+		return nil, watchError(err)
+	}
+
+	return watchToProto(w), nil
+}
+
+// GetWatch returns a single watch.
+func (s *OciObjectstoreWatcherServer) GetWatch(ctx context.Context, req *ociobjectstorewatcherpb.GetWatchRequest) (*ociobjectstorewatcherpb.Watch, error) {
+	w, err := s.watcher.Get(req.Id)
+	if err != nil {
+		return nil, watchError(err)
+	}
+
+	return watchToProto(w), nil
+}
+
+// ListWatches returns all watches.
+func (s *OciObjectstoreWatcherServer) ListWatches(ctx context.Context, req *ociobjectstorewatcherpb.ListWatchesRequest) (*ociobjectstorewatcherpb.ListWatchesResponse, error) {
+	watches := s.watcher.List()
+
+	res := &ociobjectstorewatcherpb.ListWatchesResponse{
+		Watches: make([]*ociobjectstorewatcherpb.Watch, len(watches)),
+	}
+	for i, w := range watches {
+		res.Watches[i] = watchToProto(w)
+	}
+
+	return res, nil
+}
+
+// UpdateWatch replaces the configuration of an existing watch.
+func (s *OciObjectstoreWatcherServer) UpdateWatch(ctx context.Context, req *ociobjectstorewatcherpb.UpdateWatchRequest) (*ociobjectstorewatcherpb.Watch, error) {
+	w, err := watchFromProto(req.Watch)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkSinks(w); err != nil {
+		return nil, err
+	}
+
+	if req.Id == "" {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+	if w.ID != "" && w.ID != req.Id {
+		return nil, status.Error(codes.InvalidArgument, "id of a watch cannot be changed")
+	}
+	w.ID = req.Id
+
+	w, err = s.watcher.Update(w)
+	if err != nil {
+		return nil, watchError(err)
+	}
+
+	return watchToProto(w), nil
 }
 
-// Action is a example implementation and should be replaced with an actual
-// implementation.
-func (s *OciObjectstoreWatcherServer) Action(ctx context.Context, req *ociobjectstorewatcherpb.ActionRequest) (*ociobjectstorewatcherpb.ActionResponse, error) {
-	return &ociobjectstorewatcherpb.ActionResponse{}, nil
+// DeleteWatch stops watching a bucket.
+func (s *OciObjectstoreWatcherServer) DeleteWatch(ctx context.Context, req *ociobjectstorewatcherpb.DeleteWatchRequest) (*ociobjectstorewatcherpb.DeleteWatchResponse, error) {
+	if err := s.watcher.Remove(req.Id); err != nil {
+		return nil, watchError(err)
+	}
+
+	return &ociobjectstorewatcherpb.DeleteWatchResponse{}, nil
+}
+
+// StreamEvents sends the changes that match the filters of req until the
+// client goes away.
+func (s *OciObjectstoreWatcherServer) StreamEvents(req *ociobjectstorewatcherpb.StreamEventsRequest, stream ociobjectstorewatcherpb.OciObjectstoreWatcher_StreamEventsServer) error {
+	sub := s.watcher.Subscribe(EventFilter{
+		Namespace: req.Namespace,
+		Bucket:    req.Bucket,
+		Prefix:    req.Prefix,
+	}, req.LastEventId)
+	defer sub.Close()
+
+	// Send the headers now rather than with the first event, so clients
+	// such as the gateway know the stream is subscribed
+	if err := stream.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+
+	ctx := stream.Context()
+	for {
+		select {
+		case e, ok := <-sub.Events():
+			if !ok {
+				if sub.Overflowed() {
+					return status.Error(codes.ResourceExhausted, "client is not keeping up with events")
+				}
+				return status.Error(codes.Unavailable, "event stream closed")
+			}
+
+			err := stream.Send(&ociobjectstorewatcherpb.Event{
+				Id:            e.ID,
+				Namespace:     e.Namespace,
+				Bucket:        e.Bucket,
+				ObjectName:    e.ObjectName,
+				ContentHash:   e.ContentHash,
+				Type:          e.Type,
+				Size:          e.Size,
+				Etag:          e.ETag,
+				TimeCreated:   e.TimeCreated,
+				StorageTier:   e.StorageTier,
+				ArchivalState: e.ArchivalState,
+			})
+			if err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// checkSinks returns an error if w has a sink that clients are not allowed
+// to configure. Invalid sinks are left to Watch.Validate.
+func (s *OciObjectstoreWatcherServer) checkSinks(w Watch) error {
+	if s.AllowLocalSinks {
+		return nil
+	}
+	for _, spec := range w.sinks() {
+		kind, _, err := parseSink(spec)
+		if err == nil && kind != "http" && kind != "https" && kind != "fn" {
+			return status.Errorf(codes.PermissionDenied, "%s sinks cannot be configured through the API", kind)
+		}
+	}
+	return nil
+}
+
+// watchFromProto converts a Watch message, the poll interval is parsed as a
+// duration.
+func watchFromProto(pb *ociobjectstorewatcherpb.Watch) (Watch, error) {
+	if pb == nil {
+		return Watch{}, status.Error(codes.InvalidArgument, "watch is required")
+	}
+
+	w := Watch{
+		ID:          pb.Id,
+		Namespace:   pb.Namespace,
+		Bucket:      pb.Bucket,
+		WebhookURI:  pb.WebhookUrl,
+		Sinks:       pb.Sinks,
+		Prefix:      pb.Prefix,
+		Include:     pb.Include,
+		Exclude:     pb.Exclude,
+		Events:      pb.Events,
+		Store:       pb.Store,
+		InitialSync: pb.InitialSync,
+	}
+
+	if pb.PollInterval != "" {
+		d, err := time.ParseDuration(pb.PollInterval)
+		if err != nil {
+			return Watch{}, status.Errorf(codes.InvalidArgument, "invalid poll interval - %v", err)
+		}
+		w.PollInterval = d
+	}
+	if pb.InitialSyncSince != "" {
+		t, err := time.Parse(time.RFC3339, pb.InitialSyncSince)
+		if err != nil {
+			return Watch{}, status.Errorf(codes.InvalidArgument, "invalid initial sync since - %v", err)
+		}
+		w.InitialSyncSince = t
+	}
+
+	return w, nil
+}
+
+func watchToProto(w Watch) *ociobjectstorewatcherpb.Watch {
+	pb := &ociobjectstorewatcherpb.Watch{
+		Id:           w.ID,
+		Namespace:    w.Namespace,
+		Bucket:       w.Bucket,
+		PollInterval: w.PollInterval.String(),
+		WebhookUrl:   w.WebhookURI,
+		Sinks:        w.Sinks,
+		Prefix:       w.Prefix,
+		Include:      w.Include,
+		Exclude:      w.Exclude,
+		Events:       w.Events,
+		Store:        w.Store,
+		InitialSync:  w.InitialSync,
+	}
+	if !w.InitialSyncSince.IsZero() {
+		pb.InitialSyncSince = w.InitialSyncSince.Format(time.RFC3339)
+	}
+	return pb
+}
+
+// watchError maps an error returned by ObjectWatcher to a gRPC status.
+func watchError(err error) error {
+	switch err {
+	case ErrWatchNotFound:
+		return status.Error(codes.NotFound, err.Error())
+	case ErrWatchExists:
+		return status.Error(codes.AlreadyExists, err.Error())
+	case ErrWatcherStopped:
+		return status.Error(codes.Unavailable, err.Error())
+	}
+
+	return status.Error(codes.InvalidArgument, err.Error())
 }
 
 // Make sure that OciObjectstoreWatcherServer implements the ociobjectstorewatcherpb.OciObjectstoreWatcherService interface.
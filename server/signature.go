@@ -0,0 +1,198 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2017 Oracle and/or its affiliates.  All rights reserved.
+// This program is free software: you can modify it and/or redistribute it
+// under the terms of:
+//
+// (i)  the Universal Permissive License v 1.0 or at your option, any
+//      later version (http://oss.oracle.com/licenses/upl); and/or
+//
+// (ii) the Apache License v 2.0. (http://www.apache.org/licenses/LICENSE-2.0)
+//-----------------------------------------------------------------------------
+
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DeliveryHeader carries an ID that is unique for every change. Retries
+	// of the same change use the same ID, so receivers can use it to ignore
+	// changes they already processed.
+	DeliveryHeader = "X-Watcher-Delivery"
+
+	// TimestampHeader carries the unix time at which a request was signed.
+	TimestampHeader = "X-Watcher-Timestamp"
+
+	// NonceHeader carries a random value that is different for every
+	// attempt, so retries within the same second are not taken for replays.
+	NonceHeader = "X-Watcher-Nonce"
+
+	// SignatureHeader carries the HMAC-SHA256 signature of a request, as
+	// "sha256=" followed by the hex encoded signature.
+	SignatureHeader = "X-Watcher-Signature"
+
+	signaturePrefix = "sha256="
+)
+
+var (
+	// ErrMissingSignature is returned when a request has no signature headers.
+	ErrMissingSignature = errors.New("request is not signed")
+
+	// ErrInvalidSignature is returned when a signature does not match.
+	ErrInvalidSignature = errors.New("invalid signature")
+
+	// ErrExpiredSignature is returned when a request was signed too long ago.
+	ErrExpiredSignature = errors.New("signature timestamp is outside of the allowed tolerance")
+
+	// ErrReplayedRequest is returned when a request was already verified
+	// before.
+	ErrReplayedRequest = errors.New("request was already received")
+)
+
+// DefaultSignatureTolerance is the maximum age of a signature accepted by a
+// WebhookVerifier created with a zero tolerance.
+const DefaultSignatureTolerance = 5 * time.Minute
+
+// Sign returns the signature of a webhook request. It covers the timestamp,
+// the delivery ID and the nonce, so none can be changed without invalidating
+// it.
+func Sign(secret []byte, timestamp int64, deliveryID string, nonce string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write([]byte(deliveryID))
+	mac.Write([]byte("."))
+	mac.Write([]byte(nonce))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// newDeliveryID returns a random ID for a change, or a random nonce.
+func newDeliveryID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// WebhookVerifier verifies the signature of webhook requests sent by the
+// watcher. It is meant to be used by the receivers of webhooks:
+//
+//	verifier := server.NewWebhookVerifier(secret, 0)
+//	http.HandleFunc("/hook", func(w http.ResponseWriter, r *http.Request) {
+//		body, err := verifier.Verify(r)
+//		if err != nil {
+//			http.Error(w, err.Error(), http.StatusUnauthorized)
+//			return
+//		}
+//		...
+//	})
+type WebhookVerifier struct {
+	secrets   [][]byte
+	tolerance time.Duration
+	now       func() time.Time
+
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+// NewWebhookVerifier creates a WebhookVerifier for secret that accepts
+// signatures up to tolerance old, or DefaultSignatureTolerance if it is zero.
+// Signatures made with oldSecrets are accepted as well, so the secret of the
+// watcher can be rotated without rejecting requests.
+func NewWebhookVerifier(secret string, tolerance time.Duration, oldSecrets ...string) *WebhookVerifier {
+	if tolerance <= 0 {
+		tolerance = DefaultSignatureTolerance
+	}
+
+	secrets := [][]byte{[]byte(secret)}
+	for _, s := range oldSecrets {
+		secrets = append(secrets, []byte(s))
+	}
+
+	return &WebhookVerifier{
+		secrets:   secrets,
+		tolerance: tolerance,
+		now:       time.Now,
+		seen:      make(map[string]time.Time),
+	}
+}
+
+// Verify reads the body of r and checks that it is signed with one of the
+// secrets of v, that the signature is not older than the tolerance and that the
+// same signed request was not verified before. The body is returned if all
+// checks pass.
+//
+// Every attempt at delivering a change is signed with a new nonce, so a
+// retry is not rejected as a replay even if it is sent within the same
+// second. Use the DeliveryHeader to detect changes that were already
+// processed.
+func (v *WebhookVerifier) Verify(r *http.Request) ([]byte, error) {
+	deliveryID := r.Header.Get(DeliveryHeader)
+	timestamp := r.Header.Get(TimestampHeader)
+	nonce := r.Header.Get(NonceHeader)
+	signature := r.Header.Get(SignatureHeader)
+	if deliveryID == "" || timestamp == "" || nonce == "" || signature == "" {
+		return nil, ErrMissingSignature
+	}
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasPrefix(signature, signaturePrefix) || !v.signed(signature, ts, deliveryID, nonce, body) {
+		return nil, ErrInvalidSignature
+	}
+
+	now := v.now()
+	signedAt := time.Unix(ts, 0)
+	if signedAt.Before(now.Add(-v.tolerance)) || signedAt.After(now.Add(v.tolerance)) {
+		return nil, ErrExpiredSignature
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	// Forget signatures that are expired anyway
+	for s, t := range v.seen {
+		if t.Before(now.Add(-v.tolerance)) {
+			delete(v.seen, s)
+		}
+	}
+
+	if _, ok := v.seen[signature]; ok {
+		return nil, ErrReplayedRequest
+	}
+	v.seen[signature] = signedAt
+
+	return body, nil
+}
+
+// signed returns true if signature was made with one of the secrets of v.
+func (v *WebhookVerifier) signed(signature string, timestamp int64, deliveryID string, nonce string, body []byte) bool {
+	for _, secret := range v.secrets {
+		if hmac.Equal([]byte(signature), []byte(Sign(secret, timestamp, deliveryID, nonce, body))) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,199 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2017 Oracle and/or its affiliates.  All rights reserved.
+// This program is free software: you can modify it and/or redistribute it
+// under the terms of:
+//
+// (i)  the Universal Permissive License v 1.0 or at your option, any
+//      later version (http://oss.oracle.com/licenses/upl); and/or
+//
+// (ii) the Apache License v 2.0. (http://www.apache.org/licenses/LICENSE-2.0)
+//-----------------------------------------------------------------------------
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testSecret = "secret"
+
+// signedRequest returns a webhook request for body signed with secret at
+// timestamp. The nonce is the delivery ID, so the same arguments make the
+// same request.
+func signedRequest(secret string, timestamp time.Time, deliveryID string, body []byte) *http.Request {
+	return signedAttempt(secret, timestamp, deliveryID, deliveryID, body)
+}
+
+// signedAttempt is signedRequest with a nonce.
+func signedAttempt(secret string, timestamp time.Time, deliveryID string, nonce string, body []byte) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/hook", bytes.NewReader(body))
+	r.Header.Set(DeliveryHeader, deliveryID)
+	r.Header.Set(TimestampHeader, strconv.FormatInt(timestamp.Unix(), 10))
+	r.Header.Set(NonceHeader, nonce)
+	r.Header.Set(SignatureHeader, Sign([]byte(secret), timestamp.Unix(), deliveryID, nonce, body))
+	return r
+}
+
+func TestWebhookVerifier(t *testing.T) {
+	now := time.Now()
+	body := []byte(`{"objectName":"a"}`)
+
+	tampered := signedRequest(testSecret, now, "1", body)
+	tampered.Body = ioutil.NopCloser(bytes.NewReader([]byte(`{"objectName":"b"}`)))
+	otherDelivery := signedRequest(testSecret, now, "1", body)
+	otherDelivery.Header.Set(DeliveryHeader, "2")
+	otherNonce := signedRequest(testSecret, now, "1", body)
+	otherNonce.Header.Set(NonceHeader, "2")
+	noNonce := signedRequest(testSecret, now, "1", body)
+	noNonce.Header.Del(NonceHeader)
+	unsigned := signedRequest(testSecret, now, "1", body)
+	unsigned.Header.Del(SignatureHeader)
+	noPrefix := signedRequest(testSecret, now, "1", body)
+	noPrefix.Header.Set(SignatureHeader, noPrefix.Header.Get(SignatureHeader)[len(signaturePrefix):])
+
+	tests := []struct {
+		name     string
+		request  *http.Request
+		expected error
+	}{
+		{name: "valid", request: signedRequest(testSecret, now, "1", body)},
+		{name: "tampered body", request: tampered, expected: ErrInvalidSignature},
+		{name: "changed delivery ID", request: otherDelivery, expected: ErrInvalidSignature},
+		{name: "changed nonce", request: otherNonce, expected: ErrInvalidSignature},
+		{name: "missing nonce", request: noNonce, expected: ErrMissingSignature},
+		{name: "wrong secret", request: signedRequest("other", now, "1", body), expected: ErrInvalidSignature},
+		{name: "missing signature", request: unsigned, expected: ErrMissingSignature},
+		{name: "missing prefix", request: noPrefix, expected: ErrInvalidSignature},
+		{name: "expired", request: signedRequest(testSecret, now.Add(-time.Hour), "1", body), expected: ErrExpiredSignature},
+		{name: "from the future", request: signedRequest(testSecret, now.Add(time.Hour), "1", body), expected: ErrExpiredSignature},
+	}
+
+	for _, test := range tests {
+		v := NewWebhookVerifier(testSecret, time.Minute)
+		v.now = func() time.Time { return now }
+
+		got, err := v.Verify(test.request)
+		if err != test.expected {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, err)
+		}
+		if err == nil && !bytes.Equal(got, body) {
+			t.Errorf("%s: expected the body %s, got %s", test.name, body, got)
+		}
+	}
+}
+
+func TestWebhookVerifierReplay(t *testing.T) {
+	now := time.Now()
+	body := []byte(`{"objectName":"a"}`)
+	v := NewWebhookVerifier(testSecret, time.Minute)
+	v.now = func() time.Time { return now }
+
+	if _, err := v.Verify(signedRequest(testSecret, now, "1", body)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Verify(signedRequest(testSecret, now, "1", body)); err != ErrReplayedRequest {
+		t.Errorf("Expected a replayed request to be rejected, got %v", err)
+	}
+
+	// A retry is signed again with a new nonce, even in the same second
+	if _, err := v.Verify(signedAttempt(testSecret, now, "1", "retry", body)); err != nil {
+		t.Errorf("Expected a retry to be accepted, got %v", err)
+	}
+
+	// Signatures are forgotten once they expired, the timestamp rejects them
+	now = now.Add(2 * time.Minute)
+	if _, err := v.Verify(signedRequest(testSecret, now, "2", body)); err != nil {
+		t.Fatal(err)
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if len(v.seen) != 1 {
+		t.Errorf("Expected expired signatures to be forgotten, got %d", len(v.seen))
+	}
+}
+
+func TestWebhookVerifierRotatedSecrets(t *testing.T) {
+	body := []byte(`{"objectName":"a"}`)
+	v := NewWebhookVerifier("new", 0, "old", "older")
+
+	for i, secret := range []string{"new", "old", "older"} {
+		if _, err := v.Verify(signedRequest(secret, time.Now(), strconv.Itoa(i), body)); err != nil {
+			t.Errorf("Expected a signature with %s to be accepted, got %v", secret, err)
+		}
+	}
+	if _, err := v.Verify(signedRequest("retired", time.Now(), "3", body)); err != ErrInvalidSignature {
+		t.Errorf("Expected a signature with a retired secret to be rejected, got %v", err)
+	}
+}
+
+// TestWebhookSinkIsVerified checks that the requests of a webhook sink pass
+// the verifier of receivers.
+func TestWebhookSinkIsVerified(t *testing.T) {
+	v := NewWebhookVerifier(testSecret, 0)
+	verified := make(chan error, 1)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := v.Verify(r)
+		verified <- err
+	}))
+	defer hook.Close()
+
+	sink, err := NewSink(hook.URL, DeliveryOptions{Timeout: time.Second, Secret: testSecret})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	c := Change{DeliveryID: "1", Time: time.Now(), Payload: Payload{Namespace: testNamespace, Bucket: testBucket, ObjectName: "a", Type: add}}
+	if err := sink.Send(context.Background(), c); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-verified; err != nil {
+		t.Errorf("Expected the webhook request to be verified, got %v", err)
+	}
+}
+
+// TestWebhookSinkRetryIsVerified checks that a retry right after a request
+// that was verified but failed is not taken for a replay.
+func TestWebhookSinkRetryIsVerified(t *testing.T) {
+	v := NewWebhookVerifier(testSecret, 0)
+	var mu sync.Mutex
+	var results []error
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := v.Verify(r)
+
+		mu.Lock()
+		defer mu.Unlock()
+		results = append(results, err)
+		switch {
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+		case len(results) == 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer hook.Close()
+
+	sink, err := NewSink(hook.URL, DeliveryOptions{Retries: 1, InitialBackoff: time.Millisecond, Timeout: time.Second, Secret: testSecret})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	c := Change{DeliveryID: "1", Time: time.Now(), Payload: Payload{Namespace: testNamespace, Bucket: testBucket, ObjectName: "a", Type: add}}
+	if err := sink.Send(context.Background(), c); err != nil {
+		t.Errorf("Expected the retry to be accepted, got %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(results) != 2 || results[0] != nil || results[1] != nil {
+		t.Errorf("Expected both attempts to be verified, got %v", results)
+	}
+}
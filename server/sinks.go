@@ -0,0 +1,246 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2017 Oracle and/or its affiliates.  All rights reserved.
+// This program is free software: you can modify it and/or redistribute it
+// under the terms of:
+//
+// (i)  the Universal Permissive License v 1.0 or at your option, any
+//      later version (http://oss.oracle.com/licenses/upl); and/or
+//
+// (ii) the Apache License v 2.0. (http://www.apache.org/licenses/LICENSE-2.0)
+//-----------------------------------------------------------------------------
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sink receives the changes detected by a watch. Sinks are configured as a
+// string, see NewSink for the supported kinds.
+type Sink interface {
+	// Send delivers c. A change is sent again when Send returns an error,
+	// so it has to be safe to retry.
+	Send(ctx context.Context, c Change) error
+
+	// Close releases the resources held by the sink.
+	Close() error
+}
+
+// Change is a change to an object as it is handed to a Sink.
+type Change struct {
+	// DeliveryID is unique for every change and the same for every attempt
+	// and every sink the change is sent to.
+	DeliveryID string
+
+	// Time is when the change was detected.
+	Time time.Time
+
+	Payload Payload
+}
+
+// stdoutMu serializes the writes of all stdout sinks, so lines written by
+// different watches do not interleave.
+var stdoutMu sync.Mutex
+
+// NewSink creates the sink configured as spec, which is one of:
+//
+//	http://... or https://...  posts every change to the url
+//	stdout                      writes every change as a JSON line to stdout
+//	file:<path>                 appends every change as a JSON line to a file
+//	exec:<command> [args...]    runs a command with the change on stdin
+//	fn:<app>/<function>         invokes an Fn function looked up by name
+//	fn:<invoke endpoint>        invokes an Fn function at its invoke endpoint
+//
+// Webhooks and functions are called according to opts, the other sinks only
+// use its Format.
+func NewSink(spec string, opts DeliveryOptions) (Sink, error) {
+	kind, arg, err := parseSink(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	switch kind {
+	case "http", "https":
+		return &webhookSink{url: spec, deliverer: newDeliverer(opts)}, nil
+	case "stdout":
+		return &lineSink{mu: &stdoutMu, w: os.Stdout, format: opts.Format}, nil
+	case "file":
+		f, err := os.OpenFile(arg, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, err
+		}
+		return &lineSink{mu: &sync.Mutex{}, w: f, file: f, format: opts.Format}, nil
+	case "exec":
+		return &execSink{args: strings.Fields(arg), timeout: opts.Timeout, format: opts.Format}, nil
+	case "fn":
+		return newFnSink(arg, opts)
+	}
+	return nil, fmt.Errorf("unknown sink %q", spec)
+}
+
+// ValidateSink returns an error if spec is not a valid sink configuration.
+func ValidateSink(spec string) error {
+	_, _, err := parseSink(spec)
+	return err
+}
+
+// validateSinkOptions returns an error if the sink configured as spec cannot
+// be created with opts.
+func validateSinkOptions(spec string, opts DeliveryOptions) error {
+	kind, arg, err := parseSink(spec)
+	if err != nil {
+		return err
+	}
+	if kind == "fn" && !isFnInvokeEndpoint(arg) && opts.FnAPIURL == "" {
+		return fmt.Errorf("fn sink %s requires the fn api url to look up the function", arg)
+	}
+	return nil
+}
+
+// parseSink splits spec into the kind of sink and its argument.
+func parseSink(spec string) (string, string, error) {
+	i := strings.Index(spec, ":")
+	if i < 0 {
+		if spec == "stdout" {
+			return spec, "", nil
+		}
+		return "", "", fmt.Errorf("invalid sink %q", spec)
+	}
+
+	kind, arg := spec[:i], spec[i+1:]
+	switch kind {
+	case "http", "https":
+		u, err := url.Parse(spec)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid webhook url - %v", err)
+		}
+		if u.Host == "" {
+			return "", "", fmt.Errorf("invalid webhook url %q", spec)
+		}
+	case "stdout":
+		if arg != "" {
+			return "", "", fmt.Errorf("invalid sink %q", spec)
+		}
+	case "file":
+		if arg == "" {
+			return "", "", errors.New("file sink requires a path")
+		}
+	case "exec":
+		if len(strings.Fields(arg)) == 0 {
+			return "", "", errors.New("exec sink requires a command")
+		}
+	case "fn":
+		if err := validateFnSink(arg); err != nil {
+			return "", "", err
+		}
+	default:
+		return "", "", fmt.Errorf("unknown sink %q", spec)
+	}
+	return kind, arg, nil
+}
+
+// webhookSink posts changes to a url.
+type webhookSink struct {
+	url       string
+	deliverer *deliverer
+}
+
+func (s *webhookSink) Send(ctx context.Context, c Change) error {
+	m, err := encode(s.deliverer.opts.Format, c)
+	if err != nil {
+		return err
+	}
+	_, err = s.deliverer.deliver(ctx, s.url, c.DeliveryID, m)
+	return err
+}
+
+func (s *webhookSink) Close() error {
+	return nil
+}
+
+// lineSink writes every change as a single line of JSON.
+type lineSink struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	file   *os.File
+	format Format
+}
+
+func (s *lineSink) Send(ctx context.Context, c Change) error {
+	b, err := encodeLine(s.format, c)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.w.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	if s.file != nil {
+		return s.file.Sync()
+	}
+	return nil
+}
+
+func (s *lineSink) Close() error {
+	if s.file != nil {
+		return s.file.Close()
+	}
+	return nil
+}
+
+// execSink runs a command for every change, the change is written to its
+// stdin. A command that exits with a non-zero status is retried.
+type execSink struct {
+	args    []string
+	timeout time.Duration
+	format  Format
+}
+
+func (s *execSink) Send(ctx context.Context, c Change) error {
+	b, err := encodeLine(s.format, c)
+	if err != nil {
+		return err
+	}
+
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+
+	var out bytes.Buffer
+	cmd := exec.CommandContext(ctx, s.args[0], s.args[1:]...)
+	cmd.Stdin = bytes.NewReader(b)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	cmd.Env = append(os.Environ(), "WATCHER_DELIVERY_ID="+c.DeliveryID)
+
+	if err := cmd.Run(); err != nil {
+		output := strings.TrimSpace(out.String())
+		if output == "" {
+			return fmt.Errorf("command %s failed - %v", s.args[0], err)
+		}
+		if len(output) > 512 {
+			output = output[:512]
+		}
+		return fmt.Errorf("command %s failed - %v: %s", s.args[0], err, output)
+	}
+	return nil
+}
+
+func (s *execSink) Close() error {
+	return nil
+}
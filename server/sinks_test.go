@@ -0,0 +1,199 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2017 Oracle and/or its affiliates.  All rights reserved.
+// This program is free software: you can modify it and/or redistribute it
+// under the terms of:
+//
+// (i)  the Universal Permissive License v 1.0 or at your option, any
+//      later version (http://oss.oracle.com/licenses/upl); and/or
+//
+// (ii) the Apache License v 2.0. (http://www.apache.org/licenses/LICENSE-2.0)
+//-----------------------------------------------------------------------------
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fnproject/oci-objectstore-watcher/objectstoretest"
+)
+
+// writeScript writes a shell script to the working directory and returns
+// its path.
+func writeScript(t *testing.T, script string) string {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "sink.sh")
+	if err := ioutil.WriteFile(path, []byte("#!/bin/sh\n"+script), 0700); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// readLines returns the complete lines of the file at path, none if it is
+// missing.
+func readLines(t *testing.T, path string) []string {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i := bytes.LastIndexByte(b, '\n'); i >= 0 {
+		b = b[:i+1]
+	} else {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+}
+
+// waitForLines waits until the file at path has n lines and returns them.
+func waitForLines(t *testing.T, path string, n int) []string {
+	deadline := time.Now().Add(testTimeout)
+	for {
+		lines := readLines(t, path)
+		if len(lines) >= n {
+			return lines
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d lines in %s, got %v", n, path, lines)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	defer inTempDir(t)()
+
+	sink, err := NewSink("file:changes.json", DeliveryOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	names := []string{"a", "dir/b"}
+	for _, name := range names {
+		if err := sink.Send(context.Background(), testChange(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lines := readLines(t, "changes.json")
+	if len(lines) != len(names) {
+		t.Fatalf("Expected a line per change, got %q", lines)
+	}
+	for i, line := range lines {
+		var p Payload
+		if err := json.Unmarshal([]byte(line), &p); err != nil || p != testChange(names[i]).Payload {
+			t.Errorf("Expected the payload of %s, got %s %v", names[i], line, err)
+		}
+	}
+}
+
+func TestExecSink(t *testing.T) {
+	defer inTempDir(t)()
+
+	script := writeScript(t, `cat > stdin && printf %s "$WATCHER_DELIVERY_ID" > id`)
+	sink, err := NewSink("exec:"+script, DeliveryOptions{Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	c := testChange("a")
+	if err := sink.Send(context.Background(), c); err != nil {
+		t.Fatal(err)
+	}
+
+	stdin, err := ioutil.ReadFile("stdin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, _ := json.Marshal(c.Payload)
+	if !bytes.Equal(bytes.TrimSpace(stdin), expected) {
+		t.Errorf("Expected the payload %s on stdin, got %s", expected, stdin)
+	}
+	if id, err := ioutil.ReadFile("id"); err != nil || string(id) != c.DeliveryID {
+		t.Errorf("Expected the delivery ID %s, got %s %v", c.DeliveryID, id, err)
+	}
+}
+
+func TestExecSinkFails(t *testing.T) {
+	defer inTempDir(t)()
+
+	script := writeScript(t, "echo broken\nexit 3\n")
+	sink, err := NewSink("exec:"+script, DeliveryOptions{Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	err = sink.Send(context.Background(), testChange("a"))
+	if err == nil || !strings.Contains(err.Error(), "exit status 3: broken") {
+		t.Fatalf("Expected the exit status and output, got %v", err)
+	}
+	if permanent(err) {
+		t.Error("Expected a failed command to be retried")
+	}
+}
+
+// TestWatcherRetriesExecSink checks that a change stays in the outbox while
+// the command fails, and is delivered once it succeeds.
+func TestWatcherRetriesExecSink(t *testing.T) {
+	defer inTempDir(t)()
+
+	store := objectstoretest.NewServer()
+	defer store.Close()
+
+	store.PutObject(testNamespace, testBucket, "a", []byte("a"))
+
+	// The command fails as long as the file fail exists
+	script := writeScript(t, "echo attempt >> attempts\n[ -e fail ] && exit 1\n(cat; echo) >> changes\n")
+	if err := ioutil.WriteFile("fail", nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	w := Watch{ID: "w", Sinks: []string{"exec:" + script}}
+
+	o := newTestWatcher(t, store)
+	addWatch(t, o, w)
+	waitForLines(t, "attempts", 2)
+	o.Shutdown()
+
+	if lines := readLines(t, "changes"); len(lines) != 0 {
+		t.Fatalf("Expected no change to be delivered, got %v", lines)
+	}
+	s, err := loadSnapshot("", "w")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Outbox) != 1 || s.Outbox[0].Payload.ObjectName != "a" {
+		t.Fatalf("Expected the change to stay in the outbox, got %+v", s.Outbox)
+	}
+
+	if err := os.Remove("fail"); err != nil {
+		t.Fatal(err)
+	}
+	o = newTestWatcher(t, store)
+	defer o.Shutdown()
+	addWatch(t, o, w)
+
+	lines := waitForLines(t, "changes", 1)
+	var p Payload
+	if err := json.Unmarshal([]byte(lines[0]), &p); err != nil || p.ObjectName != "a" || p.Type != add {
+		t.Errorf("Expected the change of a, got %s %v", lines[0], err)
+	}
+	time.Sleep(10 * testPollInterval)
+	if lines := readLines(t, "changes"); len(lines) != 1 {
+		t.Errorf("Expected the change to be delivered once, got %v", lines)
+	}
+}
@@ -0,0 +1,248 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2017 Oracle and/or its affiliates.  All rights reserved.
+// This program is free software: you can modify it and/or redistribute it
+// under the terms of:
+//
+// (i)  the Universal Permissive License v 1.0 or at your option, any
+//      later version (http://oss.oracle.com/licenses/upl); and/or
+//
+// (ii) the Apache License v 2.0. (http://www.apache.org/licenses/LICENSE-2.0)
+//-----------------------------------------------------------------------------
+
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/wercker/pkg/log"
+)
+
+// snapshot is everything that is persisted for a watch: the objects that were
+// last seen in the bucket and the changes that still have to be delivered.
+// Both are always written together, so a detected change is either in the
+// outbox or not reflected in Objects at all. Objects holds the MD5 of every
+// object, ETags only those the store returned one for; snapshots written
+// before ETags were tracked have none. Initial is set while the bucket was
+// not listed yet, see Watch.InitialSync.
+type snapshot struct {
+	Objects map[string]string
+	ETags   map[string]string
+	Initial bool
+	Outbox  []outboxEntry
+}
+
+// outboxEntry is a change waiting to be delivered to a sink. The delivery ID
+// is assigned when the change is detected and stays the same for every
+// attempt. Entries written before sinks were introduced have no Sink.
+type outboxEntry struct {
+	Sink       string
+	DeliveryID string
+	Time       time.Time
+	Payload    Payload
+}
+
+func (e outboxEntry) change() Change {
+	return Change{DeliveryID: e.DeliveryID, Time: e.Time, Payload: e.Payload}
+}
+
+// snapshotStore persists the snapshots of watches.
+type snapshotStore interface {
+	load(id string) (*snapshot, error)
+	save(id string, s *snapshot) error
+	reset(id string) error
+}
+
+// fileSnapshots keeps every snapshot in a file in dir, the working directory
+// if it is empty. It is the snapshotStore of an ObjectWatcher without a state
+// store.
+type fileSnapshots struct {
+	dir string
+}
+
+func (f fileSnapshots) load(id string) (*snapshot, error) { return loadSnapshot(f.dir, id) }
+func (f fileSnapshots) save(id string, s *snapshot) error { return saveSnapshot(f.dir, id, s) }
+func (f fileSnapshots) reset(id string) error             { return resetSnapshot(f.dir, id) }
+
+// Snapshot files start with a header: snapshotMagic, the format version as
+// a uint16, the length of the gob encoded snapshot as a uint64 and its
+// SHA-256. Files without it were written before the format was versioned,
+// they are a gob encoded snapshot or, before that, just the objects.
+const (
+	snapshotMagic   = "OOSWSNAP"
+	snapshotVersion = 2
+	headerSize      = len(snapshotMagic) + 2 + 8 + sha256.Size
+)
+
+// corruptSnapshotError is returned when a snapshot file cannot be read.
+type corruptSnapshotError struct {
+	reason string
+}
+
+func (e corruptSnapshotError) Error() string {
+	return "corrupt snapshot - " + e.reason
+}
+
+// cacheFile returns the name of the file in dir the snapshot of watch id is
+// saved in.
+func cacheFile(dir, id string) string {
+	return filepath.Join(dir, id)
+}
+
+// loadSnapshot reads the snapshot of watch id from dir. A watch without a
+// snapshot starts out empty. A corrupt snapshot is moved aside, so it can be
+// inspected, and the watch starts out empty as well, which syncs the bucket
+// again according to its initial sync mode. If it cannot be moved, like on a
+// read-only file system, it is left as is.
+func loadSnapshot(dir, id string) (*snapshot, error) {
+	name := cacheFile(dir, id)
+	b, err := ioutil.ReadFile(name)
+	if os.IsNotExist(err) {
+		return &snapshot{Objects: make(map[string]string), Initial: true}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	s, err := decodeSnapshot(b)
+	if _, ok := err.(corruptSnapshotError); ok {
+		quarantine := fmt.Sprintf("%s.corrupt-%d", name, time.Now().Unix())
+		if rerr := os.Rename(name, quarantine); rerr != nil {
+			log.WithField("watch", id).WithField("file", name).WithError(err).Warnf("Ignoring corrupt cache snapshot that cannot be quarantined (%v), the bucket will be synced again", rerr)
+			return &snapshot{Objects: make(map[string]string), Initial: true}, nil
+		}
+
+		log.WithField("watch", id).WithField("quarantine", quarantine).WithError(err).Warn("Quarantined corrupt cache snapshot, the bucket will be synced again")
+		return &snapshot{Objects: make(map[string]string), Initial: true}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// decodeSnapshot decodes a snapshot file in any of its formats.
+func decodeSnapshot(b []byte) (*snapshot, error) {
+	s := &snapshot{}
+
+	if !bytes.HasPrefix(b, []byte(snapshotMagic)) {
+		if err := gob.NewDecoder(bytes.NewReader(b)).Decode(s); err != nil {
+			objects := make(map[string]string)
+			if gob.NewDecoder(bytes.NewReader(b)).Decode(&objects) != nil {
+				return nil, corruptSnapshotError{fmt.Sprintf("unable to decode unversioned snapshot: %v", err)}
+			}
+			s.Objects = objects
+		}
+	} else {
+		if len(b) < headerSize {
+			return nil, corruptSnapshotError{"truncated header"}
+		}
+		header := b[len(snapshotMagic):headerSize]
+		if version := binary.BigEndian.Uint16(header); version != snapshotVersion {
+			return nil, corruptSnapshotError{fmt.Sprintf("unsupported version %d", version)}
+		}
+		body := b[headerSize:]
+		if size := binary.BigEndian.Uint64(header[2:]); size != uint64(len(body)) {
+			return nil, corruptSnapshotError{fmt.Sprintf("expected %d bytes, got %d", size, len(body))}
+		}
+		if sum := sha256.Sum256(body); !bytes.Equal(sum[:], header[10:]) {
+			return nil, corruptSnapshotError{"checksum mismatch"}
+		}
+		if err := gob.NewDecoder(bytes.NewReader(body)).Decode(s); err != nil {
+			return nil, corruptSnapshotError{err.Error()}
+		}
+	}
+
+	if s.Objects == nil {
+		s.Objects = make(map[string]string)
+	}
+	return s, nil
+}
+
+// encodeSnapshot returns the snapshot file of s in the current format.
+func encodeSnapshot(s *snapshot) ([]byte, error) {
+	var body bytes.Buffer
+	if err := gob.NewEncoder(&body).Encode(s); err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, headerSize, headerSize+body.Len())
+	copy(b, snapshotMagic)
+	header := b[len(snapshotMagic):]
+	binary.BigEndian.PutUint16(header, snapshotVersion)
+	binary.BigEndian.PutUint64(header[2:], uint64(body.Len()))
+	sum := sha256.Sum256(body.Bytes())
+	copy(header[10:], sum[:])
+
+	return append(b, body.Bytes()...), nil
+}
+
+// saveSnapshot atomically replaces the snapshot of watch id in dir. It is
+// written to a temporary file first which is renamed over the old snapshot
+// once it is synced to disk, so a crash leaves either the old or the new
+// snapshot.
+func saveSnapshot(dir, id string, s *snapshot) error {
+	name := cacheFile(dir, id)
+
+	b, err := encodeSnapshot(s)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(name), filepath.Base(name)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(name))
+}
+
+// syncDir syncs the directory dir, which makes a rename in it durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	if err := d.Sync(); err != nil && !os.IsPermission(err) {
+		return err
+	}
+	return nil
+}
+
+// resetSnapshot forgets the objects seen by watch id in dir, while keeping
+// changes that were not delivered yet. The next poll is an initial sync.
+func resetSnapshot(dir, id string) error {
+	s, err := loadSnapshot(dir, id)
+	if err != nil {
+		return err
+	}
+
+	s.Objects = make(map[string]string)
+	s.ETags = nil
+	s.Initial = true
+	return saveSnapshot(dir, id, s)
+}
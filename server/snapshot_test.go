@@ -0,0 +1,159 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2017 Oracle and/or its affiliates.  All rights reserved.
+// This program is free software: you can modify it and/or redistribute it
+// under the terms of:
+//
+// (i)  the Universal Permissive License v 1.0 or at your option, any
+//      later version (http://oss.oracle.com/licenses/upl); and/or
+//
+// (ii) the Apache License v 2.0. (http://www.apache.org/licenses/LICENSE-2.0)
+//-----------------------------------------------------------------------------
+
+package server
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fnproject/oci-objectstore-watcher/objectstoretest"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	defer inTempDir(t)()
+
+	p := Payload{Namespace: testNamespace, Bucket: testBucket, ObjectName: "a", Type: add}
+	saved := &snapshot{
+		Objects: map[string]string{"a": "md5"},
+		Outbox:  []outboxEntry{{Sink: "stdout", DeliveryID: "id", Time: time.Now(), Payload: p}},
+	}
+	if err := saveSnapshot("", "watch", saved); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile("watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(b, []byte(snapshotMagic)) {
+		t.Error("Expected a snapshot header")
+	}
+	if tmp, _ := filepath.Glob("watch.tmp*"); len(tmp) != 0 {
+		t.Errorf("Expected temporary files to be removed, got %v", tmp)
+	}
+
+	s, err := loadSnapshot("", "watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Objects["a"] != "md5" || len(s.Outbox) != 1 || s.Outbox[0].Payload != p {
+		t.Errorf("Unexpected snapshot %+v", s)
+	}
+}
+
+func TestSnapshotLoadsUnversionedFiles(t *testing.T) {
+	defer inTempDir(t)()
+
+	formats := map[string]interface{}{
+		"snapshot": &snapshot{Objects: map[string]string{"a": "md5"}},
+		"objects":  map[string]string{"a": "md5"},
+	}
+	for name, v := range formats {
+		var b bytes.Buffer
+		if err := gob.NewEncoder(&b).Encode(v); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, b.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		s, err := loadSnapshot("", name)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if s.Objects["a"] != "md5" {
+			t.Errorf("%s: unexpected snapshot %+v", name, s)
+		}
+	}
+}
+
+func TestSnapshotQuarantinesCorruptFiles(t *testing.T) {
+	defer inTempDir(t)()
+
+	if err := saveSnapshot("", "watch", &snapshot{Objects: map[string]string{"a": "md5"}}); err != nil {
+		t.Fatal(err)
+	}
+	valid, err := ioutil.ReadFile("watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flipped := append([]byte(nil), valid...)
+	flipped[len(flipped)-1] ^= 0xff
+	version := append([]byte(nil), valid...)
+	version[len(snapshotMagic)+1] = 99
+
+	corrupt := map[string][]byte{
+		"truncated body":   valid[:len(valid)-1],
+		"truncated header": valid[:headerSize-1],
+		"checksum":         flipped,
+		"version":          version,
+		"unversioned":      []byte("garbage"),
+		"empty":            nil,
+	}
+	for name, b := range corrupt {
+		if err := ioutil.WriteFile("watch", b, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		s, err := loadSnapshot("", "watch")
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(s.Objects) != 0 || len(s.Outbox) != 0 {
+			t.Errorf("%s: expected an empty snapshot, got %+v", name, s)
+		}
+
+		quarantined, _ := filepath.Glob("watch.corrupt-*")
+		if len(quarantined) != 1 {
+			t.Fatalf("%s: expected the snapshot to be quarantined, got %v", name, quarantined)
+		}
+		if q, _ := ioutil.ReadFile(quarantined[0]); !bytes.Equal(q, b) {
+			t.Errorf("%s: expected the quarantined file to be kept as is", name)
+		}
+		removeAll(t, quarantined)
+	}
+}
+
+func removeAll(t *testing.T, names []string) {
+	for _, name := range names {
+		if err := os.Remove(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestWatcherResyncsCorruptSnapshot(t *testing.T) {
+	defer inTempDir(t)()
+
+	store := objectstoretest.NewServer()
+	defer store.Close()
+	hook := newHookRecorder()
+	defer hook.Close()
+
+	store.PutObject(testNamespace, testBucket, "a", []byte("a"))
+	if err := ioutil.WriteFile("watch", []byte(snapshotMagic+"garbage"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	o := newTestWatcher(t, store)
+	defer o.Shutdown()
+	addWatch(t, o, Watch{ID: "watch", WebhookURI: hook.URL})
+
+	expectChanges(t, hook.waitFor(t, 1), "NEW a")
+	hook.expectNoMoreCalls(t, 1)
+}
@@ -0,0 +1,115 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2017 Oracle and/or its affiliates.  All rights reserved.
+// This program is free software: you can modify it and/or redistribute it
+// under the terms of:
+//
+// (i)  the Universal Permissive License v 1.0 or at your option, any
+//      later version (http://oss.oracle.com/licenses/upl); and/or
+//
+// (ii) the Apache License v 2.0. (http://www.apache.org/licenses/LICENSE-2.0)
+//-----------------------------------------------------------------------------
+
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/fnproject/oci-objectstore-watcher/state"
+)
+
+// stateSnapshots keeps the snapshots of watches in a state.Store, so they
+// survive the pod of the watcher. Watches without a snapshot in the store
+// continue from their snapshot file in legacyDir, which was written before
+// there was a state store. They start out empty if legacyDir is not set.
+type stateSnapshots struct {
+	store     state.Store
+	legacyDir string
+}
+
+func (s stateSnapshots) load(id string) (*snapshot, error) {
+	ss, err := s.store.LoadSnapshot(context.Background(), id)
+	if err == state.ErrNotFound {
+		if s.legacyDir == "" {
+			return &snapshot{Objects: make(map[string]string), Initial: true}, nil
+		}
+		return loadSnapshot(s.legacyDir, id)
+	} else if err != nil {
+		return nil, err
+	}
+
+	snap := &snapshot{Objects: ss.Objects, ETags: ss.ETags, Initial: ss.Initial}
+	if snap.Objects == nil {
+		snap.Objects = make(map[string]string)
+	}
+	for _, e := range ss.Outbox {
+		snap.Outbox = append(snap.Outbox, outboxEntry{
+			Sink:       e.Sink,
+			DeliveryID: e.Event.DeliveryID,
+			Time:       e.Event.Time,
+			Payload:    payloadOf(e.Event),
+		})
+	}
+	return snap, nil
+}
+
+func (s stateSnapshots) save(id string, snap *snapshot) error {
+	ss := &state.Snapshot{WatchID: id, Objects: snap.Objects, ETags: snap.ETags, Initial: snap.Initial}
+	for _, e := range snap.Outbox {
+		ss.Outbox = append(ss.Outbox, state.OutboxEntry{Sink: e.Sink, Event: stateEvent(id, e.change())})
+	}
+	return s.store.SaveSnapshot(context.Background(), ss)
+}
+
+// reset forgets the objects seen by watch id, while keeping changes that
+// were not delivered yet. The next poll is an initial sync.
+func (s stateSnapshots) reset(id string) error {
+	snap, err := s.load(id)
+	if err != nil {
+		return err
+	}
+
+	snap.Objects = make(map[string]string)
+	snap.ETags = nil
+	snap.Initial = true
+	return s.save(id, snap)
+}
+
+// stateEvent returns the change c of watch id as an event of the history.
+func stateEvent(id string, c Change) state.Event {
+	// Payloads without a creation time, like deletes, leave it zero
+	timeCreated, _ := time.Parse(time.RFC3339Nano, c.Payload.TimeCreated)
+	return state.Event{
+		WatchID:       id,
+		DeliveryID:    c.DeliveryID,
+		Time:          c.Time,
+		Namespace:     c.Payload.Namespace,
+		Bucket:        c.Payload.Bucket,
+		ObjectName:    c.Payload.ObjectName,
+		ContentHash:   c.Payload.ContentHash,
+		Type:          c.Payload.Type,
+		Size:          c.Payload.Size,
+		ETag:          c.Payload.ETag,
+		TimeCreated:   timeCreated,
+		StorageTier:   c.Payload.StorageTier,
+		ArchivalState: c.Payload.ArchivalState,
+	}
+}
+
+func payloadOf(e state.Event) Payload {
+	p := Payload{
+		Namespace:     e.Namespace,
+		Bucket:        e.Bucket,
+		ObjectName:    e.ObjectName,
+		ContentHash:   e.ContentHash,
+		Type:          e.Type,
+		Size:          e.Size,
+		ETag:          e.ETag,
+		StorageTier:   e.StorageTier,
+		ArchivalState: e.ArchivalState,
+	}
+	if !e.TimeCreated.IsZero() {
+		p.TimeCreated = e.TimeCreated.UTC().Format(time.RFC3339Nano)
+	}
+	return p
+}
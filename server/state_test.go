@@ -0,0 +1,296 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2017 Oracle and/or its affiliates.  All rights reserved.
+// This program is free software: you can modify it and/or redistribute it
+// under the terms of:
+//
+// (i)  the Universal Permissive License v 1.0 or at your option, any
+//      later version (http://oss.oracle.com/licenses/upl); and/or
+//
+// (ii) the Apache License v 2.0. (http://www.apache.org/licenses/LICENSE-2.0)
+//-----------------------------------------------------------------------------
+
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fnproject/oci-objectstore-watcher/objectstoretest"
+	"github.com/fnproject/oci-objectstore-watcher/state"
+)
+
+// memoryStateStore is a state.Store that keeps everything in memory.
+// LoadSnapshot fails with loadErr if it is set.
+type memoryStateStore struct {
+	mu        sync.Mutex
+	snapshots map[string]state.Snapshot
+	events    []state.Event
+	loadErr   error
+}
+
+func newMemoryStateStore() *memoryStateStore {
+	return &memoryStateStore{snapshots: make(map[string]state.Snapshot)}
+}
+
+func (s *memoryStateStore) Initialize() error { return nil }
+func (s *memoryStateStore) Close() error      { return nil }
+func (s *memoryStateStore) Healthy() error    { return nil }
+
+func (s *memoryStateStore) LoadSnapshot(ctx context.Context, watchID string) (*state.Snapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.loadErr != nil {
+		return nil, s.loadErr
+	}
+	snapshot, ok := s.snapshots[watchID]
+	if !ok {
+		return nil, state.ErrNotFound
+	}
+	objects := make(map[string]string, len(snapshot.Objects))
+	for name, md5 := range snapshot.Objects {
+		objects[name] = md5
+	}
+	snapshot.Objects = objects
+	snapshot.Outbox = append([]state.OutboxEntry(nil), snapshot.Outbox...)
+	return &snapshot, nil
+}
+
+func (s *memoryStateStore) SaveSnapshot(ctx context.Context, snapshot *state.Snapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snapshots[snapshot.WatchID] = *snapshot
+	return nil
+}
+
+func (s *memoryStateStore) DeleteSnapshot(ctx context.Context, watchID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.snapshots, watchID)
+	return nil
+}
+
+func (s *memoryStateStore) AppendEvents(ctx context.Context, events []state.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, events...)
+	return nil
+}
+
+func (s *memoryStateStore) QueryEvents(ctx context.Context, q state.EventQuery) ([]state.Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var events []state.Event
+	for _, e := range s.events {
+		if (q.WatchID == "" || e.WatchID == q.WatchID) && strings.HasPrefix(e.ObjectName, q.Prefix) {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+// waitForEvents waits until the history of store has n events.
+func (s *memoryStateStore) waitForEvents(t *testing.T, n int) []state.Event {
+	deadline := time.Now().Add(testTimeout)
+	for {
+		events, _ := s.QueryEvents(context.Background(), state.EventQuery{})
+		if len(events) >= n {
+			return events
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d events, got %d: %v", n, len(events), events)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// waitForEmptyOutbox waits until the saved snapshot of the watch watchID has
+// no undelivered changes.
+func (s *memoryStateStore) waitForEmptyOutbox(t *testing.T, watchID string) {
+	deadline := time.Now().Add(testTimeout)
+	for {
+		snapshot, err := s.LoadSnapshot(context.Background(), watchID)
+		if err == nil && len(snapshot.Outbox) == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the outbox of %s to be empty, got %+v %v", watchID, snapshot, err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestWatcherResumesFromStateStore(t *testing.T) {
+	defer inTempDir(t)()
+
+	store := objectstoretest.NewServer()
+	defer store.Close()
+	hook := newHookRecorder()
+	defer hook.Close()
+	states := newMemoryStateStore()
+
+	store.PutObject(testNamespace, testBucket, "a", []byte("a"))
+
+	o := newTestWatcher(t, store)
+	o.SetStateStore(states, "")
+	addWatch(t, o, Watch{ID: "watch", WebhookURI: hook.URL})
+	calls := hook.waitFor(t, 1)
+	expectChanges(t, calls, "NEW a")
+
+	events := states.waitForEvents(t, 1)
+	if e := events[0]; e.WatchID != "watch" || e.DeliveryID != calls[0].DeliveryID || e.ObjectName != "a" || e.Type != add {
+		t.Errorf("Unexpected event %+v", e)
+	}
+	// The delivery is acknowledged before the watcher stops, so it is not
+	// sent again after the restart
+	states.waitForEmptyOutbox(t, "watch")
+	o.Shutdown()
+
+	if _, err := os.Stat("watch"); !os.IsNotExist(err) {
+		t.Errorf("Expected no snapshot file, got %v", err)
+	}
+
+	// Changed while the watcher was down, like a replica that is restarted
+	// on another pod
+	store.PutObject(testNamespace, testBucket, "b", []byte("b"))
+
+	o = newTestWatcher(t, store)
+	o.SetStateStore(states, "")
+	defer o.Shutdown()
+	addWatch(t, o, Watch{ID: "watch", WebhookURI: hook.URL})
+
+	calls = hook.waitFor(t, 2)
+	expectChanges(t, calls[1:], "NEW b")
+	hook.expectNoMoreCalls(t, 2)
+
+	events = states.waitForEvents(t, 2)
+	if len(events) != 2 || events[1].ObjectName != "b" {
+		t.Errorf("Unexpected events %+v", events)
+	}
+}
+
+func TestStateSnapshots(t *testing.T) {
+	snapshots := stateSnapshots{store: newMemoryStateStore()}
+
+	s, err := snapshots.load("watch")
+	if err != nil || len(s.Objects) != 0 || len(s.Outbox) != 0 {
+		t.Fatalf("Expected an empty snapshot, got %+v %v", s, err)
+	}
+
+	now := time.Now()
+	p := Payload{Namespace: testNamespace, Bucket: testBucket, ObjectName: "a", ContentHash: "md5", Type: add}
+	saved := &snapshot{
+		Objects: map[string]string{"a": "md5"},
+		Outbox:  []outboxEntry{{Sink: "stdout", DeliveryID: "id", Time: now, Payload: p}},
+	}
+	if err := snapshots.save("watch", saved); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = snapshots.load("watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Objects["a"] != "md5" || len(s.Outbox) != 1 {
+		t.Fatalf("Unexpected snapshot %+v", s)
+	}
+	if e := s.Outbox[0]; e.Sink != "stdout" || e.DeliveryID != "id" || !e.Time.Equal(now) || e.Payload != p {
+		t.Errorf("Unexpected outbox entry %+v", e)
+	}
+
+	// Undelivered changes survive a reset
+	if err := snapshots.reset("watch"); err != nil {
+		t.Fatal(err)
+	}
+	s, err = snapshots.load("watch")
+	if err != nil || len(s.Objects) != 0 || len(s.Outbox) != 1 {
+		t.Errorf("Unexpected snapshot after reset %+v %v", s, err)
+	}
+}
+
+func TestStateSnapshotsResetKeepsSnapshot(t *testing.T) {
+	states := newMemoryStateStore()
+	snapshots := stateSnapshots{store: states}
+	saved := &snapshot{Outbox: []outboxEntry{{Sink: "stdout", DeliveryID: "id", Payload: Payload{ObjectName: "a", Type: add}}}}
+	if err := snapshots.save("watch", saved); err != nil {
+		t.Fatal(err)
+	}
+
+	// The undelivered changes are not thrown away when the store fails
+	states.loadErr = errors.New("unavailable")
+	if err := snapshots.reset("watch"); err != states.loadErr {
+		t.Errorf("Expected the error of the store, got %v", err)
+	}
+	states.loadErr = nil
+	s, err := snapshots.load("watch")
+	if err != nil || len(s.Outbox) != 1 {
+		t.Errorf("Expected the snapshot to be kept, got %+v %v", s, err)
+	}
+}
+
+func TestStateSnapshotsImportFiles(t *testing.T) {
+	defer inTempDir(t)()
+
+	if err := os.Mkdir("legacy", 0755); err != nil {
+		t.Fatal(err)
+	}
+	saved := &snapshot{Objects: map[string]string{"a": "md5"}}
+	if err := saveSnapshot("legacy", "watch", saved); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveSnapshot("", "watch", saved); err != nil {
+		t.Fatal(err)
+	}
+
+	// Files are only imported from the legacy directory, not the working
+	// directory
+	s, err := stateSnapshots{store: newMemoryStateStore()}.load("watch")
+	if err != nil || len(s.Objects) != 0 || !s.Initial {
+		t.Errorf("Expected an empty snapshot without a legacy directory, got %+v %v", s, err)
+	}
+
+	s, err = stateSnapshots{store: newMemoryStateStore(), legacyDir: "legacy"}.load("watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Objects["a"] != "md5" {
+		t.Errorf("Expected the snapshot file to be imported, got %+v", s)
+	}
+}
+
+func TestStateSnapshotsImportCorruptFile(t *testing.T) {
+	defer inTempDir(t)()
+
+	if err := os.Mkdir("legacy", 0755); err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join("legacy", "watch")
+	if err := ioutil.WriteFile(name, []byte("garbage"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Directories in the way of the quarantine make it fail like on a
+	// read-only file system, even for root
+	now := time.Now().Unix()
+	for ts := now - 1; ts <= now+2; ts++ {
+		if err := os.MkdirAll(filepath.Join(fmt.Sprintf("%s.corrupt-%d", name, ts), "x"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s, err := stateSnapshots{store: newMemoryStateStore(), legacyDir: "legacy"}.load("watch")
+	if err != nil || len(s.Objects) != 0 || !s.Initial {
+		t.Errorf("Expected an empty snapshot, got %+v %v", s, err)
+	}
+	if _, err := os.Stat(name); err != nil {
+		t.Errorf("Expected the corrupt file to be left as is, got %v", err)
+	}
+}
@@ -1,16 +1,17 @@
 package server
 
 import (
-	"bytes"
 	"context"
-	"encoding/gob"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"net/http"
-	"os"
+	"net/url"
+	"regexp"
+	"sort"
+	"sync"
 	"time"
 
-	"github.com/oracle/oci-go-sdk/objectstorage"
+	"github.com/fnproject/oci-objectstore-watcher/state"
+	"github.com/wercker/pkg/log"
 )
 
 const (
@@ -19,12 +20,248 @@ const (
 	upd = "UPDATE"
 )
 
-type ObjectWatcher struct {
+// The initial sync modes, they decide which changes are sent when the bucket
+// of a watch is listed for the first time.
+const (
+	// SyncBaseline records the objects without sending any changes.
+	SyncBaseline = "baseline"
+
+	// SyncEmitAll sends every object as NEW.
+	SyncEmitAll = "emit-all"
+
+	// SyncSince sends the objects created after Watch.InitialSyncSince as
+	// NEW. Objects whose creation time the store does not return are sent
+	// as well.
+	SyncSince = "since"
+)
+
+var (
+	// ErrWatchExists is returned when adding a watch with an ID that is
+	// already in use.
+	ErrWatchExists = errors.New("watch already exists")
+
+	// ErrWatchNotFound is returned when no watch is registered for an ID.
+	ErrWatchNotFound = errors.New("watch not found")
+
+	// ErrWatcherStopped is returned when changing watches after Shutdown.
+	ErrWatcherStopped = errors.New("watcher has been shut down")
+
+	// validID restricts watch IDs to characters that are safe to use as a
+	// file name, as the ID names the cache snapshot of the watch.
+	validID = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+)
+
+// Watch is the configuration of a single watched bucket.
+type Watch struct {
+	ID           string
 	Namespace    string
-	Buckets      []string
-	WebhookURI   string
+	Bucket       string
 	PollInterval time.Duration
-	quit         chan bool
+	WebhookURI   string
+
+	// Sinks receive every change in addition to the webhook, see NewSink
+	// for the supported configurations.
+	Sinks []string
+
+	// Prefix, Include and Exclude select the objects that are watched, see
+	// objectFilter for how they are matched.
+	Prefix  string
+	Include []string
+	Exclude []string
+
+	// Events are the types of changes that are sent, NEW, UPDATE or DELETE.
+	// All changes are sent if it is empty.
+	Events []string
+
+	// Store names the object store the bucket is in, see
+	// ObjectWatcher.AddStore. The default store is used if it is empty.
+	Store string
+
+	// InitialSync is the initial sync mode, SyncBaseline, SyncEmitAll or
+	// SyncSince. It applies to a watch without a snapshot, and to a watch
+	// whose snapshot was reset or quarantined.
+	InitialSync      string
+	InitialSyncSince time.Time
+}
+
+// Validate returns an error if w cannot be watched.
+func (w Watch) Validate() error {
+	if w.ID == "" {
+		return errors.New("id is required")
+	}
+	if !validID.MatchString(w.ID) || w.ID == "." || w.ID == ".." {
+		return fmt.Errorf("invalid id %q", w.ID)
+	}
+	if w.Namespace == "" {
+		return errors.New("namespace is required")
+	}
+	if w.Bucket == "" {
+		return errors.New("bucket is required")
+	}
+	if w.PollInterval <= 0 {
+		return fmt.Errorf("invalid poll interval %v", w.PollInterval)
+	}
+	if w.WebhookURI == "" && len(w.Sinks) == 0 {
+		return errors.New("webhook url or sink is required")
+	}
+	if w.WebhookURI != "" {
+		u, err := url.Parse(w.WebhookURI)
+		if err != nil {
+			return fmt.Errorf("invalid webhook url - %v", err)
+		}
+		// The webhook is a sink as well, so it must not be one of the others
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid webhook url %q", w.WebhookURI)
+		}
+	}
+	for _, sink := range w.Sinks {
+		if err := ValidateSink(sink); err != nil {
+			return err
+		}
+	}
+	if _, err := newObjectFilter(w); err != nil {
+		return err
+	}
+	for _, event := range w.Events {
+		if event != add && event != upd && event != del {
+			return fmt.Errorf("invalid event type %q, must be one of %s, %s or %s", event, add, upd, del)
+		}
+	}
+	return w.ValidateInitialSync()
+}
+
+// ValidateInitialSync returns an error if the initial sync mode of w is
+// invalid.
+func (w Watch) ValidateInitialSync() error {
+	switch w.InitialSync {
+	case "", SyncBaseline, SyncEmitAll:
+		if !w.InitialSyncSince.IsZero() {
+			return fmt.Errorf("initial sync since is only used by the %s initial sync", SyncSince)
+		}
+	case SyncSince:
+		if w.InitialSyncSince.IsZero() {
+			return fmt.Errorf("initial sync since is required by the %s initial sync", SyncSince)
+		}
+	default:
+		return fmt.Errorf("invalid initial sync %q, must be %s, %s or %s", w.InitialSync, SyncBaseline, SyncEmitAll, SyncSince)
+	}
+	return nil
+}
+
+// initialSyncEmits returns true if object is sent as NEW when the bucket of w
+// is listed for the first time.
+func (w Watch) initialSyncEmits(object ObjectInfo) bool {
+	switch w.InitialSync {
+	case SyncBaseline:
+		return false
+	case SyncSince:
+		return object.TimeCreated.IsZero() || object.TimeCreated.After(w.InitialSyncSince)
+	}
+	return true
+}
+
+// emits returns true if changes of type event are sent for w.
+func (w Watch) emits(event string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// sinks returns the configuration of every sink of w, starting with the
+// webhook.
+func (w Watch) sinks() []string {
+	var sinks []string
+	seen := make(map[string]bool)
+	for _, sink := range append([]string{w.WebhookURI}, w.Sinks...) {
+		if sink != "" && !seen[sink] {
+			seen[sink] = true
+			sinks = append(sinks, sink)
+		}
+	}
+	return sinks
+}
+
+func sameSinks(a, b Watch) bool {
+	as, bs := a.sinks(), b.sinks()
+	if len(as) != len(bs) {
+		return false
+	}
+	for i := range as {
+		if as[i] != bs[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// withDefaults returns w with every empty field taken from defaults. The ID
+// defaults to the bucket name.
+func (w Watch) withDefaults(defaults Watch) Watch {
+	if w.Namespace == "" {
+		w.Namespace = defaults.Namespace
+	}
+	if w.PollInterval == 0 {
+		w.PollInterval = defaults.PollInterval
+	}
+	if w.Store == "" {
+		w.Store = defaults.Store
+	}
+	if w.InitialSync == "" {
+		w.InitialSync = defaults.InitialSync
+		w.InitialSyncSince = defaults.InitialSyncSince
+	}
+	if w.InitialSync == "" {
+		w.InitialSync = SyncEmitAll
+	}
+	if w.WebhookURI == "" && len(w.Sinks) == 0 {
+		w.WebhookURI = defaults.WebhookURI
+		w.Sinks = defaults.Sinks
+	}
+	if w.ID == "" {
+		w.ID = w.Bucket
+	}
+	return w
+}
+
+// ObjectWatcher polls object store buckets and sends every object that was
+// added, updated or deleted to the sinks of the watch. Each watch runs in its own
+// goroutine, watches can be added and removed while the ObjectWatcher is
+// running.
+type ObjectWatcher struct {
+	store     ObjectStore
+	defaults  Watch
+	events    *eventHub
+	deliverer *deliverer
+
+	mu        sync.RWMutex
+	snapshots snapshotStore
+	history   state.Store
+	stores    map[string]ObjectStore
+	watches   map[string]*liveWatch
+	stopped   bool
+}
+
+// liveWatch is a registered watch together with its polling goroutine. The
+// stores it uses are resolved when it is created, so its goroutines never
+// need ObjectWatcher.mu, which is held while watches are replaced.
+type liveWatch struct {
+	mu     sync.RWMutex
+	config Watch
+
+	store     ObjectStore
+	snapshots snapshotStore
+	history   state.Store
+
+	changed chan struct{}
+	ctx     context.Context
+	cancel  context.CancelFunc
+	done    chan struct{}
 }
 
 type Payload struct {
@@ -33,132 +270,498 @@ type Payload struct {
 	ObjectName  string `json:"objectName"`
 	ContentHash string `json:"contentHash"`
 	Type        string `json:"type"`
+
+	// The metadata of the object, as far as the store returns it. It is
+	// left out for deletes, and the size for empty objects. TimeCreated is
+	// in RFC 3339 format.
+	Size          int64  `json:"size,omitempty"`
+	ETag          string `json:"etag,omitempty"`
+	TimeCreated   string `json:"timeCreated,omitempty"`
+	StorageTier   string `json:"storageTier,omitempty"`
+	ArchivalState string `json:"archivalState,omitempty"`
 }
 
-func (o *ObjectWatcher) Watch(client objectstorage.ObjectStorageClient) {
+// NewObjectWatcher creates an ObjectWatcher without any watches. Buckets are
+// polled in store, unless the watch names another store. Empty fields of
+// watches that are added later are taken from defaults, changes are sent
+// according to delivery.
+func NewObjectWatcher(store ObjectStore, defaults Watch, delivery DeliveryOptions) *ObjectWatcher {
+	return &ObjectWatcher{
+		store:     store,
+		defaults:  defaults,
+		events:    newEventHub(),
+		deliverer: newDeliverer(delivery),
+		snapshots: fileSnapshots{},
+		stores:    make(map[string]ObjectStore),
+		watches:   make(map[string]*liveWatch),
+	}
+}
 
-	o.quit = make(chan bool)
-	for _, b := range o.Buckets {
-		bucket := b
-		go func() {
-			cache, err := o.loadCache(bucket)
-			if err != nil {
-				return
-			}
-			for {
-				ticker := time.NewTicker(o.PollInterval)
-				select {
-				case <-ticker.C:
-					o.updateCache(cache, client, bucket)
-					o.saveCache(cache, bucket)
-				case <-o.quit: // This channel will be closed on shutdown, so all go routines will get this message
-					ticker.Stop()
-					return
-				}
-			}
-		}()
+// AddStore registers store as name, so watches can select it with their
+// Store field.
+func (o *ObjectWatcher) AddStore(name string, store ObjectStore) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.stores[name] = store
+}
+
+// SetStateStore keeps the snapshots of watches in store instead of files in
+// the working directory, and appends every detected change to its history.
+// Watches without a snapshot in store continue from their snapshot file in
+// legacyDir, unless it is empty. It must be called before watches are added.
+func (o *ObjectWatcher) SetStateStore(store state.Store, legacyDir string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.snapshots = stateSnapshots{store: store, legacyDir: legacyDir}
+	o.history = store
+}
+
+// storeFor returns the store named name, or the default store if name is
+// empty. o.mu must be held.
+func (o *ObjectWatcher) storeFor(name string) (ObjectStore, error) {
+	if name == "" {
+		if o.store == nil {
+			return nil, errors.New("store is required, there is no default store")
+		}
+		return o.store, nil
+	}
+	store, ok := o.stores[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown store %q", name)
 	}
+	return store, nil
 }
 
-// Shutdown shuts down the watcher gracefully
-func (o *ObjectWatcher) Shutdown() {
-	close(o.quit)
+// Subscribe returns a Subscription to all changes detected by this
+// ObjectWatcher that match filter. A subscriber that reconnects passes the
+// ID of the last event it received to get the recent events it missed. The
+// caller must Close it when done.
+func (o *ObjectWatcher) Subscribe(filter EventFilter, lastEventID string) *Subscription {
+	return o.events.subscribe(filter, lastEventID)
+}
+
+// Add validates w and starts watching its bucket. The stored watch, with
+// defaults applied, is returned.
+func (o *ObjectWatcher) Add(w Watch) (Watch, error) {
+	w = w.withDefaults(o.defaults)
+	if err := o.validate(w); err != nil {
+		return Watch{}, err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.stopped {
+		return Watch{}, ErrWatcherStopped
+	}
+	if _, ok := o.watches[w.ID]; ok {
+		return Watch{}, ErrWatchExists
+	}
+	lw, err := o.newLiveWatch(w)
+	if err != nil {
+		return Watch{}, err
+	}
+	o.watches[w.ID] = lw
+	go o.run(lw)
+
+	log.WithField("watch", w.ID).WithField("bucket", w.Bucket).Info("Started watching bucket")
+	return w, nil
+}
+
+// validate returns an error if w is invalid, or if it has a sink that cannot
+// be created with the delivery options of o.
+func (o *ObjectWatcher) validate(w Watch) error {
+	if err := w.Validate(); err != nil {
+		return err
+	}
+	for _, spec := range w.sinks() {
+		if err := validateSinkOptions(spec, o.deliverer.opts); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (o *ObjectWatcher) loadCache(bucket string) (map[string]string, error) {
-	file, err := os.Open(bucket)
-	cache := make(map[string]string)
+// Get returns the watch registered as id.
+func (o *ObjectWatcher) Get(id string) (Watch, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	lw, ok := o.watches[id]
+	if !ok {
+		return Watch{}, ErrWatchNotFound
+	}
+	return lw.get(), nil
+}
+
+// List returns all registered watches ordered by ID.
+func (o *ObjectWatcher) List() []Watch {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	watches := make([]Watch, 0, len(o.watches))
+	for _, lw := range o.watches {
+		watches = append(watches, lw.get())
+	}
+	sort.Slice(watches, func(i, j int) bool { return watches[i].ID < watches[j].ID })
+	return watches
+}
+
+// Update replaces the configuration of the watch with the same ID as w. The
+// cache of the watch is kept, unless it now points to a different bucket or
+// store in which case it starts over. Changes that were not delivered to a sink that
+// is removed are dropped.
+func (o *ObjectWatcher) Update(w Watch) (Watch, error) {
+	w = w.withDefaults(o.defaults)
+	if err := o.validate(w); err != nil {
+		return Watch{}, err
+	}
+
+	o.mu.Lock()
+	prev, ok := o.watches[w.ID]
+	if !ok {
+		o.mu.Unlock()
+		return Watch{}, ErrWatchNotFound
+	}
+	old := prev.get()
+	moved := old.Store != w.Store || old.Namespace != w.Namespace || old.Bucket != w.Bucket
+	if !moved && sameSinks(old, w) {
+		prev.set(w)
+		o.mu.Unlock()
+
+		log.WithField("watch", w.ID).WithField("bucket", w.Bucket).Info("Updated watch")
+		return w, nil
+	}
+
+	lw, err := o.newLiveWatch(w)
 	if err != nil {
-		return cache, nil
+		o.mu.Unlock()
+		return Watch{}, err
+	}
+	o.watches[w.ID] = lw
+	o.mu.Unlock()
+
+	// Stopping waits for a running poll, so it is done without holding o.mu.
+	// The new goroutine starts once the old one returned, so they never
+	// share the snapshot.
+	prev.stop()
+	if moved {
+		if err := lw.snapshots.reset(w.ID); err != nil {
+			log.WithField("watch", w.ID).WithError(err).Warn("Unable to reset cache snapshot")
+		}
+	}
+	go o.run(lw)
+
+	log.WithField("watch", w.ID).WithField("bucket", w.Bucket).Info("Updated watch")
+	return w, nil
+}
+
+// Remove stops the watch registered as id and waits for it to finish.
+func (o *ObjectWatcher) Remove(id string) error {
+	o.mu.Lock()
+	lw, ok := o.watches[id]
+	delete(o.watches, id)
+	o.mu.Unlock()
+
+	if !ok {
+		return ErrWatchNotFound
 	}
-	if err := gob.NewDecoder(file).Decode(&cache); err != nil {
+	lw.stop()
+
+	log.WithField("watch", id).Info("Stopped watching bucket")
+	return nil
+}
+
+// Shutdown stops all watches and waits for them to finish. No watches can be
+// added afterwards.
+func (o *ObjectWatcher) Shutdown() {
+	o.mu.Lock()
+	o.stopped = true
+	watches := o.watches
+	o.watches = make(map[string]*liveWatch)
+	o.mu.Unlock()
+
+	for _, lw := range watches {
+		lw.stop()
+	}
+}
+
+// newLiveWatch returns a liveWatch of w that uses the stores of o. o.mu must
+// be held.
+func (o *ObjectWatcher) newLiveWatch(w Watch) (*liveWatch, error) {
+	store, err := o.storeFor(w.Store)
+	if err != nil {
 		return nil, err
 	}
-	return cache, nil
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &liveWatch{
+		config:    w,
+		store:     store,
+		snapshots: o.snapshots,
+		history:   o.history,
+		changed:   make(chan struct{}, 1),
+		ctx:       ctx,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+	}, nil
 }
 
-func (o *ObjectWatcher) saveCache(cache map[string]string, bucket string) {
-	file, err := os.Create(bucket)
+func (lw *liveWatch) get() Watch {
+	lw.mu.RLock()
+	defer lw.mu.RUnlock()
+	return lw.config
+}
+
+func (lw *liveWatch) set(w Watch) {
+	lw.mu.Lock()
+	lw.config = w
+	lw.mu.Unlock()
+
+	select {
+	case lw.changed <- struct{}{}:
+	default:
+	}
+}
+
+// stop cancels the polling goroutine, including any change it is retrying,
+// and waits for it to return.
+func (lw *liveWatch) stop() {
+	lw.cancel()
+	<-lw.done
+}
+
+// run polls the bucket of lw until it is stopped. Detected changes go into
+// the outbox of the watch which is drained by a dispatcher for every sink.
+func (o *ObjectWatcher) run(lw *liveWatch) {
+	defer close(lw.done)
+
+	w := lw.get()
+	specs := w.sinks()
+	st, err := loadWatchState(lw.snapshots, w.ID, specs)
+	for err != nil {
+		// Corrupt snapshots are quarantined, so this is a store that is
+		// unavailable
+		log.WithField("watch", w.ID).WithError(err).Errorf("Unable to load cache snapshot, trying again in %v", w.PollInterval)
+		select {
+		case <-time.After(w.PollInterval):
+		case <-lw.ctx.Done():
+			return
+		}
+		st, err = loadWatchState(lw.snapshots, w.ID, specs)
+	}
+
+	var wg sync.WaitGroup
+	defer func() {
+		wg.Wait()
+		if err := st.flush(); err != nil {
+			log.WithField("watch", w.ID).WithError(err).Error("Unable to save outbox, delivered changes may be sent again after a restart")
+		}
+	}()
+
+	// Changes are only added to the outbox of sinks that were created, the
+	// outbox of a sink that failed is kept until the watch is restarted
+	var started []string
+	for _, spec := range specs {
+		sink, err := NewSink(spec, o.deliverer.opts)
+		if err != nil {
+			log.WithField("watch", w.ID).WithField("sink", spec).WithError(err).Error("Unable to create sink, changes are not sent to it until the watch is restarted")
+			continue
+		}
+		started = append(started, spec)
+
+		wg.Add(1)
+		go func(spec string, sink Sink) {
+			defer wg.Done()
+			defer sink.Close()
+			o.dispatch(lw, st, spec, sink)
+		}(spec, sink)
+	}
+
+	timer := time.NewTimer(w.PollInterval)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			w = lw.get()
+			o.poll(lw, st, w, started)
+			timer.Reset(w.PollInterval)
+		case <-lw.changed:
+			// Pick up a new poll interval right away
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			w = lw.get()
+			timer.Reset(w.PollInterval)
+		case <-lw.ctx.Done():
+			return
+		}
+	}
+}
+
+// poll compares the objects in the bucket of w with the ones last seen and
+// commits every difference to the outbox of st for sinks. The first time the
+// bucket is listed the initial sync mode of w decides which objects are sent.
+func (o *ObjectWatcher) poll(lw *liveWatch, st *watchState, w Watch, sinks []string) {
+	filter, err := newObjectFilter(w)
 	if err != nil {
-		fmt.Printf("Failed to save snapshot of cache to file due to %v\n", err)
+		log.WithField("watch", w.ID).WithError(err).Error("Invalid object filter")
 		return
 	}
-	if err = gob.NewEncoder(file).Encode(cache); err != nil {
-		fmt.Printf("Failed to save snapshot of cache to file due to %v\n", err)
+
+	newList, err := list(lw.ctx, lw.store, w, filter)
+	if err != nil {
+		log.WithField("watch", w.ID).WithError(err).Error("Failed to fetch object list")
+		return
+	}
+
+	known, initial := st.known()
+	detected := diff(w, filter, known, newList)
+	if len(detected) == 0 && !initial {
+		return
 	}
-}
 
-func (o *ObjectWatcher) updateCache(cache map[string]string, client objectstorage.ObjectStorageClient, bucket string) {
+	// Changes that are not sent still have to be committed, so they are not
+	// detected again on the next poll
+	var changes []Payload
+	for _, p := range detected {
+		if w.emits(p.Type) && (!initial || w.initialSyncEmits(newList[p.ObjectName])) {
+			changes = append(changes, p)
+		}
+	}
+	if initial {
+		log.WithField("watch", w.ID).WithField("mode", w.InitialSync).WithField("objects", len(newList)).WithField("changes", len(changes)).Info("Initial sync of bucket")
+	}
 
-	newList, err := o.list(client, bucket)
+	objects := knownObjects{md5s: make(map[string]string, len(newList)), etags: make(map[string]string)}
+	for name, object := range newList {
+		objects.md5s[name] = object.MD5
+		if object.ETag != "" {
+			objects.etags[name] = object.ETag
+		}
+	}
+	committed, err := st.commit(objects, changes, sinks)
 	if err != nil {
-		fmt.Printf("Failed to fetch object list: %v\n", err)
+		log.WithField("watch", w.ID).WithError(err).Error("Failed to save changes, they will be detected again on the next poll")
 		return
 	}
 
-	for name, md5 := range cache {
+	for _, p := range changes {
+		o.events.publish(p)
+	}
+	record(lw, w, committed)
+}
 
-		newMd5, ok := newList[name]
+// record appends the committed changes of w to the history of lw. The
+// changes are already in the outbox, so a failure only leaves a gap in the
+// history.
+func record(lw *liveWatch, w Watch, changes []Change) {
+	if lw.history == nil || len(changes) == 0 {
+		return
+	}
+
+	events := make([]state.Event, 0, len(changes))
+	for _, c := range changes {
+		events = append(events, stateEvent(w.ID, c))
+	}
+	if err := lw.history.AppendEvents(lw.ctx, events); err != nil {
+		log.WithField("watch", w.ID).WithError(err).Warn("Unable to append changes to the event history")
+	}
+}
+
+// knownObjects are the objects of a bucket that were last committed, by name
+// with their MD5 and, if the store returned one, their ETag.
+type knownObjects struct {
+	md5s  map[string]string
+	etags map[string]string
+}
+
+// changed returns true if object differs from the known object of the same
+// name. ETags are only compared if both are known, so objects that were
+// committed before ETags were tracked are not all reported as updated.
+func (k knownObjects) changed(object ObjectInfo) bool {
+	if object.MD5 != k.md5s[object.Name] {
+		return true
+	}
+	etag := k.etags[object.Name]
+	return etag != "" && object.ETag != "" && etag != object.ETag
+}
+
+// diff returns a change for every object that differs between cache and
+// newList. Cached objects that are not selected by filter are ignored, so
+// narrowing the filter of a watch does not report them as deleted.
+func diff(w Watch, filter *objectFilter, cache knownObjects, newList map[string]ObjectInfo) []Payload {
+	var changes []Payload
+	for name, md5 := range cache.md5s {
+		if !filter.match(name) {
+			continue
+		}
+
+		object, ok := newList[name]
 		if !ok {
-			delete(cache, name)
-			o.callHook(del, bucket, name, md5)
-		} else if newMd5 != md5 {
-			cache[name] = newMd5
-			o.callHook(upd, bucket, name, newMd5)
+			changes = append(changes, newPayload(w, del, ObjectInfo{Name: name, MD5: md5}))
+		} else if cache.changed(object) {
+			changes = append(changes, newPayload(w, upd, object))
 		}
-		delete(newList, name)
 	}
 
-	for name, md5 := range newList {
-		cache[name] = md5
-		o.callHook(add, bucket, name, md5)
+	for name, object := range newList {
+		if _, ok := cache.md5s[name]; !ok {
+			changes = append(changes, newPayload(w, add, object))
+		}
 	}
+
+	return changes
 }
 
-func (o *ObjectWatcher) list(client objectstorage.ObjectStorageClient, bucket string) (map[string]string, error) {
+// list returns every object in the bucket of w in store that is selected by
+// filter, by name. The prefix of the filter is left to the object store.
+func list(ctx context.Context, store ObjectStore, w Watch, filter *objectFilter) (map[string]ObjectInfo, error) {
+	request := ListRequest{
+		Namespace: w.Namespace,
+		Bucket:    w.Bucket,
+		Prefix:    filter.prefix,
+		Limit:     1000,
+	}
 
-	limit := 1000
-	startWith := ""
-	objects := make(map[string]string)
+	objects := make(map[string]ObjectInfo)
 	for {
-		response, err := client.ListObjects(context.Background(), objectstorage.ListObjectsRequest{
-			BucketName:    &bucket,
-			Fields:        "name,md5",
-			Limit:         &limit,
-			NamespaceName: &o.Namespace,
-			Start:         &startWith,
-		})
-
+		page, err := store.List(ctx, request)
 		if err != nil {
 			return nil, err
 		}
 
-		for _, object := range response.ListObjects.Objects {
-			objects[*object.Name] = *object.Md5
+		for _, object := range page.Objects {
+			if filter.match(object.Name) {
+				objects[object.Name] = object
+			}
 		}
 
-		if response.NextStartWith == nil || *response.NextStartWith == "" {
+		if page.Next == "" {
 			return objects, nil
 		}
-		startWith = *response.NextStartWith
+		request.Start = page.Next
 	}
 }
 
-func (o *ObjectWatcher) callHook(event string, bucket string, objectName string, md5 string) error {
-	payload := Payload{
-		Bucket:      bucket,
-		Type:        event,
-		ContentHash: md5,
-		Namespace:   o.Namespace,
-		ObjectName:  objectName,
+func newPayload(w Watch, event string, object ObjectInfo) Payload {
+	p := Payload{
+		Bucket:        w.Bucket,
+		Type:          event,
+		ContentHash:   object.MD5,
+		Namespace:     w.Namespace,
+		ObjectName:    object.Name,
+		Size:          object.Size,
+		ETag:          object.ETag,
+		StorageTier:   object.StorageTier,
+		ArchivalState: object.ArchivalState,
 	}
-
-	b, err := json.Marshal(payload)
-	if err != nil {
-		return err
+	if !object.TimeCreated.IsZero() {
+		p.TimeCreated = object.TimeCreated.UTC().Format(time.RFC3339Nano)
 	}
-
-	fmt.Printf("Posting %v to %s\n", string(b), o.WebhookURI)
-	_, err = http.DefaultClient.Post(o.WebhookURI, "application/json", bytes.NewBuffer(b))
-	return err
+	return p
 }
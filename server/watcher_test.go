@@ -0,0 +1,682 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2017 Oracle and/or its affiliates.  All rights reserved.
+// This program is free software: you can modify it and/or redistribute it
+// under the terms of:
+//
+// (i)  the Universal Permissive License v 1.0 or at your option, any
+//      later version (http://oss.oracle.com/licenses/upl); and/or
+//
+// (ii) the Apache License v 2.0. (http://www.apache.org/licenses/LICENSE-2.0)
+//-----------------------------------------------------------------------------
+
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fnproject/oci-objectstore-watcher/objectstoretest"
+)
+
+const (
+	testNamespace    = "ns"
+	testBucket       = "bucket"
+	testPollInterval = 20 * time.Millisecond
+	testTimeout      = 5 * time.Second
+)
+
+var testDelivery = DeliveryOptions{
+	Retries:        3,
+	InitialBackoff: 10 * time.Millisecond,
+	MaxBackoff:     50 * time.Millisecond,
+	Timeout:        time.Second,
+}
+
+// hookCall is a webhook call received by a hookRecorder.
+type hookCall struct {
+	DeliveryID string
+	Payload    Payload
+}
+
+// hookRecorder is a webhook that records every call it accepts. It rejects
+// the first failures calls with failureStatus, 503 if it is not set.
+type hookRecorder struct {
+	*httptest.Server
+
+	mu            sync.Mutex
+	calls         []hookCall
+	rejected      []string
+	failures      int
+	failureStatus int
+}
+
+func newHookRecorder() *hookRecorder {
+	h := &hookRecorder{}
+	h.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p Payload
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		if h.failures > 0 {
+			h.failures--
+			h.rejected = append(h.rejected, r.Header.Get(DeliveryHeader))
+			if h.failureStatus != 0 {
+				w.WriteHeader(h.failureStatus)
+			} else {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+			return
+		}
+		h.calls = append(h.calls, hookCall{DeliveryID: r.Header.Get(DeliveryHeader), Payload: p})
+	}))
+	return h
+}
+
+// waitFor waits until n calls were accepted and returns them.
+func (h *hookRecorder) waitFor(t *testing.T, n int) []hookCall {
+	deadline := time.Now().Add(testTimeout)
+	for {
+		h.mu.Lock()
+		calls := append([]hookCall(nil), h.calls...)
+		h.mu.Unlock()
+
+		if len(calls) >= n {
+			return calls
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d webhook calls, got %d: %v", n, len(calls), calls)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// expectNoMoreCalls fails if more than n calls are accepted during a few
+// poll intervals.
+func (h *hookRecorder) expectNoMoreCalls(t *testing.T, n int) {
+	time.Sleep(10 * testPollInterval)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.calls) != n {
+		t.Errorf("Expected %d webhook calls, got %d: %v", n, len(h.calls), h.calls)
+	}
+}
+
+// changes returns the type and object name of calls, sorted, so changes
+// detected in the same poll can be compared regardless of their order.
+func changes(calls []hookCall) []string {
+	var s []string
+	for _, c := range calls {
+		s = append(s, c.Payload.Type+" "+c.Payload.ObjectName)
+	}
+	sort.Strings(s)
+	return s
+}
+
+func expectChanges(t *testing.T, calls []hookCall, expected ...string) {
+	got := changes(calls)
+	sort.Strings(expected)
+	if len(got) != len(expected) {
+		t.Fatalf("Expected changes %v, got %v", expected, got)
+	}
+	for i := range got {
+		if got[i] != expected[i] {
+			t.Fatalf("Expected changes %v, got %v", expected, got)
+		}
+	}
+}
+
+// inTempDir runs the test in a temporary directory, as the cache snapshots
+// are written to the working directory. The returned func restores it.
+func inTempDir(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "watcher-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	return func() {
+		os.Chdir(wd)
+		os.RemoveAll(dir)
+	}
+}
+
+func newTestWatcher(t *testing.T, store *objectstoretest.Server) *ObjectWatcher {
+	client, err := store.Client()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewObjectWatcher(NewOCIObjectStore(client), Watch{
+		Namespace:    testNamespace,
+		PollInterval: testPollInterval,
+	}, testDelivery)
+}
+
+func addWatch(t *testing.T, o *ObjectWatcher, w Watch) {
+	if w.Bucket == "" {
+		w.Bucket = testBucket
+	}
+	if _, err := o.Add(w); err != nil {
+		t.Fatalf("Unable to add watch: %v", err)
+	}
+}
+
+func TestWatcherReportsChanges(t *testing.T) {
+	defer inTempDir(t)()
+
+	store := objectstoretest.NewServer()
+	defer store.Close()
+	hook := newHookRecorder()
+	defer hook.Close()
+
+	store.PutObject(testNamespace, testBucket, "a", []byte("a"))
+	store.PutObject(testNamespace, testBucket, "b", []byte("b"))
+
+	o := newTestWatcher(t, store)
+	defer o.Shutdown()
+	addWatch(t, o, Watch{WebhookURI: hook.URL})
+
+	calls := hook.waitFor(t, 2)
+	expectChanges(t, calls, "NEW a", "NEW b")
+	for _, c := range calls {
+		if c.Payload.Namespace != testNamespace || c.Payload.Bucket != testBucket {
+			t.Errorf("Unexpected payload %+v", c.Payload)
+		}
+		if c.DeliveryID == "" {
+			t.Errorf("Call for %s has no delivery ID", c.Payload.ObjectName)
+		}
+	}
+
+	store.PutObject(testNamespace, testBucket, "a", []byte("changed"))
+	store.DeleteObject(testNamespace, testBucket, "b")
+	store.PutObject(testNamespace, testBucket, "c", []byte("c"))
+
+	calls = hook.waitFor(t, 5)
+	expectChanges(t, calls[2:], "UPDATE a", "DELETE b", "NEW c")
+
+	a, _ := store.Object(testNamespace, testBucket, "a")
+	for _, c := range calls[2:] {
+		if c.Payload.Type == upd && c.Payload.ContentHash != a.MD5 {
+			t.Errorf("Expected content hash %s, got %s", a.MD5, c.Payload.ContentHash)
+		}
+	}
+
+	hook.expectNoMoreCalls(t, 5)
+}
+
+func TestWatcherReportsMetadata(t *testing.T) {
+	defer inTempDir(t)()
+
+	store := objectstoretest.NewServer()
+	defer store.Close()
+	hook := newHookRecorder()
+	defer hook.Close()
+
+	store.PutObject(testNamespace, testBucket, "a", []byte("hello"))
+
+	o := newTestWatcher(t, store)
+	defer o.Shutdown()
+	addWatch(t, o, Watch{WebhookURI: hook.URL})
+
+	calls := hook.waitFor(t, 1)
+	a, _ := store.Object(testNamespace, testBucket, "a")
+	p := calls[0].Payload
+	if p.Size != 5 || p.ETag != a.ETag || p.StorageTier != "Standard" {
+		t.Errorf("Unexpected metadata %+v", p)
+	}
+	if _, err := time.Parse(time.RFC3339, p.TimeCreated); err != nil {
+		t.Errorf("Invalid timeCreated %q - %v", p.TimeCreated, err)
+	}
+
+	// Rewriting the same content only changes the ETag
+	store.PutObject(testNamespace, testBucket, "a", []byte("hello"))
+
+	calls = hook.waitFor(t, 2)
+	expectChanges(t, calls[1:], "UPDATE a")
+	rewritten, _ := store.Object(testNamespace, testBucket, "a")
+	if p := calls[1].Payload; p.ContentHash != a.MD5 || p.ETag != rewritten.ETag {
+		t.Errorf("Unexpected payload %+v", p)
+	}
+
+	hook.expectNoMoreCalls(t, 2)
+}
+
+func TestWatcherPaginates(t *testing.T) {
+	defer inTempDir(t)()
+
+	store := objectstoretest.NewServer()
+	defer store.Close()
+	hook := newHookRecorder()
+	defer hook.Close()
+
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		store.PutObject(testNamespace, testBucket, name, []byte(name))
+	}
+	store.SetPageSize(2)
+
+	o := newTestWatcher(t, store)
+	defer o.Shutdown()
+	addWatch(t, o, Watch{WebhookURI: hook.URL})
+
+	expectChanges(t, hook.waitFor(t, 5), "NEW a", "NEW b", "NEW c", "NEW d", "NEW e")
+	hook.expectNoMoreCalls(t, 5)
+
+	starts := map[string]bool{}
+	for _, r := range store.Requests() {
+		starts[r.Query.Get("start")] = true
+	}
+	if !starts["c"] || !starts["e"] {
+		t.Errorf("Expected pages starting with c and e, got %v", starts)
+	}
+}
+
+func TestWatcherSurvivesListErrors(t *testing.T) {
+	defer inTempDir(t)()
+
+	store := objectstoretest.NewServer()
+	defer store.Close()
+	hook := newHookRecorder()
+	defer hook.Close()
+
+	store.PutObject(testNamespace, testBucket, "a", []byte("a"))
+	store.FailNext(3, http.StatusInternalServerError)
+
+	o := newTestWatcher(t, store)
+	defer o.Shutdown()
+	addWatch(t, o, Watch{WebhookURI: hook.URL})
+
+	expectChanges(t, hook.waitFor(t, 1), "NEW a")
+	hook.expectNoMoreCalls(t, 1)
+}
+
+func TestWatcherRetriesWebhook(t *testing.T) {
+	defer inTempDir(t)()
+
+	store := objectstoretest.NewServer()
+	defer store.Close()
+	hook := newHookRecorder()
+	defer hook.Close()
+	hook.failures = 2
+
+	store.PutObject(testNamespace, testBucket, "a", []byte("a"))
+
+	o := newTestWatcher(t, store)
+	defer o.Shutdown()
+	addWatch(t, o, Watch{WebhookURI: hook.URL})
+
+	calls := hook.waitFor(t, 1)
+	expectChanges(t, calls, "NEW a")
+	hook.expectNoMoreCalls(t, 1)
+
+	hook.mu.Lock()
+	defer hook.mu.Unlock()
+	if len(hook.rejected) != 2 {
+		t.Fatalf("Expected 2 rejected calls, got %d", len(hook.rejected))
+	}
+	for _, id := range hook.rejected {
+		if id != calls[0].DeliveryID {
+			t.Errorf("Expected retries to use delivery ID %s, got %s", calls[0].DeliveryID, id)
+		}
+	}
+}
+
+// waitForRejected waits until n calls were rejected.
+func (h *hookRecorder) waitForRejected(t *testing.T, n int) {
+	deadline := time.Now().Add(testTimeout)
+	for {
+		h.mu.Lock()
+		rejected := len(h.rejected)
+		h.mu.Unlock()
+
+		if rejected >= n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d rejected webhook calls, got %d", n, rejected)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestWatcherDropsRejectedChanges(t *testing.T) {
+	defer inTempDir(t)()
+
+	store := objectstoretest.NewServer()
+	defer store.Close()
+	hook := newHookRecorder()
+	defer hook.Close()
+	hook.failures = 1
+	hook.failureStatus = http.StatusBadRequest
+
+	store.PutObject(testNamespace, testBucket, "a", []byte("a"))
+
+	o := newTestWatcher(t, store)
+	defer o.Shutdown()
+	addWatch(t, o, Watch{WebhookURI: hook.URL})
+
+	// A change the webhook rejects for good does not block the next one
+	hook.waitForRejected(t, 1)
+	store.PutObject(testNamespace, testBucket, "b", []byte("b"))
+
+	expectChanges(t, hook.waitFor(t, 1), "NEW b")
+	hook.expectNoMoreCalls(t, 1)
+
+	hook.mu.Lock()
+	defer hook.mu.Unlock()
+	if len(hook.rejected) != 1 {
+		t.Errorf("Expected the bad request not to be retried, got %d calls", len(hook.rejected))
+	}
+}
+
+func TestWatcherDropsChangesAfterAttempts(t *testing.T) {
+	defer inTempDir(t)()
+
+	store := objectstoretest.NewServer()
+	defer store.Close()
+	hook := newHookRecorder()
+	defer hook.Close()
+	hook.failures = 2
+
+	store.PutObject(testNamespace, testBucket, "a", []byte("a"))
+
+	client, err := store.Client()
+	if err != nil {
+		t.Fatal(err)
+	}
+	delivery := testDelivery
+	delivery.Retries = 0
+	delivery.Attempts = 2
+	o := NewObjectWatcher(NewOCIObjectStore(client), Watch{Namespace: testNamespace, PollInterval: testPollInterval}, delivery)
+	defer o.Shutdown()
+	addWatch(t, o, Watch{WebhookURI: hook.URL})
+
+	hook.waitForRejected(t, 2)
+	store.PutObject(testNamespace, testBucket, "b", []byte("b"))
+
+	expectChanges(t, hook.waitFor(t, 1), "NEW b")
+	hook.expectNoMoreCalls(t, 1)
+}
+
+func TestWatcherSkipsSinksThatFailed(t *testing.T) {
+	defer inTempDir(t)()
+
+	store := objectstoretest.NewServer()
+	defer store.Close()
+	hook := newHookRecorder()
+	defer hook.Close()
+
+	store.PutObject(testNamespace, testBucket, "a", []byte("a"))
+
+	o := newTestWatcher(t, store)
+	addWatch(t, o, Watch{ID: "w", WebhookURI: hook.URL, Sinks: []string{"file:missing/changes.json"}})
+
+	expectChanges(t, hook.waitFor(t, 1), "NEW a")
+	o.Shutdown()
+
+	// The file sink cannot be opened, so nothing is queued for it
+	s, err := loadSnapshot("", "w")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Outbox) != 0 {
+		t.Errorf("Expected an empty outbox, got %+v", s.Outbox)
+	}
+}
+
+func TestWatcherFilters(t *testing.T) {
+	defer inTempDir(t)()
+
+	store := objectstoretest.NewServer()
+	defer store.Close()
+	hook := newHookRecorder()
+	defer hook.Close()
+
+	store.PutObject(testNamespace, testBucket, "logs/a.csv", nil)
+	store.PutObject(testNamespace, testBucket, "uploads/a.csv", nil)
+	store.PutObject(testNamespace, testBucket, "uploads/a.log", nil)
+
+	o := newTestWatcher(t, store)
+	defer o.Shutdown()
+	addWatch(t, o, Watch{
+		WebhookURI: hook.URL,
+		Prefix:     "uploads/",
+		Include:    []string{"*.csv"},
+	})
+
+	expectChanges(t, hook.waitFor(t, 1), "NEW uploads/a.csv")
+	hook.expectNoMoreCalls(t, 1)
+
+	for _, r := range store.Requests() {
+		if p := r.Query.Get("prefix"); p != "uploads/" {
+			t.Errorf("Expected the prefix to be pushed down, got %q", p)
+		}
+	}
+}
+
+func TestWatcherResumesFromSnapshot(t *testing.T) {
+	defer inTempDir(t)()
+
+	store := objectstoretest.NewServer()
+	defer store.Close()
+	hook := newHookRecorder()
+	defer hook.Close()
+
+	store.PutObject(testNamespace, testBucket, "a", []byte("a"))
+
+	o := newTestWatcher(t, store)
+	addWatch(t, o, Watch{WebhookURI: hook.URL})
+	expectChanges(t, hook.waitFor(t, 1), "NEW a")
+	o.Shutdown()
+
+	// Changed while the watcher was down
+	store.PutObject(testNamespace, testBucket, "b", []byte("b"))
+
+	o = newTestWatcher(t, store)
+	defer o.Shutdown()
+	addWatch(t, o, Watch{WebhookURI: hook.URL})
+
+	calls := hook.waitFor(t, 2)
+	expectChanges(t, calls[1:], "NEW b")
+	hook.expectNoMoreCalls(t, 2)
+}
+
+func TestWatcherShutdownWithSlowStore(t *testing.T) {
+	defer inTempDir(t)()
+
+	store := objectstoretest.NewServer()
+	defer store.Close()
+	hook := newHookRecorder()
+	defer hook.Close()
+
+	store.CreateBucket(testNamespace, testBucket)
+	store.SetLatency(10 * time.Second)
+
+	o := newTestWatcher(t, store)
+	addWatch(t, o, Watch{WebhookURI: hook.URL})
+
+	// Wait for the first poll to be in flight
+	deadline := time.Now().Add(testTimeout)
+	for len(store.Requests()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the bucket to be polled")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		o.Shutdown()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Shutdown waited for the slow poll")
+	}
+}
+
+// withinTimeout fails the test if f does not return within testTimeout.
+func withinTimeout(t *testing.T, what string, f func()) {
+	done := make(chan struct{})
+	go func() {
+		f()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(testTimeout):
+		t.Fatalf("%s did not return within %v", what, testTimeout)
+	}
+}
+
+func TestWatcherUpdateMovesWatch(t *testing.T) {
+	defer inTempDir(t)()
+
+	store := objectstoretest.NewServer()
+	defer store.Close()
+	hook := newHookRecorder()
+	defer hook.Close()
+
+	store.PutObject(testNamespace, "other", "b", []byte("b"))
+
+	o := newTestWatcher(t, store)
+	defer o.Shutdown()
+	addWatch(t, o, Watch{ID: "w", WebhookURI: hook.URL})
+
+	// The new watch is still starting, which used to deadlock
+	withinTimeout(t, "Update", func() {
+		if _, err := o.Update(Watch{ID: "w", Bucket: "other", WebhookURI: hook.URL}); err != nil {
+			t.Errorf("Unable to update watch: %v", err)
+		}
+	})
+	withinTimeout(t, "List", func() { o.List() })
+
+	expectChanges(t, hook.waitFor(t, 1), "NEW b")
+	if w, err := o.Get("w"); err != nil || w.Bucket != "other" {
+		t.Errorf("Expected the watch to be moved, got %+v (%v)", w, err)
+	}
+}
+
+func TestWatcherUpdateDuringPoll(t *testing.T) {
+	defer inTempDir(t)()
+
+	store := objectstoretest.NewServer()
+	defer store.Close()
+	hook := newHookRecorder()
+	defer hook.Close()
+
+	store.PutObject(testNamespace, testBucket, "a", []byte("a"))
+	store.PutObject(testNamespace, "other", "b", []byte("b"))
+
+	o := newTestWatcher(t, store)
+	defer o.Shutdown()
+	addWatch(t, o, Watch{ID: "w", PollInterval: time.Millisecond, WebhookURI: hook.URL})
+
+	// With a poll interval this short, most updates stop a running poll
+	for i, bucket := range []string{"other", testBucket, "other", testBucket, "other", testBucket, "other", testBucket} {
+		time.Sleep(time.Duration(i) * time.Millisecond)
+		withinTimeout(t, "Update", func() {
+			if _, err := o.Update(Watch{ID: "w", Bucket: bucket, PollInterval: time.Millisecond, WebhookURI: hook.URL}); err != nil {
+				t.Errorf("Unable to update watch: %v", err)
+			}
+		})
+	}
+}
+
+func TestWatcherInitialSync(t *testing.T) {
+	defer inTempDir(t)()
+
+	store := objectstoretest.NewServer()
+	defer store.Close()
+
+	store.PutObject(testNamespace, testBucket, "old", []byte("old"))
+	a, _ := store.Object(testNamespace, testBucket, "old")
+	// Creation times are listed in seconds
+	time.Sleep(a.TimeCreated.Truncate(time.Second).Add(time.Second).Sub(time.Now()))
+	store.PutObject(testNamespace, testBucket, "recent", []byte("recent"))
+
+	modes := map[string]struct {
+		watch    Watch
+		expected []string
+	}{
+		"baseline": {Watch{InitialSync: SyncBaseline}, nil},
+		"emit-all": {Watch{InitialSync: SyncEmitAll}, []string{"NEW old", "NEW recent"}},
+		"since":    {Watch{InitialSync: SyncSince, InitialSyncSince: a.TimeCreated}, []string{"NEW recent"}},
+	}
+	for name, mode := range modes {
+		hook := newHookRecorder()
+		defer hook.Close()
+
+		o := newTestWatcher(t, store)
+		mode.watch.ID = name
+		mode.watch.WebhookURI = hook.URL
+		addWatch(t, o, mode.watch)
+
+		if len(mode.expected) > 0 {
+			expectChanges(t, hook.waitFor(t, len(mode.expected)), mode.expected...)
+		}
+		hook.expectNoMoreCalls(t, len(mode.expected))
+		o.Shutdown()
+
+		// Later changes are sent, also after a restart
+		o = newTestWatcher(t, store)
+		addWatch(t, o, mode.watch)
+		store.PutObject(testNamespace, testBucket, name, []byte(name))
+		calls := hook.waitFor(t, len(mode.expected)+1)
+		expectChanges(t, calls[len(mode.expected):], "NEW "+name)
+		o.Shutdown()
+		store.DeleteObject(testNamespace, testBucket, name)
+	}
+}
+
+func TestWatchValidatesInitialSync(t *testing.T) {
+	w := Watch{ID: "id", Namespace: testNamespace, Bucket: testBucket, PollInterval: time.Second, WebhookURI: "http://localhost"}
+	since := time.Now()
+
+	invalid := map[string]Watch{
+		"unknown mode":        {InitialSync: "some"},
+		"since without time":  {InitialSync: SyncSince},
+		"time without since":  {InitialSync: SyncBaseline, InitialSyncSince: since},
+		"time without a mode": {InitialSyncSince: since},
+	}
+	for name, sync := range invalid {
+		w.InitialSync, w.InitialSyncSince = sync.InitialSync, sync.InitialSyncSince
+		if err := w.Validate(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	w.InitialSync, w.InitialSyncSince = SyncSince, since
+	if err := w.Validate(); err != nil {
+		t.Error(err)
+	}
+
+	// The mode and time of the defaults are used together
+	w = Watch{Bucket: testBucket}.withDefaults(Watch{InitialSync: SyncSince, InitialSyncSince: since})
+	if w.InitialSync != SyncSince || !w.InitialSyncSince.Equal(since) {
+		t.Errorf("Unexpected initial sync %s %v", w.InitialSync, w.InitialSyncSince)
+	}
+	if w := (Watch{Bucket: testBucket}).withDefaults(Watch{}); w.InitialSync != SyncEmitAll {
+		t.Errorf("Expected %s by default, got %s", SyncEmitAll, w.InitialSync)
+	}
+}
@@ -0,0 +1,90 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2017 Oracle and/or its affiliates.  All rights reserved.
+// This program is free software: you can modify it and/or redistribute it
+// under the terms of:
+//
+// (i)  the Universal Permissive License v 1.0 or at your option, any
+//      later version (http://oss.oracle.com/licenses/upl); and/or
+//
+// (ii) the Apache License v 2.0. (http://www.apache.org/licenses/LICENSE-2.0)
+//-----------------------------------------------------------------------------
+
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"flag"
+	"strings"
+	"testing"
+
+	"github.com/oracle/oci-go-sdk/common"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// parseServerFlags parses args with the flags of the server command.
+func parseServerFlags(t *testing.T, args ...string) (*serverOptions, error) {
+	set := flag.NewFlagSet("server", flag.ContinueOnError)
+	for _, f := range serverCommand.Flags {
+		f.Apply(set)
+	}
+	if err := set.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return parseServerOptions(cli.NewContext(nil, set, nil))
+}
+
+// testConfigurationProvider returns an api-key provider of region.
+func testConfigurationProvider(t *testing.T, region string) common.ConfigurationProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	return common.NewRawConfigurationProvider(testTenancy, "ocid1.user.oc1..aaaaaaaatest", region, "aa:bb", string(keyPEM), nil)
+}
+
+func TestNewObjectStorageClient(t *testing.T) {
+	provider := testConfigurationProvider(t, "us-phoenix-1")
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{name: "auth region", expected: "objectstorage.us-phoenix-1.oraclecloud.com"},
+		{name: "region", args: []string{"--region", "uk-london-1"}, expected: "objectstorage.uk-london-1.oraclecloud.com"},
+		{name: "endpoint", args: []string{"--endpoint", "http://localhost:8080"}, expected: "http://localhost:8080"},
+		{name: "endpoint overrides region", args: []string{"--region", "uk-london-1", "--endpoint", "http://localhost:8080"}, expected: "http://localhost:8080"},
+	}
+
+	for _, test := range tests {
+		o, err := parseServerFlags(t, append([]string{"--auth", authInstancePrincipal}, test.args...)...)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		client, err := newObjectStorageClient(provider, o.Region, o.Endpoint)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if client.Host != test.expected {
+			t.Errorf("%s: expected the host %s, got %s", test.name, test.expected, client.Host)
+		}
+	}
+}
+
+func TestNewObjectStorageClientErrors(t *testing.T) {
+	if _, err := parseServerFlags(t, "--auth", authInstancePrincipal, "--region", "objectstorage.evil.com/"); err == nil || !strings.Contains(err.Error(), "invalid region") {
+		t.Errorf("Expected the region flag to be rejected, got %v", err)
+	}
+	if _, err := newObjectStorageClient(testConfigurationProvider(t, "us-phoenix-1"), "US Phoenix", ""); err == nil || !strings.Contains(err.Error(), "invalid region") {
+		t.Errorf("Expected an invalid region to be rejected, got %v", err)
+	}
+	if _, err := newObjectStorageClient(testConfigurationProvider(t, "nowhere"), "", ""); err == nil {
+		t.Error("Expected an unknown region of the authentication to be rejected")
+	}
+}
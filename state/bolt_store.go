@@ -0,0 +1,330 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2017 Oracle and/or its affiliates.  All rights reserved.
+// This program is free software: you can modify it and/or redistribute it
+// under the terms of:
+//
+// (i)  the Universal Permissive License v 1.0 or at your option, any
+//      later version (http://oss.oracle.com/licenses/upl); and/or
+//
+// (ii) the Apache License v 2.0. (http://www.apache.org/licenses/LICENSE-2.0)
+//-----------------------------------------------------------------------------
+
+package state
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltFile is the name of the database file of a BoltStore in its data
+// directory.
+const BoltFile = "oci-objectstore-watcher.db"
+
+// The top level buckets of the BoltStore. Every watch has its own bucket in
+// snapshots, with the buckets objects, etags and outbox and the initialKey
+// while the snapshot is initial. Events are keyed by their time, eventIDs is used
+// to skip events that are already stored.
+var (
+	initialKey      = []byte("initial")
+	snapshotsBucket = []byte("snapshots")
+	objectsBucket   = []byte("objects")
+	etagsBucket     = []byte("etags")
+	outboxBucket    = []byte("outbox")
+	eventsBucket    = []byte("events")
+	eventIDsBucket  = []byte("event_ids")
+)
+
+// NewBoltStore creates a new BoltStore with its database in dir. The
+// directory is created if it does not exist. Only one process can open the
+// database at a time.
+func NewBoltStore(dir string) (*BoltStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	db, err := bolt.Open(filepath.Join(dir, BoltFile), 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("unable to open %s - %v", filepath.Join(dir, BoltFile), err)
+	}
+
+	return &BoltStore{db: db}, nil
+}
+
+// BoltStore is an implementation of Store using an embedded Bolt database.
+type BoltStore struct {
+	db *bolt.DB
+
+	// EventRetention is how long events are kept in the history, 0 to keep
+	// them forever. Older events are removed when events are appended.
+	EventRetention time.Duration
+}
+
+var _ Store = (*BoltStore)(nil)
+
+// Initialize creates the top level buckets.
+func (s *BoltStore) Initialize() error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{snapshotsBucket, eventsBucket, eventIDsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// LoadSnapshot returns the snapshot of the watch watchID.
+func (s *BoltStore) LoadSnapshot(ctx context.Context, watchID string) (*Snapshot, error) {
+	snapshot := &Snapshot{WatchID: watchID, Objects: make(map[string]string), ETags: make(map[string]string)}
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(snapshotsBucket).Bucket([]byte(watchID))
+		if b == nil {
+			return ErrNotFound
+		}
+		snapshot.Initial = b.Get(initialKey) != nil
+
+		err := b.Bucket(objectsBucket).ForEach(func(k, v []byte) error {
+			snapshot.Objects[string(k)] = string(v)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		// Databases of older versions have no etags
+		if etags := b.Bucket(etagsBucket); etags != nil {
+			err := etags.ForEach(func(k, v []byte) error {
+				snapshot.ETags[string(k)] = string(v)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		return b.Bucket(outboxBucket).ForEach(func(k, v []byte) error {
+			var e OutboxEntry
+			if err := json.Unmarshal(v, &e); err != nil {
+				return fmt.Errorf("invalid outbox entry of %s - %v", watchID, err)
+			}
+			snapshot.Outbox = append(snapshot.Outbox, e)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return snapshot, nil
+}
+
+// SaveSnapshot replaces the bucket of the watch s.WatchID in a single
+// transaction, so the objects and the outbox are always committed together.
+func (s *BoltStore) SaveSnapshot(ctx context.Context, snapshot *Snapshot) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		snapshots := tx.Bucket(snapshotsBucket)
+		id := []byte(snapshot.WatchID)
+		if snapshots.Bucket(id) != nil {
+			if err := snapshots.DeleteBucket(id); err != nil {
+				return err
+			}
+		}
+
+		b, err := snapshots.CreateBucket(id)
+		if err != nil {
+			return err
+		}
+		objects, err := b.CreateBucket(objectsBucket)
+		if err != nil {
+			return err
+		}
+		etags, err := b.CreateBucket(etagsBucket)
+		if err != nil {
+			return err
+		}
+		outbox, err := b.CreateBucket(outboxBucket)
+		if err != nil {
+			return err
+		}
+		if snapshot.Initial {
+			if err := b.Put(initialKey, []byte{1}); err != nil {
+				return err
+			}
+		}
+
+		for name, md5 := range snapshot.Objects {
+			if err := objects.Put([]byte(name), []byte(md5)); err != nil {
+				return err
+			}
+		}
+		for name, etag := range snapshot.ETags {
+			if err := etags.Put([]byte(name), []byte(etag)); err != nil {
+				return err
+			}
+		}
+		for i, e := range snapshot.Outbox {
+			v, err := json.Marshal(e)
+			if err != nil {
+				return err
+			}
+			if err := outbox.Put(uint64Key(uint64(i)), v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteSnapshot removes the bucket of the watch watchID.
+func (s *BoltStore) DeleteSnapshot(ctx context.Context, watchID string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		err := tx.Bucket(snapshotsBucket).DeleteBucket([]byte(watchID))
+		if err == bolt.ErrBucketNotFound {
+			return nil
+		}
+		return err
+	})
+}
+
+// AppendEvents adds events to the history in a single transaction. Events
+// that are already stored are skipped, and events older than EventRetention
+// are removed.
+func (s *BoltStore) AppendEvents(ctx context.Context, events []Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if s.EventRetention > 0 {
+			if err := expireEvents(tx, time.Now().Add(-s.EventRetention)); err != nil {
+				return err
+			}
+		}
+
+		b := tx.Bucket(eventsBucket)
+		ids := tx.Bucket(eventIDsBucket)
+		for _, e := range events {
+			id := []byte(e.WatchID + "\x00" + e.DeliveryID)
+			if ids.Get(id) != nil {
+				continue
+			}
+
+			seq, err := b.NextSequence()
+			if err != nil {
+				return err
+			}
+			key := eventKey(e.Time, seq)
+			v, err := json.Marshal(e)
+			if err != nil {
+				return err
+			}
+			if err := b.Put(key, v); err != nil {
+				return err
+			}
+			if err := ids.Put(id, key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// expireEvents removes the events that happened before t, with their IDs.
+func expireEvents(tx *bolt.Tx, t time.Time) error {
+	b := tx.Bucket(eventsBucket)
+	ids := tx.Bucket(eventIDsBucket)
+	before := eventKey(t, 0)
+
+	c := b.Cursor()
+	for k, v := c.First(); k != nil && bytes.Compare(k, before) < 0; k, v = c.First() {
+		var e Event
+		if err := json.Unmarshal(v, &e); err != nil {
+			return fmt.Errorf("invalid event %x - %v", k, err)
+		}
+		if err := ids.Delete([]byte(e.WatchID + "\x00" + e.DeliveryID)); err != nil {
+			return err
+		}
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// QueryEvents returns the events of the history that match q, oldest first.
+func (s *BoltStore) QueryEvents(ctx context.Context, q EventQuery) ([]Event, error) {
+	events := []Event{}
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(eventsBucket).Cursor()
+
+		var k, v []byte
+		if q.Since.IsZero() {
+			k, v = c.First()
+		} else {
+			k, v = c.Seek(eventKey(q.Since.Add(time.Nanosecond), 0))
+		}
+		for ; k != nil; k, v = c.Next() {
+			var e Event
+			if err := json.Unmarshal(v, &e); err != nil {
+				return fmt.Errorf("invalid event %x - %v", k, err)
+			}
+			if !q.match(e) {
+				continue
+			}
+
+			events = append(events, e)
+			if q.Limit > 0 && len(events) == q.Limit {
+				return nil
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// match returns true if e is selected by q, except for Since.
+func (q EventQuery) match(e Event) bool {
+	return (q.WatchID == "" || e.WatchID == q.WatchID) &&
+		(q.Namespace == "" || e.Namespace == q.Namespace) &&
+		(q.Bucket == "" || e.Bucket == q.Bucket) &&
+		strings.HasPrefix(e.ObjectName, q.Prefix)
+}
+
+// eventKey orders events by time, and by the order they were appended for
+// the same time.
+func eventKey(t time.Time, seq uint64) []byte {
+	return append(uint64Key(uint64(t.UnixNano())), uint64Key(seq)...)
+}
+
+func uint64Key(i uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, i)
+	return b
+}
+
+// Healthy returns nil if the database is open.
+func (s *BoltStore) Healthy() error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		return nil
+	})
+}
+
+// Close closes the database.
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
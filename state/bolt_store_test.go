@@ -0,0 +1,117 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2017 Oracle and/or its affiliates.  All rights reserved.
+// This program is free software: you can modify it and/or redistribute it
+// under the terms of:
+//
+// (i)  the Universal Permissive License v 1.0 or at your option, any
+//      later version (http://oss.oracle.com/licenses/upl); and/or
+//
+// (ii) the Apache License v 2.0. (http://www.apache.org/licenses/LICENSE-2.0)
+//-----------------------------------------------------------------------------
+
+package state
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBoltStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bolt-store-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dir = filepath.Join(dir, "data")
+
+	store, err := NewBoltStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, store)
+
+	saved := &Snapshot{
+		WatchID: "watch",
+		Objects: map[string]string{"a": "md5"},
+		Outbox:  []OutboxEntry{{Sink: "stdout", Event: Event{DeliveryID: "1"}}, {Sink: "stdout", Event: Event{DeliveryID: "2"}}},
+	}
+	if err := store.SaveSnapshot(context.Background(), saved); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Healthy(); err == nil {
+		t.Error("Expected a closed store not to be healthy")
+	}
+
+	// Everything is kept when the store is opened again
+	store, err = NewBoltStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if err := store.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := store.LoadSnapshot(context.Background(), "watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Objects["a"] != "md5" || len(s.Outbox) != 2 || s.Outbox[0].Event.DeliveryID != "1" || s.Outbox[1].Event.DeliveryID != "2" {
+		t.Errorf("Unexpected snapshot %+v", s)
+	}
+	events, err := store.QueryEvents(context.Background(), EventQuery{WatchID: "watch"})
+	if err != nil || len(events) != 2 {
+		t.Errorf("Expected 2 events, got %v %v", events, err)
+	}
+}
+
+func TestBoltStoreEventRetention(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bolt-store-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := NewBoltStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if err := store.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	store.EventRetention = time.Hour
+	ctx := context.Background()
+
+	old := Event{WatchID: "watch", DeliveryID: "1", Time: time.Now().Add(-2 * time.Hour)}
+	if err := store.AppendEvents(ctx, []Event{old}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AppendEvents(ctx, []Event{{WatchID: "watch", DeliveryID: "2", Time: time.Now()}}); err != nil {
+		t.Fatal(err)
+	}
+	events, err := store.QueryEvents(ctx, EventQuery{})
+	if err != nil || len(events) != 1 || events[0].DeliveryID != "2" {
+		t.Fatalf("Expected the old event to be removed, got %v %v", events, err)
+	}
+
+	// The ID of a removed event is removed with it
+	old.Time = time.Now()
+	if err := store.AppendEvents(ctx, []Event{old}); err != nil {
+		t.Fatal(err)
+	}
+	events, err = store.QueryEvents(ctx, EventQuery{})
+	if err != nil || len(events) != 2 {
+		t.Errorf("Expected 2 events, got %v %v", events, err)
+	}
+}
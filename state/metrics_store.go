@@ -28,7 +28,7 @@ var _ Store = (*MetricsStore)(nil)
 
 // Initialize calls Initialize on the wrapped store.
 func (s *MetricsStore) Initialize() error {
-	s.observer.Preload(s, "Initialize")
+	s.observer.Preload(s, "Initialize", "LoadSnapshot", "SaveSnapshot", "DeleteSnapshot", "AppendEvents", "QueryEvents")
 	return s.store.Initialize()
 }
 
@@ -41,3 +41,43 @@ func (s *MetricsStore) Healthy() error {
 func (s *MetricsStore) Close() error {
 	return s.store.Close()
 }
+
+// LoadSnapshot calls LoadSnapshot on the wrapped store.
+func (s *MetricsStore) LoadSnapshot(ctx context.Context, watchID string) (*Snapshot, error) {
+	done := s.observer.Observe("LoadSnapshot")
+	result, err := s.store.LoadSnapshot(ctx, watchID)
+	done(err)
+	return result, err
+}
+
+// SaveSnapshot calls SaveSnapshot on the wrapped store.
+func (s *MetricsStore) SaveSnapshot(ctx context.Context, snapshot *Snapshot) error {
+	done := s.observer.Observe("SaveSnapshot")
+	err := s.store.SaveSnapshot(ctx, snapshot)
+	done(err)
+	return err
+}
+
+// DeleteSnapshot calls DeleteSnapshot on the wrapped store.
+func (s *MetricsStore) DeleteSnapshot(ctx context.Context, watchID string) error {
+	done := s.observer.Observe("DeleteSnapshot")
+	err := s.store.DeleteSnapshot(ctx, watchID)
+	done(err)
+	return err
+}
+
+// AppendEvents calls AppendEvents on the wrapped store.
+func (s *MetricsStore) AppendEvents(ctx context.Context, events []Event) error {
+	done := s.observer.Observe("AppendEvents")
+	err := s.store.AppendEvents(ctx, events)
+	done(err)
+	return err
+}
+
+// QueryEvents calls QueryEvents on the wrapped store.
+func (s *MetricsStore) QueryEvents(ctx context.Context, q EventQuery) ([]Event, error) {
+	done := s.observer.Observe("QueryEvents")
+	result, err := s.store.QueryEvents(ctx, q)
+	done(err)
+	return result, err
+}
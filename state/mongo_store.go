@@ -12,7 +12,29 @@
 package state
 
 import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+
 	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// The collections of the MongoStore.
+const (
+	snapshotsCollection      = "snapshots"
+	snapshotChunksCollection = "snapshot_chunks"
+	eventsCollection         = "events"
+)
+
+// Snapshots are split into chunks to stay below the maximum document size.
+// Object names are at most 1024 bytes, so a chunk of objects is at most about
+// 10MB.
+const (
+	objectsPerChunk = 10000
+	outboxPerChunk  = 2000
 )
 
 // NewMongoStore creates a new MongoStore. Use an empty string for databaseName
@@ -28,11 +50,296 @@ func NewMongoStore(session *mgo.Session, databaseName string) (*MongoStore, erro
 type MongoStore struct {
 	session *mgo.Session
 	db      string
+
+	// EventRetention is how long events are kept in the history, 0 to keep
+	// them forever. Older events are removed by a TTL index, which is created
+	// or changed by Initialize.
+	EventRetention time.Duration
 }
 
 var _ Store = (*MongoStore)(nil)
 
-// TODO: Add methods here
+// snapshotDoc is the head of a snapshot. A snapshot is saved as a new
+// generation of chunks, which replaces the old one when the head is updated
+// to point to it.
+type snapshotDoc struct {
+	WatchID    string        `bson:"_id"`
+	Generation bson.ObjectId `bson:"generation"`
+	Chunks     int           `bson:"chunks"`
+	Initial    bool          `bson:"initial,omitempty"`
+	Updated    time.Time     `bson:"updated"`
+}
+
+// chunkDoc is a part of the objects or the outbox of a snapshot. Objects are
+// stored as a list, as object names may contain dots which keys cannot.
+type chunkDoc struct {
+	WatchID    string        `bson:"watchId"`
+	Generation bson.ObjectId `bson:"generation"`
+	N          int           `bson:"n"`
+	Objects    []objectDoc   `bson:"objects,omitempty"`
+	Outbox     []outboxDoc   `bson:"outbox,omitempty"`
+}
+
+type objectDoc struct {
+	Name string `bson:"name"`
+	MD5  string `bson:"md5"`
+	ETag string `bson:"etag,omitempty"`
+}
+
+type outboxDoc struct {
+	Sink  string   `bson:"sink"`
+	Event eventDoc `bson:"event"`
+}
+
+type eventDoc struct {
+	ID            bson.ObjectId `bson:"_id,omitempty"`
+	WatchID       string        `bson:"watchId"`
+	DeliveryID    string        `bson:"deliveryId"`
+	Time          time.Time     `bson:"time"`
+	Namespace     string        `bson:"namespace"`
+	Bucket        string        `bson:"bucket"`
+	ObjectName    string        `bson:"objectName"`
+	ContentHash   string        `bson:"contentHash"`
+	Type          string        `bson:"type"`
+	Size          int64         `bson:"size,omitempty"`
+	ETag          string        `bson:"etag,omitempty"`
+	TimeCreated   time.Time     `bson:"timeCreated,omitempty"`
+	StorageTier   string        `bson:"storageTier,omitempty"`
+	ArchivalState string        `bson:"archivalState,omitempty"`
+}
+
+func newEventDoc(e Event) eventDoc {
+	return eventDoc{
+		WatchID:       e.WatchID,
+		DeliveryID:    e.DeliveryID,
+		Time:          e.Time,
+		Namespace:     e.Namespace,
+		Bucket:        e.Bucket,
+		ObjectName:    e.ObjectName,
+		ContentHash:   e.ContentHash,
+		Type:          e.Type,
+		Size:          e.Size,
+		ETag:          e.ETag,
+		TimeCreated:   e.TimeCreated,
+		StorageTier:   e.StorageTier,
+		ArchivalState: e.ArchivalState,
+	}
+}
+
+func (d eventDoc) event() Event {
+	return Event{
+		WatchID:       d.WatchID,
+		DeliveryID:    d.DeliveryID,
+		Time:          d.Time,
+		Namespace:     d.Namespace,
+		Bucket:        d.Bucket,
+		ObjectName:    d.ObjectName,
+		ContentHash:   d.ContentHash,
+		Type:          d.Type,
+		Size:          d.Size,
+		ETag:          d.ETag,
+		TimeCreated:   d.TimeCreated,
+		StorageTier:   d.StorageTier,
+		ArchivalState: d.ArchivalState,
+	}
+}
+
+// LoadSnapshot returns the snapshot of the watch watchID.
+func (s *MongoStore) LoadSnapshot(ctx context.Context, watchID string) (*Snapshot, error) {
+	sess := s.session.Clone()
+	defer sess.Close()
+
+	var head snapshotDoc
+	err := s.C(sess, snapshotsCollection).FindId(watchID).One(&head)
+	if err == mgo.ErrNotFound {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	snapshot := &Snapshot{WatchID: watchID, Objects: make(map[string]string), ETags: make(map[string]string), Initial: head.Initial}
+	query := bson.M{"watchId": watchID, "generation": head.Generation}
+	iter := s.C(sess, snapshotChunksCollection).Find(query).Sort("n").Iter()
+
+	chunks := 0
+	var chunk chunkDoc
+	for iter.Next(&chunk) {
+		if chunk.N != chunks {
+			break
+		}
+		chunks++
+		for _, o := range chunk.Objects {
+			snapshot.Objects[o.Name] = o.MD5
+			if o.ETag != "" {
+				snapshot.ETags[o.Name] = o.ETag
+			}
+		}
+		for _, o := range chunk.Outbox {
+			snapshot.Outbox = append(snapshot.Outbox, OutboxEntry{Sink: o.Sink, Event: o.Event.event()})
+		}
+		chunk = chunkDoc{}
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	if chunks != head.Chunks {
+		return nil, fmt.Errorf("snapshot of %s is incomplete, found %d of %d chunks", watchID, chunks, head.Chunks)
+	}
+
+	return snapshot, nil
+}
+
+// SaveSnapshot writes the chunks of snapshot as a new generation, then
+// points the head to it and removes the old generations.
+func (s *MongoStore) SaveSnapshot(ctx context.Context, snapshot *Snapshot) error {
+	sess := s.session.Clone()
+	defer sess.Close()
+
+	generation := bson.NewObjectId()
+	chunks := snapshotChunks(snapshot)
+	for i := range chunks {
+		chunks[i].WatchID = snapshot.WatchID
+		chunks[i].Generation = generation
+		chunks[i].N = i
+		if err := s.C(sess, snapshotChunksCollection).Insert(&chunks[i]); err != nil {
+			return err
+		}
+	}
+
+	head := snapshotDoc{
+		WatchID:    snapshot.WatchID,
+		Generation: generation,
+		Chunks:     len(chunks),
+		Initial:    snapshot.Initial,
+		Updated:    time.Now(),
+	}
+	if _, err := s.C(sess, snapshotsCollection).UpsertId(snapshot.WatchID, &head); err != nil {
+		return err
+	}
+
+	// Left over generations are removed on the next save
+	_, err := s.C(sess, snapshotChunksCollection).RemoveAll(bson.M{
+		"watchId":    snapshot.WatchID,
+		"generation": bson.M{"$ne": generation},
+	})
+	return err
+}
+
+// snapshotChunks splits the objects and the outbox of s into chunks. The
+// objects are sorted by name, so the same objects give the same chunks.
+func snapshotChunks(s *Snapshot) []chunkDoc {
+	names := make([]string, 0, len(s.Objects))
+	for name := range s.Objects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var chunks []chunkDoc
+	for start := 0; start < len(names); start += objectsPerChunk {
+		end := start + objectsPerChunk
+		if end > len(names) {
+			end = len(names)
+		}
+		objects := make([]objectDoc, 0, end-start)
+		for _, name := range names[start:end] {
+			objects = append(objects, objectDoc{Name: name, MD5: s.Objects[name], ETag: s.ETags[name]})
+		}
+		chunks = append(chunks, chunkDoc{Objects: objects})
+	}
+
+	for start := 0; start < len(s.Outbox); start += outboxPerChunk {
+		end := start + outboxPerChunk
+		if end > len(s.Outbox) {
+			end = len(s.Outbox)
+		}
+		outbox := make([]outboxDoc, 0, end-start)
+		for _, e := range s.Outbox[start:end] {
+			outbox = append(outbox, outboxDoc{Sink: e.Sink, Event: newEventDoc(e.Event)})
+		}
+		chunks = append(chunks, chunkDoc{Outbox: outbox})
+	}
+
+	return chunks
+}
+
+// DeleteSnapshot removes the head and every chunk of the snapshot of the
+// watch watchID.
+func (s *MongoStore) DeleteSnapshot(ctx context.Context, watchID string) error {
+	sess := s.session.Clone()
+	defer sess.Close()
+
+	err := s.C(sess, snapshotsCollection).RemoveId(watchID)
+	if err != nil && err != mgo.ErrNotFound {
+		return err
+	}
+
+	_, err = s.C(sess, snapshotChunksCollection).RemoveAll(bson.M{"watchId": watchID})
+	return err
+}
+
+// AppendEvents inserts events into the history. Events that are already
+// stored are skipped.
+func (s *MongoStore) AppendEvents(ctx context.Context, events []Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	sess := s.session.Clone()
+	defer sess.Close()
+
+	bulk := s.C(sess, eventsCollection).Bulk()
+	bulk.Unordered()
+	for _, e := range events {
+		doc := newEventDoc(e)
+		doc.ID = bson.NewObjectId()
+		bulk.Insert(&doc)
+	}
+
+	_, err := bulk.Run()
+	if err != nil && !mgo.IsDup(err) {
+		return err
+	}
+	return nil
+}
+
+// QueryEvents returns the events of the history that match q, oldest first.
+func (s *MongoStore) QueryEvents(ctx context.Context, q EventQuery) ([]Event, error) {
+	sess := s.session.Clone()
+	defer sess.Close()
+
+	query := bson.M{}
+	if q.WatchID != "" {
+		query["watchId"] = q.WatchID
+	}
+	if q.Namespace != "" {
+		query["namespace"] = q.Namespace
+	}
+	if q.Bucket != "" {
+		query["bucket"] = q.Bucket
+	}
+	if q.Prefix != "" {
+		query["objectName"] = bson.RegEx{Pattern: "^" + regexp.QuoteMeta(q.Prefix)}
+	}
+	if !q.Since.IsZero() {
+		query["time"] = bson.M{"$gt": q.Since}
+	}
+
+	find := s.C(sess, eventsCollection).Find(query).Sort("time", "_id")
+	if q.Limit > 0 {
+		find = find.Limit(q.Limit)
+	}
+
+	var docs []eventDoc
+	if err := find.All(&docs); err != nil {
+		return nil, err
+	}
+
+	events := make([]Event, 0, len(docs))
+	for _, d := range docs {
+		events = append(events, d.event())
+	}
+	return events, nil
+}
 
 // C get a Collection from sess by using the database defined on the store.
 func (s *MongoStore) C(sess *mgo.Session, collectionName string) *mgo.Collection {
@@ -42,9 +349,65 @@ func (s *MongoStore) C(sess *mgo.Session, collectionName string) *mgo.Collection
 // Initialize will be called once during startup and should ensure any required
 // indexes are created.
 func (s *MongoStore) Initialize() error {
+	sess := s.session.Clone()
+	defer sess.Close()
+
+	indexes := map[string][]mgo.Index{
+		snapshotChunksCollection: {
+			{Key: []string{"watchId", "generation", "n"}, Unique: true},
+		},
+		eventsCollection: {
+			{Key: []string{"watchId", "deliveryId"}, Unique: true},
+			{Key: []string{"watchId", "time"}},
+			{Key: []string{"namespace", "bucket", "time"}},
+		},
+	}
+	for collection, indexes := range indexes {
+		for _, index := range indexes {
+			if err := s.C(sess, collection).EnsureIndex(index); err != nil {
+				return fmt.Errorf("unable to create index %v on %s - %v", index.Key, collection, err)
+			}
+		}
+	}
+
+	if err := s.ensureEventRetention(sess); err != nil {
+		return fmt.Errorf("unable to set the retention of %s - %v", eventsCollection, err)
+	}
+
 	return nil
 }
 
+// Error codes of mongo for indexes.
+const (
+	mongoIndexNotFound        = 27
+	mongoIndexOptionsConflict = 85
+)
+
+// ensureEventRetention creates the TTL index on the time of events, changes
+// its expiry if EventRetention changed, or drops it if EventRetention is 0.
+func (s *MongoStore) ensureEventRetention(sess *mgo.Session) error {
+	events := s.C(sess, eventsCollection)
+	if s.EventRetention <= 0 {
+		err := events.DropIndex("time")
+		if qerr, ok := err.(*mgo.QueryError); ok && qerr.Code == mongoIndexNotFound {
+			return nil
+		}
+		return err
+	}
+
+	err := events.EnsureIndex(mgo.Index{Key: []string{"time"}, ExpireAfter: s.EventRetention})
+	if qerr, ok := err.(*mgo.QueryError); ok && qerr.Code == mongoIndexOptionsConflict {
+		return events.Database.Run(bson.D{
+			{Name: "collMod", Value: eventsCollection},
+			{Name: "index", Value: bson.M{
+				"keyPattern":         bson.M{"time": 1},
+				"expireAfterSeconds": int(s.EventRetention / time.Second),
+			}},
+		}, nil)
+	}
+	return err
+}
+
 // Healthy return nil if nothing is wrong. If it is unable to Ping Mongo it
 // will try to refresh the session and will return the err.
 func (s *MongoStore) Healthy() error {
@@ -0,0 +1,87 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2017 Oracle and/or its affiliates.  All rights reserved.
+// This program is free software: you can modify it and/or redistribute it
+// under the terms of:
+//
+// (i)  the Universal Permissive License v 1.0 or at your option, any
+//      later version (http://oss.oracle.com/licenses/upl); and/or
+//
+// (ii) the Apache License v 2.0. (http://www.apache.org/licenses/LICENSE-2.0)
+//-----------------------------------------------------------------------------
+
+package state
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestSnapshotChunks(t *testing.T) {
+	s := &Snapshot{WatchID: "watch", Objects: make(map[string]string)}
+	for i := 0; i < objectsPerChunk+1; i++ {
+		s.Objects[fmt.Sprintf("object-%06d", i)] = "md5"
+	}
+	for i := 0; i < outboxPerChunk*2; i++ {
+		s.Outbox = append(s.Outbox, OutboxEntry{Sink: "stdout", Event: Event{DeliveryID: fmt.Sprint(i)}})
+	}
+
+	chunks := snapshotChunks(s)
+	if len(chunks) != 4 {
+		t.Fatalf("Expected 4 chunks, got %d", len(chunks))
+	}
+	if len(chunks[0].Objects) != objectsPerChunk || len(chunks[1].Objects) != 1 {
+		t.Errorf("Unexpected object chunks %d and %d", len(chunks[0].Objects), len(chunks[1].Objects))
+	}
+	if chunks[0].Objects[0].Name != "object-000000" || chunks[1].Objects[0].Name != fmt.Sprintf("object-%06d", objectsPerChunk) {
+		t.Error("Expected objects to be chunked in order")
+	}
+	if len(chunks[2].Outbox) != outboxPerChunk || chunks[3].Outbox[outboxPerChunk-1].Event.DeliveryID != fmt.Sprint(outboxPerChunk*2-1) {
+		t.Error("Expected the outbox to be chunked in order")
+	}
+
+	if chunks := snapshotChunks(&Snapshot{WatchID: "watch"}); len(chunks) != 0 {
+		t.Errorf("Expected no chunks for an empty snapshot, got %d", len(chunks))
+	}
+}
+
+// TestMongoStore runs against the database of MONGODB_TEST_URI, which is
+// dropped afterwards.
+func TestMongoStore(t *testing.T) {
+	uri := os.Getenv("MONGODB_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGODB_TEST_URI is not set")
+	}
+
+	session, err := mgo.Dial(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := "watcher_test_" + bson.NewObjectId().Hex()
+	defer session.DB(db).DropDatabase()
+
+	store, err := NewMongoStore(session.Clone(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if err := store.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, store)
+
+	// The chunks of the old generations are removed when a snapshot is saved
+	if err := store.SaveSnapshot(context.Background(), &Snapshot{WatchID: "watch", Objects: map[string]string{"a": "md5"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveSnapshot(context.Background(), &Snapshot{WatchID: "watch", Objects: map[string]string{"b": "md5"}}); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := store.C(session, snapshotChunksCollection).Find(bson.M{"watchId": "watch"}).Count(); n != 1 {
+		t.Errorf("Expected 1 chunk, got %d", n)
+	}
+}
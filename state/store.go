@@ -12,14 +12,92 @@
 package state
 
 import (
+	"context"
+	"errors"
 	"io"
+	"time"
 
 	"github.com/wercker/pkg/health"
 )
 
+// ErrNotFound is returned when a requested item does not exist.
+var ErrNotFound = errors.New("not found")
+
 // Store provides access to data that is required for oci-objectstore-watcher.
 type Store interface {
 	Initialize() error
 	io.Closer
 	health.Probe
+
+	// LoadSnapshot returns the snapshot of the watch watchID, or ErrNotFound
+	// if it was never saved.
+	LoadSnapshot(ctx context.Context, watchID string) (*Snapshot, error)
+
+	// SaveSnapshot replaces the snapshot of the watch s.WatchID. Readers see
+	// either the old or the new snapshot, never a mix of both.
+	SaveSnapshot(ctx context.Context, s *Snapshot) error
+
+	// DeleteSnapshot removes the snapshot of the watch watchID. Deleting a
+	// snapshot that does not exist is not an error.
+	DeleteSnapshot(ctx context.Context, watchID string) error
+
+	// AppendEvents adds events to the change history. Appending an event
+	// with the watch and delivery ID of a stored event is a no-op.
+	AppendEvents(ctx context.Context, events []Event) error
+
+	// QueryEvents returns the events that match q, oldest first.
+	QueryEvents(ctx context.Context, q EventQuery) ([]Event, error)
+}
+
+// Snapshot is the state of a watch: the objects that were last seen in its
+// bucket, by name with their MD5 and ETag, and the changes that were not
+// delivered yet. ETags only has the objects the store returned an ETag for.
+// Initial is set while the bucket was not listed yet.
+type Snapshot struct {
+	WatchID string
+	Objects map[string]string
+	ETags   map[string]string
+	Initial bool
+	Outbox  []OutboxEntry
+}
+
+// OutboxEntry is a change waiting to be delivered to a sink.
+type OutboxEntry struct {
+	Sink  string
+	Event Event
+}
+
+// Event is a change that was detected in a bucket. The metadata of the
+// object is empty for deletes and if the store does not return it.
+type Event struct {
+	WatchID       string
+	DeliveryID    string
+	Time          time.Time
+	Namespace     string
+	Bucket        string
+	ObjectName    string
+	ContentHash   string
+	Type          string
+	Size          int64
+	ETag          string
+	TimeCreated   time.Time
+	StorageTier   string
+	ArchivalState string
+}
+
+// EventQuery selects events from the change history. Empty fields match
+// every event.
+type EventQuery struct {
+	WatchID   string
+	Namespace string
+	Bucket    string
+
+	// Prefix selects the events of objects whose name starts with it.
+	Prefix string
+
+	// Since selects the events that happened after it.
+	Since time.Time
+
+	// Limit is the maximum number of events returned, 0 for no limit.
+	Limit int
 }
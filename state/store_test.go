@@ -0,0 +1,107 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2017 Oracle and/or its affiliates.  All rights reserved.
+// This program is free software: you can modify it and/or redistribute it
+// under the terms of:
+//
+// (i)  the Universal Permissive License v 1.0 or at your option, any
+//      later version (http://oss.oracle.com/licenses/upl); and/or
+//
+// (ii) the Apache License v 2.0. (http://www.apache.org/licenses/LICENSE-2.0)
+//-----------------------------------------------------------------------------
+
+package state
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// sameEvents compares events with Time.Equal, as times are read back in the
+// local time zone.
+func sameEvents(a, b []Event) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		x, y := a[i], b[i]
+		if !x.Time.Equal(y.Time) || !x.TimeCreated.Equal(y.TimeCreated) {
+			return false
+		}
+		x.Time, y.Time = time.Time{}, time.Time{}
+		x.TimeCreated, y.TimeCreated = time.Time{}, time.Time{}
+		if x != y {
+			return false
+		}
+	}
+	return true
+}
+
+// testStore tests the snapshots and the history of an empty store.
+func testStore(t *testing.T, store Store) {
+	ctx := context.Background()
+
+	if _, err := store.LoadSnapshot(ctx, "watch"); err != ErrNotFound {
+		t.Fatalf("Expected ErrNotFound, got %v", err)
+	}
+
+	now := time.Now().Truncate(time.Millisecond)
+	e := Event{WatchID: "watch", DeliveryID: "1", Time: now, Namespace: "ns", Bucket: "bucket", ObjectName: "a.txt", ContentHash: "md5", Type: "NEW",
+		Size: 42, ETag: "etag", TimeCreated: now.Add(-time.Hour), StorageTier: "Standard"}
+	saved := &Snapshot{
+		WatchID: "watch",
+		Objects: map[string]string{"a.txt": "md5", "b": "md5"},
+		ETags:   map[string]string{"a.txt": "etag"},
+		Outbox:  []OutboxEntry{{Sink: "stdout", Event: e}},
+	}
+	for i := 0; i < 2; i++ {
+		if err := store.SaveSnapshot(ctx, saved); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s, err := store.LoadSnapshot(ctx, "watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Objects) != 2 || s.Objects["a.txt"] != "md5" || len(s.ETags) != 1 || s.ETags["a.txt"] != "etag" || len(s.Outbox) != 1 || !sameEvents([]Event{s.Outbox[0].Event}, []Event{e}) {
+		t.Errorf("Unexpected snapshot %+v", s)
+	}
+
+	if err := store.DeleteSnapshot(ctx, "watch"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.LoadSnapshot(ctx, "watch"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound after delete, got %v", err)
+	}
+
+	f := e
+	f.DeliveryID, f.ObjectName, f.Time = "2", "b", now.Add(time.Second)
+	if err := store.AppendEvents(ctx, []Event{e, f}); err != nil {
+		t.Fatal(err)
+	}
+	// Appending the same events again is a no-op
+	if err := store.AppendEvents(ctx, []Event{e}); err != nil {
+		t.Fatal(err)
+	}
+
+	queries := map[string]struct {
+		query    EventQuery
+		expected []Event
+	}{
+		"all":    {EventQuery{}, []Event{e, f}},
+		"watch":  {EventQuery{WatchID: "other"}, nil},
+		"bucket": {EventQuery{Namespace: "ns", Bucket: "bucket"}, []Event{e, f}},
+		"prefix": {EventQuery{Prefix: "a."}, []Event{e}},
+		"since":  {EventQuery{Since: now}, []Event{f}},
+		"limit":  {EventQuery{Limit: 1}, []Event{e}},
+	}
+	for name, q := range queries {
+		events, err := store.QueryEvents(ctx, q.query)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !sameEvents(events, q.expected) {
+			t.Errorf("%s: expected %v, got %v", name, q.expected, events)
+		}
+	}
+}
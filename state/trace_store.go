@@ -61,3 +61,43 @@ func (s *TraceStore) Healthy() error {
 func (s *TraceStore) Close() error {
 	return s.store.Close()
 }
+
+// LoadSnapshot calls LoadSnapshot on the wrapped store.
+func (s *TraceStore) LoadSnapshot(ctx context.Context, watchID string) (*Snapshot, error) {
+	ctx, span := s.trace(ctx, "LoadSnapshot")
+	defer span.Finish()
+
+	return s.store.LoadSnapshot(ctx, watchID)
+}
+
+// SaveSnapshot calls SaveSnapshot on the wrapped store.
+func (s *TraceStore) SaveSnapshot(ctx context.Context, snapshot *Snapshot) error {
+	ctx, span := s.trace(ctx, "SaveSnapshot")
+	defer span.Finish()
+
+	return s.store.SaveSnapshot(ctx, snapshot)
+}
+
+// DeleteSnapshot calls DeleteSnapshot on the wrapped store.
+func (s *TraceStore) DeleteSnapshot(ctx context.Context, watchID string) error {
+	ctx, span := s.trace(ctx, "DeleteSnapshot")
+	defer span.Finish()
+
+	return s.store.DeleteSnapshot(ctx, watchID)
+}
+
+// AppendEvents calls AppendEvents on the wrapped store.
+func (s *TraceStore) AppendEvents(ctx context.Context, events []Event) error {
+	ctx, span := s.trace(ctx, "AppendEvents")
+	defer span.Finish()
+
+	return s.store.AppendEvents(ctx, events)
+}
+
+// QueryEvents calls QueryEvents on the wrapped store.
+func (s *TraceStore) QueryEvents(ctx context.Context, q EventQuery) ([]Event, error) {
+	ctx, span := s.trace(ctx, "QueryEvents")
+	defer span.Finish()
+
+	return s.store.QueryEvents(ctx, q)
+}
@@ -0,0 +1,238 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2017 Oracle and/or its affiliates.  All rights reserved.
+// This program is free software: you can modify it and/or redistribute it
+// under the terms of:
+//
+// (i)  the Universal Permissive License v 1.0 or at your option, any
+//      later version (http://oss.oracle.com/licenses/upl); and/or
+//
+// (ii) the Apache License v 2.0. (http://www.apache.org/licenses/LICENSE-2.0)
+//-----------------------------------------------------------------------------
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"github.com/wercker/pkg/log"
+	"golang.org/x/net/context"
+	"golang.org/x/net/websocket"
+	"google.golang.org/grpc/status"
+
+	"github.com/fnproject/oci-objectstore-watcher/ociobjectstorewatcherpb"
+)
+
+// The live change feeds of the gateway, next to the grpc-gateway routes.
+const (
+	eventStreamPath    = "/api/v3/oci-objectstore-watcher/events/stream"
+	eventWebSocketPath = "/api/v3/oci-objectstore-watcher/events/ws"
+)
+
+// keepAliveInterval is how often the feeds send a comment or a ping, so
+// proxies do not close idle connections.
+const keepAliveInterval = 15 * time.Second
+
+var eventMarshaler = &runtime.JSONPb{EmitDefaults: true}
+
+// streamRequest returns the filters of a feed request. Browsers send the
+// Last-Event-ID header when an EventSource reconnects, other clients can use
+// the lastEventId parameter.
+func streamRequest(r *http.Request) *ociobjectstorewatcherpb.StreamEventsRequest {
+	q := r.URL.Query()
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = q.Get("lastEventId")
+	}
+	return &ociobjectstorewatcherpb.StreamEventsRequest{
+		Namespace:   q.Get("namespace"),
+		Bucket:      q.Get("bucket"),
+		Prefix:      q.Get("prefix"),
+		LastEventId: lastEventID,
+	}
+}
+
+// relayEvents streams the events of req from client to send until ctx is
+// done or the stream fails. subscribed is called before the first event,
+// once the server has subscribed. Every keepAliveInterval, send is called
+// with nil to keep the connection alive.
+func relayEvents(ctx context.Context, client ociobjectstorewatcherpb.OciObjectstoreWatcherClient, req *ociobjectstorewatcherpb.StreamEventsRequest, subscribed func(), send func(*ociobjectstorewatcherpb.Event) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := client.StreamEvents(ctx, req)
+	if err != nil {
+		return err
+	}
+	// The server sends the headers once it is subscribed
+	if _, err := stream.Header(); err != nil {
+		return err
+	}
+	subscribed()
+
+	events := make(chan *ociobjectstorewatcherpb.Event)
+	errc := make(chan error, 1)
+	go func() {
+		for {
+			e, err := stream.Recv()
+			if err != nil {
+				errc <- err
+				return
+			}
+			select {
+			case events <- e:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(keepAliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case e := <-events:
+			if err := send(e); err != nil {
+				return err
+			}
+		case <-ticker.C:
+			if err := send(nil); err != nil {
+				return err
+			}
+		case err := <-errc:
+			return err
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// streamErrorMessage returns the message of a gRPC error.
+func streamErrorMessage(err error) string {
+	if s, ok := status.FromError(err); ok {
+		return s.Message()
+	}
+	return err.Error()
+}
+
+// eventStreamHandler serves the events as Server-Sent Events. The id of
+// every message is the id of its event, so an EventSource resumes where it
+// left off when it reconnects.
+func eventStreamHandler(client ociobjectstorewatcherpb.OciObjectstoreWatcherClient) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		f, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+			return
+		}
+
+		subscribed := false
+		err := relayEvents(r.Context(), client, streamRequest(r), func() {
+			subscribed = true
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("X-Accel-Buffering", "no")
+			w.WriteHeader(http.StatusOK)
+			f.Flush()
+		}, func(e *ociobjectstorewatcherpb.Event) error {
+			if e == nil {
+				fmt.Fprint(w, ": keep-alive\n\n")
+			} else {
+				b, err := eventMarshaler.Marshal(e)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(w, "id: %s\ndata: %s\n\n", e.Id, b)
+			}
+			f.Flush()
+			return nil
+		})
+		if err == nil || r.Context().Err() != nil {
+			return
+		}
+
+		log.WithError(err).Warn("Event stream failed")
+		if !subscribed {
+			http.Error(w, streamErrorMessage(err), http.StatusBadGateway)
+			return
+		}
+		// The EventSource reconnects after an error event and resumes
+		fmt.Fprintf(w, "event: error\ndata: %s\n\n", streamErrorMessage(err))
+		f.Flush()
+	})
+}
+
+// eventWebSocketHandler serves the events as JSON text messages over a
+// WebSocket. Messages from the client are ignored. Browsers may connect
+// from the host of the gateway and from the CORS origins.
+func eventWebSocketHandler(client ociobjectstorewatcherpb.OciObjectstoreWatcherClient, origins []string) http.Handler {
+	return websocket.Server{
+		Handshake: func(config *websocket.Config, r *http.Request) error {
+			return checkWebSocketOrigin(r, origins)
+		},
+		Handler: func(ws *websocket.Conn) {
+			defer ws.Close()
+			r := ws.Request()
+
+			// Reading is the only way to notice that the client is gone
+			ctx, cancel := context.WithCancel(r.Context())
+			defer cancel()
+			go func() {
+				defer cancel()
+				var message string
+				for websocket.Message.Receive(ws, &message) == nil {
+				}
+			}()
+
+			err := relayEvents(ctx, client, streamRequest(r), func() {}, func(e *ociobjectstorewatcherpb.Event) error {
+				if e == nil {
+					ws.PayloadType = websocket.PingFrame
+					_, err := ws.Write(nil)
+					ws.PayloadType = websocket.TextFrame
+					return err
+				}
+				b, err := eventMarshaler.Marshal(e)
+				if err != nil {
+					return err
+				}
+				return websocket.Message.Send(ws, string(b))
+			})
+			if err != nil && ctx.Err() == nil {
+				log.WithError(err).Warn("Event WebSocket failed")
+				b, _ := eventMarshaler.Marshal(map[string]string{"error": streamErrorMessage(err)})
+				websocket.Message.Send(ws, string(b))
+			}
+		},
+	}
+}
+
+// checkWebSocketOrigin rejects browsers on other sites, a page must not be
+// able to read the feed just because its visitor can reach the gateway.
+func checkWebSocketOrigin(r *http.Request, origins []string) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return fmt.Errorf("invalid origin %q", origin)
+	}
+	if u.Host == r.Host {
+		return nil
+	}
+	for _, allowed := range origins {
+		if allowed == "*" || allowed == origin {
+			return nil
+		}
+	}
+	return errors.New("origin " + origin + " is not allowed")
+}
@@ -0,0 +1,162 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2017 Oracle and/or its affiliates.  All rights reserved.
+// This program is free software: you can modify it and/or redistribute it
+// under the terms of:
+//
+// (i)  the Universal Permissive License v 1.0 or at your option, any
+//      later version (http://oss.oracle.com/licenses/upl); and/or
+//
+// (ii) the Apache License v 2.0. (http://www.apache.org/licenses/LICENSE-2.0)
+//-----------------------------------------------------------------------------
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// sseMessage is a message of an event stream.
+type sseMessage struct {
+	ID   string
+	Data struct {
+		ID         string `json:"id"`
+		Bucket     string `json:"bucket"`
+		ObjectName string `json:"objectName"`
+		Type       string `json:"type"`
+	}
+}
+
+// openEventStream connects to the event stream of the gateway. The messages
+// are sent on the returned channel until the response is closed.
+func openEventStream(t *testing.T, g *testGateway, lastEventID string) (*http.Response, <-chan sseMessage) {
+	req, err := http.NewRequest(http.MethodGet, g.URL+eventStreamPath+"?bucket=bucket", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Expected an event stream, got %d %v", res.StatusCode, res.Header)
+	}
+
+	messages := make(chan sseMessage, 16)
+	go func() {
+		defer close(messages)
+		r := bufio.NewReader(res.Body)
+		var m sseMessage
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimSuffix(line, "\n")
+			switch {
+			case line == "":
+				messages <- m
+				m = sseMessage{}
+			case strings.HasPrefix(line, "id: "):
+				m.ID = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "data: "):
+				json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &m.Data)
+			}
+		}
+	}()
+	return res, messages
+}
+
+func nextMessage(t *testing.T, messages <-chan sseMessage) sseMessage {
+	select {
+	case m, ok := <-messages:
+		if !ok {
+			t.Fatal("Event stream ended")
+		}
+		return m
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected an event")
+	}
+	return sseMessage{}
+}
+
+func TestEventStream(t *testing.T) {
+	g := newTestGateway(t)
+	defer g.close()
+
+	res, messages := openEventStream(t, g, "")
+	g.store.PutObject("ns", "bucket", "a", []byte("a"))
+	if status := g.call(t, http.MethodPost, watchesPath, map[string]interface{}{"bucket": "bucket", "webhookUrl": g.hook.URL}, nil); status != http.StatusOK {
+		t.Fatalf("Unable to create watch: %d", status)
+	}
+
+	a := nextMessage(t, messages)
+	if a.ID == "" || a.ID != a.Data.ID || a.Data.ObjectName != "a" || a.Data.Type != "NEW" {
+		t.Fatalf("Unexpected message %+v", a)
+	}
+	g.store.PutObject("ns", "bucket", "b", []byte("b"))
+	b := nextMessage(t, messages)
+	if b.Data.ObjectName != "b" {
+		t.Fatalf("Unexpected message %+v", b)
+	}
+	res.Body.Close()
+
+	// A client that reconnects gets the events it missed
+	res, messages = openEventStream(t, g, a.ID)
+	defer res.Body.Close()
+	if m := nextMessage(t, messages); m.ID != b.ID || m.Data.ObjectName != "b" {
+		t.Errorf("Expected b to be replayed, got %+v", m)
+	}
+}
+
+func TestEventWebSocket(t *testing.T) {
+	g := newTestGateway(t)
+	defer g.close()
+
+	wsURL := "ws" + strings.TrimPrefix(g.URL, "http") + eventWebSocketPath + "?bucket=bucket"
+	if _, err := websocket.Dial(wsURL, "", "http://elsewhere.com"); err == nil {
+		t.Error("Expected WebSockets from other origins to be rejected")
+	}
+
+	ws, err := websocket.Dial(wsURL, "", g.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	// The handshake completes before the gateway subscribes, so objects are
+	// added until one is seen
+	if status := g.call(t, http.MethodPost, watchesPath, map[string]interface{}{"bucket": "bucket", "webhookUrl": g.hook.URL}, nil); status != http.StatusOK {
+		t.Fatalf("Unable to create watch: %d", status)
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for _, name := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+			g.store.PutObject("ns", "bucket", name, []byte(name))
+			select {
+			case <-done:
+				return
+			case <-time.After(100 * time.Millisecond):
+			}
+		}
+	}()
+
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var m sseMessage
+	if err := websocket.JSON.Receive(ws, &m.Data); err != nil {
+		t.Fatalf("Expected an event: %v", err)
+	}
+	if m.Data.ID == "" || m.Data.Bucket != "bucket" || m.Data.Type != "NEW" {
+		t.Errorf("Unexpected event %+v", m.Data)
+	}
+}
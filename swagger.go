@@ -0,0 +1,108 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2017 Oracle and/or its affiliates.  All rights reserved.
+// This program is free software: you can modify it and/or redistribute it
+// under the terms of:
+//
+// (i)  the Universal Permissive License v 1.0 or at your option, any
+//      later version (http://oss.oracle.com/licenses/upl); and/or
+//
+// (ii) the Apache License v 2.0. (http://www.apache.org/licenses/LICENSE-2.0)
+//-----------------------------------------------------------------------------
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/fnproject/oci-objectstore-watcher/ociobjectstorewatcherpb"
+)
+
+// The REST contract of the gateway and the page to explore it.
+const (
+	swaggerPath  = "/api/v3/oci-objectstore-watcher/swagger.json"
+	explorerPath = "/api/v3/oci-objectstore-watcher/explorer/"
+)
+
+// feedParameters are the query parameters of the live feeds.
+var feedParameters = []interface{}{
+	map[string]interface{}{"name": "namespace", "in": "query", "required": false, "type": "string"},
+	map[string]interface{}{"name": "bucket", "in": "query", "required": false, "type": "string"},
+	map[string]interface{}{"name": "prefix", "in": "query", "required": false, "type": "string"},
+	map[string]interface{}{
+		"name":        "lastEventId",
+		"in":          "query",
+		"required":    false,
+		"type":        "string",
+		"description": "lastEventId is the id of the last event a reconnecting client received.\nThe recent events after it are sent first. EventSources send it in the Last-Event-ID header.",
+	},
+}
+
+// swaggerSpec returns the spec generated from the proto, with the version of
+// the gateway and the live feeds it serves next to the gRPC routes.
+func swaggerSpec() ([]byte, error) {
+	var spec map[string]interface{}
+	if err := json.Unmarshal([]byte(ociobjectstorewatcherpb.SwaggerJSON), &spec); err != nil {
+		return nil, err
+	}
+
+	spec["info"] = map[string]interface{}{
+		"title":       "OCI Object Store Watcher",
+		"description": "Watches object store buckets and reports the objects that are created, updated or deleted.",
+		"version":     Version(),
+	}
+
+	paths, _ := spec["paths"].(map[string]interface{})
+	if paths == nil {
+		paths = make(map[string]interface{})
+		spec["paths"] = paths
+	}
+	event := map[string]interface{}{"$ref": "#/definitions/ociobjectstorewatcherEvent"}
+	paths[eventStreamPath] = map[string]interface{}{
+		"get": map[string]interface{}{
+			"summary":     "EventStream sends the changes that match the filters as Server-Sent Events.\nThe id of every message is the id of its event.",
+			"operationId": "EventStream",
+			"produces":    []string{"text/event-stream"},
+			"parameters":  feedParameters,
+			"responses": map[string]interface{}{
+				"200": map[string]interface{}{
+					"description": "(event stream, the data of every message is an Event)",
+					"schema":      event,
+				},
+			},
+			"tags": []string{"OciObjectstoreWatcher"},
+		},
+	}
+	paths[eventWebSocketPath] = map[string]interface{}{
+		"get": map[string]interface{}{
+			"summary":     "EventWebSocket sends the changes that match the filters over a WebSocket.\nEvery text message is an Event.",
+			"operationId": "EventWebSocket",
+			"parameters":  feedParameters,
+			"responses": map[string]interface{}{
+				"101": map[string]interface{}{
+					"description": "(WebSocket, every message is an Event)",
+					"schema":      event,
+				},
+			},
+			"tags": []string{"OciObjectstoreWatcher"},
+		},
+	}
+
+	return json.MarshalIndent(spec, "", "  ")
+}
+
+// staticHandler serves content that does not change while the gateway runs.
+func staticHandler(contentType string, content []byte) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Cache-Control", "no-cache")
+		if r.Method == http.MethodGet {
+			w.Write(content)
+		}
+	})
+}
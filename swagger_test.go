@@ -0,0 +1,117 @@
+//-----------------------------------------------------------------------------
+// Copyright (c) 2017 Oracle and/or its affiliates.  All rights reserved.
+// This program is free software: you can modify it and/or redistribute it
+// under the terms of:
+//
+// (i)  the Universal Permissive License v 1.0 or at your option, any
+//      later version (http://oss.oracle.com/licenses/upl); and/or
+//
+// (ii) the Apache License v 2.0. (http://www.apache.org/licenses/LICENSE-2.0)
+//-----------------------------------------------------------------------------
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/fnproject/oci-objectstore-watcher/ociobjectstorewatcherpb"
+)
+
+// TestSwaggerJSONIsGenerated fails when the proto was regenerated without
+// embedding the new spec.
+func TestSwaggerJSONIsGenerated(t *testing.T) {
+	b, err := ioutil.ReadFile("ociobjectstorewatcherpb/ociobjectstorewatcher.swagger.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(string(b)) != strings.TrimSpace(ociobjectstorewatcherpb.SwaggerJSON) {
+		t.Error("SwaggerJSON differs from ociobjectstorewatcher.swagger.json, run go generate")
+	}
+}
+
+func TestGatewayServesSwagger(t *testing.T) {
+	g := newTestGateway(t)
+	defer g.close()
+
+	res, err := http.Get(g.URL + swaggerPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("Unexpected response %d %v", res.StatusCode, res.Header)
+	}
+
+	var spec struct {
+		Swagger string `json:"swagger"`
+		Info    struct {
+			Version string `json:"version"`
+		} `json:"info"`
+		Paths map[string]map[string]struct {
+			OperationID string `json:"operationId"`
+		} `json:"paths"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&spec); err != nil {
+		t.Fatalf("Invalid spec: %v", err)
+	}
+	if spec.Swagger != "2.0" || spec.Info.Version != Version() {
+		t.Errorf("Unexpected spec %s %s", spec.Swagger, spec.Info.Version)
+	}
+
+	expected := map[string]string{
+		watchesPath + "/{id}": "GetWatch",
+		watchesPath:           "CreateWatch",
+		eventStreamPath:       "EventStream",
+		eventWebSocketPath:    "EventWebSocket",
+	}
+	for path, operation := range expected {
+		found := false
+		for _, op := range spec.Paths[path] {
+			found = found || op.OperationID == operation
+		}
+		if !found {
+			t.Errorf("Expected %s at %s, got %v", operation, path, spec.Paths[path])
+		}
+	}
+
+	// The paths of the spec without parameters are served
+	for _, path := range []string{watchesPath} {
+		res, err := http.Get(g.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Errorf("%s: expected 200, got %d", path, res.StatusCode)
+		}
+	}
+}
+
+func TestGatewayServesExplorer(t *testing.T) {
+	g := newTestGateway(t)
+	defer g.close()
+
+	res, err := http.Get(g.URL + strings.TrimSuffix(explorerPath, "/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK || !strings.HasPrefix(res.Header.Get("Content-Type"), "text/html") {
+		t.Fatalf("Unexpected response %d %v", res.StatusCode, res.Header)
+	}
+	if !strings.Contains(string(b), `fetch("`+swaggerPath+`")`) {
+		t.Error("Expected the explorer to load the spec")
+	}
+	// The page is self-contained, so it works offline
+	if strings.Contains(string(b), "src=\"http") || strings.Contains(string(b), "href=\"http") {
+		t.Error("Expected the explorer not to load external resources")
+	}
+}